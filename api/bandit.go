@@ -0,0 +1,313 @@
+package smp
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/pathselection"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/sirupsen/logrus"
+)
+
+// Strategies of the BanditPathselection
+const (
+	BanditUCB1     = "UCB1"
+	BanditThompson = "Thompson"
+)
+
+const (
+	defaultBanditRoundLength = 5
+	defaultBanditDiscount    = 0.95
+	defaultBanditExploration = 1.0
+	defaultBanditMaxArms     = 32
+	// Lower bound of the reward variance assumed by Thompson sampling
+	banditMinVariance = 0.01
+	// Name of the selection in recorded decisions
+	banditSelectionName = "BanditPathselection"
+)
+
+// BanditPathselection treats each candidate pathset as arm of a multi-armed
+// bandit. A pathset is used for RoundLength updates, its reward is the
+// throughput of all conns during this round. Afterwards, the next pathset is
+// chosen via UCB1 or Thompson sampling. Statistics are discounted every round,
+// so that the selection keeps exploring and follows changing conditions
+type BanditPathselection struct {
+	remote   *PanSocket
+	NumConns int
+	// BanditUCB1 or BanditThompson
+	Strategy string
+	// Number of updates a pathset is used before the next decision
+	RoundLength int
+	// Factor in (0, 1] applied to the statistics of all arms each round,
+	// 1 weights all rewards equally
+	Discount float64
+	// Weight of the exploration term of UCB1
+	Exploration float64
+	// Maximum number of candidate pathsets, the least conflicting ones are used
+	MaxArms int
+
+	arms          []*banditArm
+	armsByID      map[string]*banditArm
+	current       *banditArm
+	samples       []float64
+	maxThroughput float64
+	numUpdates    int64
+	rand          *rand.Rand
+}
+
+type banditArm struct {
+	id    string
+	paths []snet.Path
+	// Discounted number of rounds, sum and sum of squares of rewards
+	pulls      float64
+	sum        float64
+	sumSquares float64
+}
+
+func (a *banditArm) mean() float64 {
+	if a.pulls == 0 {
+		return 0
+	}
+	return a.sum / a.pulls
+}
+
+func (a *banditArm) variance() float64 {
+	if a.pulls == 0 {
+		return 0
+	}
+	mean := a.mean()
+	return math.Max(a.sumSquares/a.pulls-mean*mean, 0)
+}
+
+func NewBanditPathselection(remote *PanSocket, numConns int, strategy string) *BanditPathselection {
+	if strategy != BanditThompson {
+		strategy = BanditUCB1
+	}
+	return &BanditPathselection{
+		remote:      remote,
+		NumConns:    numConns,
+		Strategy:    strategy,
+		RoundLength: defaultBanditRoundLength,
+		Discount:    defaultBanditDiscount,
+		Exploration: defaultBanditExploration,
+		MaxArms:     defaultBanditMaxArms,
+		armsByID:    make(map[string]*banditArm),
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Seeds the random source of Thompson sampling, e.g. to
+// reproduce the decisions of a recorded run in a replay
+func (b *BanditPathselection) SetSeed(seed int64) {
+	b.rand = rand.New(rand.NewSource(seed))
+}
+
+// Builds the arms from the paths to the remote
+func (b *BanditPathselection) updateArms() error {
+	paths, err := b.remote.lookupPaths()
+	if err != nil {
+		return err
+	}
+	b.setArms(paths)
+	return nil
+}
+
+// Builds the arms from paths. Statistics of pathsets
+// that are still available are kept
+func (b *BanditPathselection) setArms(paths []snet.Path) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		return lookup.Fingerprint(paths[i]) < lookup.Fingerprint(paths[j])
+	})
+
+	numConns := b.NumConns
+	if numConns > len(paths) {
+		numConns = len(paths)
+	}
+	d := pathselection.NewDisjointness(paths)
+
+	type candidate struct {
+		paths     []snet.Path
+		conflicts int
+	}
+	// Candidates are limited to avoid enumerating all combinations,
+	// a multiple of MaxArms leaves room to pick the least conflicting
+	candidates := make([]candidate, 0)
+	combinations(len(paths), numConns, func(idx []int) bool {
+		c := candidate{paths: make([]snet.Path, len(idx))}
+		for i, a := range idx {
+			c.paths[i] = paths[a]
+		}
+		c.conflicts, _ = d.Conflicts(idx)
+		candidates = append(candidates, c)
+		return len(candidates) < 10*b.MaxArms
+	})
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].conflicts < candidates[j].conflicts
+	})
+	if len(candidates) > b.MaxArms {
+		candidates = candidates[:b.MaxArms]
+	}
+
+	b.arms = make([]*banditArm, 0, len(candidates))
+	for _, c := range candidates {
+		id := pathsetID(c.paths)
+		arm, ok := b.armsByID[id]
+		if !ok {
+			arm = &banditArm{id: id, paths: c.paths}
+			b.armsByID[id] = arm
+		}
+		b.arms = append(b.arms, arm)
+	}
+}
+
+// Returns the least conflicting pathset, which is used to connect to the remote
+func (b *BanditPathselection) InitialPathset() (pathselection.PathSet, error) {
+	err := b.updateArms()
+	if err != nil {
+		return pathselection.PathSet{}, err
+	}
+	if len(b.arms) == 0 {
+		return pathselection.PathSet{}, nil
+	}
+	b.current = b.arms[0]
+	b.remote.recordDecision(banditSelectionName, b.current.paths)
+	return pathselection.WrapPathset(b.current.paths), nil
+}
+
+// Returns the pathset with the highest mean reward so far
+func (b *BanditPathselection) BestPathset() pathselection.PathSet {
+	var best *banditArm
+	for _, arm := range b.arms {
+		if arm.pulls > 0 && (best == nil || arm.mean() > best.mean()) {
+			best = arm
+		}
+	}
+	if best == nil {
+		return pathselection.PathSet{}
+	}
+	return pathselection.WrapPathset(best.paths)
+}
+
+// Goodput reported by the remote, or the throughput of all
+// conns in the last metrics interval if it does not report
+func (b *BanditPathselection) throughput() float64 {
+	if goodput, ok := b.remote.Goodput(); ok {
+		return float64(goodput)
+	}
+	var sum int64
+	for _, c := range b.remote.UnderlaySocket.GetConnections() {
+		bw := c.GetMetrics().WrittenBandwidth
+		if len(bw) > 0 {
+			sum += bw[len(bw)-1]
+		}
+	}
+	return float64(sum)
+}
+
+//
+// Has to be called periodically, e.g. once per metrics interval. Records the
+// throughput of the current pathset and chooses the next one at the end of each
+// round. Returns true, if connections were added or removed
+//
+func (b *BanditPathselection) UpdatePathSelection() (bool, error) {
+	if b.remote == nil {
+		return false, nil
+	}
+	b.samples = append(b.samples, b.throughput())
+	b.numUpdates++
+	roundLength := b.RoundLength
+	if roundLength <= 0 {
+		roundLength = defaultBanditRoundLength
+	}
+	if b.numUpdates%int64(roundLength) != 0 {
+		return false, nil
+	}
+
+	b.reward()
+	err := b.updateArms()
+	if err != nil {
+		return false, err
+	}
+	next := b.choose()
+	if next == nil || next == b.current {
+		return false, nil
+	}
+
+	logrus.Debug("[BanditPathselection] Switching to pathset ", next.id)
+	b.current = next
+	b.remote.recordDecision(banditSelectionName, next.paths)
+	return applyPathset(b.remote, next.paths)
+}
+
+// Adds the throughput of the finished round to the current arm. The first
+// sample is skipped, since the conns ramp up after a switch
+func (b *BanditPathselection) reward() {
+	samples := b.samples
+	b.samples = nil
+	if len(samples) > 1 {
+		samples = samples[1:]
+	}
+	if b.current == nil || len(samples) == 0 {
+		return
+	}
+
+	r := 0.0
+	for _, s := range samples {
+		r += s
+	}
+	r /= float64(len(samples))
+	if r > b.maxThroughput {
+		b.maxThroughput = r
+	}
+
+	for _, arm := range b.armsByID {
+		arm.pulls *= b.Discount
+		arm.sum *= b.Discount
+		arm.sumSquares *= b.Discount
+	}
+	b.current.pulls++
+	b.current.sum += r
+	b.current.sumSquares += r * r
+	logrus.Debug("[BanditPathselection] Reward ", r, " for pathset ", b.current.id)
+}
+
+// Chooses the next arm, arms that were never used are tried first
+func (b *BanditPathselection) choose() *banditArm {
+	for _, arm := range b.arms {
+		if arm.pulls == 0 {
+			return arm
+		}
+	}
+
+	// Rewards are normalized to [0, 1] by the highest throughput seen
+	norm := b.maxThroughput
+	if norm == 0 {
+		norm = 1
+	}
+	total := 0.0
+	for _, arm := range b.arms {
+		total += arm.pulls
+	}
+
+	var best *banditArm
+	bestScore := math.Inf(-1)
+	for _, arm := range b.arms {
+		mean := arm.mean() / norm
+		var score float64
+		switch b.Strategy {
+		case BanditThompson:
+			variance := math.Max(arm.variance()/(norm*norm), banditMinVariance)
+			score = mean + b.rand.NormFloat64()*math.Sqrt(variance/arm.pulls)
+		default:
+			score = mean + b.Exploration*math.Sqrt(2*math.Log(math.Max(total, 1))/arm.pulls)
+		}
+		if score > bestScore {
+			best = arm
+			bestScore = score
+		}
+	}
+	return best
+}
@@ -0,0 +1,143 @@
+package smp
+
+import (
+	"testing"
+
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// Arm with pulls rounds of the same reward
+func constantArm(id string, pulls, reward float64) *banditArm {
+	return &banditArm{id: id, pulls: pulls, sum: pulls * reward, sumSquares: pulls * reward * reward}
+}
+
+func testBandit(strategy string, maxThroughput float64, arms ...*banditArm) *BanditPathselection {
+	b := NewBanditPathselection(nil, 1, strategy)
+	b.SetSeed(1)
+	b.maxThroughput = maxThroughput
+	b.arms = arms
+	for _, arm := range arms {
+		b.armsByID[arm.id] = arm
+	}
+	return b
+}
+
+func Test_BanditPathselection(t *testing.T) {
+	t.Run("Untried Arms First", func(t *testing.T) {
+		for _, strategy := range []string{BanditUCB1, BanditThompson} {
+			b := testBandit(strategy, 1000, constantArm("a", 3, 900), constantArm("b", 0, 0), constantArm("c", 0, 0))
+			if got := b.choose(); got.id != "b" {
+				t.Fatalf("%s: expected the first untried arm b, got %s", strategy, got.id)
+			}
+		}
+	})
+
+	t.Run("UCB1", func(t *testing.T) {
+		// a: mean 0.9 and bonus sqrt(2 ln 9 / 8) = 0.74, b: mean 0.5 and bonus sqrt(2 ln 9) = 2.1
+		tests := []struct {
+			name        string
+			exploration float64
+			expected    string
+		}{
+			{"Explores Rarely Used Arm", 1, "b"},
+			{"Weak Exploration", 0.1, "a"},
+			{"No Exploration", 0, "a"},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				b := testBandit(BanditUCB1, 1000, constantArm("a", 8, 900), constantArm("b", 1, 500))
+				b.Exploration = tc.exploration
+				if got := b.choose(); got.id != tc.expected {
+					t.Fatalf("Expected arm %s, got %s", tc.expected, got.id)
+				}
+			})
+		}
+	})
+
+	t.Run("Thompson Prefers Clearly Better Arm", func(t *testing.T) {
+		// Scores deviate by about sqrt(0.01 / 10) = 0.03 from the means 0.9 and 0.2
+		b := testBandit(BanditThompson, 1000, constantArm("a", 10, 200), constantArm("b", 10, 900))
+		for i := 0; i < 100; i++ {
+			if got := b.choose(); got.id != "b" {
+				t.Fatalf("Draw %d: expected arm b, got %s", i, got.id)
+			}
+		}
+	})
+
+	t.Run("Thompson Is Reproducible With Seed", func(t *testing.T) {
+		draw := func() []string {
+			b := testBandit(BanditThompson, 1000, constantArm("a", 1, 500), constantArm("b", 1, 490))
+			ids := make([]string, 50)
+			for i := range ids {
+				ids[i] = b.choose().id
+			}
+			return ids
+		}
+		first, second := draw(), draw()
+		chosen := make(map[string]bool)
+		for i := range first {
+			if first[i] != second[i] {
+				t.Fatalf("Draw %d: expected arm %s with the same seed, got %s", i, first[i], second[i])
+			}
+			chosen[first[i]] = true
+		}
+		if len(chosen) != 2 {
+			t.Fatalf("Expected both similar arms to be sampled, got %v", chosen)
+		}
+	})
+
+	t.Run("Reward Skips Ramp Up And Discounts", func(t *testing.T) {
+		current, other := constantArm("a", 1, 100), constantArm("b", 2, 200)
+		b := testBandit(BanditUCB1, 0, current, other)
+		b.Discount = 0.5
+		b.current = current
+		b.samples = []float64{100, 200, 400}
+		b.reward()
+
+		if b.samples != nil {
+			t.Fatalf("Expected the samples to be reset, got %v", b.samples)
+		}
+		if b.maxThroughput != 300 {
+			t.Fatalf("Expected max throughput 300, got %f", b.maxThroughput)
+		}
+		if current.pulls != 1.5 || current.sum != 350 {
+			t.Fatalf("Expected 1.5 pulls and sum 350 of the current arm, got %f and %f", current.pulls, current.sum)
+		}
+		if other.pulls != 1 || other.sum != 200 {
+			t.Fatalf("Expected 1 pull and sum 200 of the other arm, got %f and %f", other.pulls, other.sum)
+		}
+	})
+
+	t.Run("Arms Are Least Conflicting Pathsets", func(t *testing.T) {
+		via111 := testutil.Path("1-ff00:0:110", 1, "1-ff00:0:111", 1, "1-ff00:0:111", 2, "1-ff00:0:113", 1)
+		via112 := testutil.Path("1-ff00:0:110", 2, "1-ff00:0:112", 1, "1-ff00:0:112", 2, "1-ff00:0:113", 2)
+		via114 := testutil.Path("1-ff00:0:110", 3, "1-ff00:0:114", 1, "1-ff00:0:114", 2, "1-ff00:0:113", 3)
+		// Shares interfaces with via111, so that pathset comes last
+		via111Alt := testutil.Path("1-ff00:0:110", 1, "1-ff00:0:111", 1, "1-ff00:0:111", 3, "1-ff00:0:113", 4)
+		b := NewBanditPathselection(nil, 2, BanditUCB1)
+		b.MaxArms = 3
+		b.setArms([]snet.Path{via114, via112, via111Alt, via111})
+
+		expected := []string{
+			pathsetID([]snet.Path{via111, via112}),
+			pathsetID([]snet.Path{via111, via114}),
+			pathsetID([]snet.Path{via111Alt, via112}),
+		}
+		if len(b.arms) != len(expected) {
+			t.Fatalf("Expected %d arms, got %d", len(expected), len(b.arms))
+		}
+		for i, id := range expected {
+			if b.arms[i].id != id {
+				t.Fatalf("Arm %d: expected %s, got %s", i, id, b.arms[i].id)
+			}
+		}
+
+		// Statistics of pathsets that are still available are kept
+		b.arms[1].pulls = 2
+		b.setArms([]snet.Path{via111, via112, via114, via111Alt})
+		if b.arms[1].pulls != 2 {
+			t.Fatalf("Expected the statistics of arm %s to be kept", b.arms[1].id)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package smp
+
+import (
+	"github.com/netsys-lab/scion-path-discovery/congestion"
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// Implemented by conns with their own congestion control, e.g. socket.ReliableConn
+type congestionControlled interface {
+	Congestion() congestion.Controller
+}
+
+// Path the conn sends over, which is the one congestion control acts on
+func sendPath(conn packets.UDPConn) *snet.Path {
+	if ac, ok := conn.(packets.AsymmetricConn); ok {
+		return ac.GetReplyPath()
+	}
+	return conn.GetPath()
+}
+
+// Couples the windows of all conns whose paths share at least one
+// interface, since they may share a bottleneck. Conns over disjoint
+// paths keep independent windows
+func updateCoupling(group *congestion.CoupledGroup, conns []packets.UDPConn) {
+	if group == nil {
+		return
+	}
+
+	subflows := make([]*congestion.Subflow, 0, len(conns))
+	paths := make([]*snet.Path, 0, len(conns))
+	for _, c := range conns {
+		cc, ok := c.(congestionControlled)
+		if !ok {
+			continue
+		}
+		sf, ok := cc.Congestion().(*congestion.Subflow)
+		if !ok {
+			continue
+		}
+		path := sendPath(c)
+		if path == nil || *path == nil || (*path).Metadata() == nil {
+			continue
+		}
+		subflows = append(subflows, sf)
+		paths = append(paths, path)
+	}
+
+	for i := range subflows {
+		for j := i + 1; j < len(subflows); j++ {
+			group.Couple(subflows[i], subflows[j], numPathsConflict(*paths[i], *paths[j]) > 0)
+		}
+	}
+}
+
+func (mp *PanSocket) updateCoupling() {
+	updateCoupling(mp.coupling, mp.UnderlaySocket.GetConnections())
+}
+
+func (ps *PanSession) updateCoupling() {
+	updateCoupling(ps.coupling, ps.GetConnections())
+}
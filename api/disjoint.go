@@ -13,68 +13,78 @@ import (
 
 func NewDisjointPathSelectionSocket(remote *PanSocket, numConns, numExploreConns int) *DisjointPathselection {
 	return &DisjointPathselection{
-		remote:          remote,
-		NumExploreConns: numExploreConns,
-		NumConns:        numConns,
-		metricsMap:      make(map[string]*packets.PathMetrics),
+		remote:            remote,
+		NumExploreConns:   numExploreConns,
+		NumConns:          numConns,
+		metricsMap:        make(map[string]*packets.PathMetrics),
+		Bottlenecks:       pathselection.NewBottleneckDetector(),
+		ExplorationBudget: defaultExplorationBudget,
 	}
 }
 
 func numPathsConflict(path1, path2 snet.Path) int {
-	path1Interfaces := path1.Metadata().Interfaces
-	path2Interfaces := path2.Metadata().Interfaces
-	conflicts := 0
-	for i, intP1 := range path1Interfaces {
-		for j, intP2 := range path2Interfaces {
-			if i == 0 && j == 0 {
-				continue
-			}
-			if i == (len(path1Interfaces)-1) && j == (len(path2Interfaces)-1) {
-				continue
-			}
-			if intP1.IA.Equal(intP2.IA) && intP1.ID == intP2.ID {
-				conflicts++
-			}
-		}
+	return pathselection.InterfaceConflicts(path1, path2)
+}
+
+// Conflicts between all paths to the remote. Paths are ordered by fingerprint,
+// which makes the tie breaks of the ranking and selection deterministic
+func (dj *DisjointPathselection) disjointness() (*pathselection.Disjointness, error) {
+	paths, err := dj.remote.lookupPaths()
+	if err != nil {
+		return nil, err
 	}
-	return conflicts
+	sort.SliceStable(paths, func(i, j int) bool {
+		return lookup.Fingerprint(paths[i]) < lookup.Fingerprint(paths[j])
+	})
+	d := pathselection.NewDisjointness(paths)
+	dj.applyBottlenecks(d)
+	return d, nil
 }
 
+// Returns all paths to the remote ordered by their conflicts with all other paths
 func (dj *DisjointPathselection) GetPathConflictEntries() ([]PathWrap, error) {
-	// Put all paths in one list and sort them according to number of hops
-	allPaths := make([]PathWrap, 0)
-	paths, err := lookup.PathLookup(dj.remote.Peer.String())
+	d, err := dj.disjointness()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, pp := range paths {
-		pw := PathWrap{
-			Address: *dj.remote.Peer,
-			Path:    pp,
-		}
-		allPaths = append(allPaths, pw)
+	entries := make([]PathWrap, 0, len(d.Paths))
+	for _, i := range d.Ranking() {
+		entries = append(entries, PathWrap{
+			Address:      *dj.remote.Peer,
+			Path:         d.Paths[i],
+			NumConflicts: d.NumConflicts(i),
+		})
 	}
 
-	sort.Slice(allPaths, func(i, j int) bool {
-		return len(allPaths[i].Path.Metadata().Interfaces) < len(allPaths[j].Path.Metadata().Interfaces)
-	})
+	logrus.Debug("[DisjointPathselection] Updated PathConflictEntries to remote ", dj.remote.Peer.String(), " got ", len(entries), " entries")
+
+	return entries, nil
+}
 
-	// Add conflicts
-	for i, path := range allPaths {
-		for _, path2 := range allPaths[i:] {
-			curConflicts := numPathsConflict(path.Path, path2.Path)
-			path.NumConflicts += curConflicts
+// Overrides the conflicts of d with the measurements of the BottleneckDetector:
+// Paths that share a bottleneck conflict even without common interfaces, paths
+// measured to be independent do not conflict despite common interfaces or links
+func (dj *DisjointPathselection) applyBottlenecks(d *pathselection.Disjointness) {
+	if dj.Bottlenecks == nil {
+		return
+	}
+	for i := range d.Paths {
+		for j := range d.Paths[:i] {
+			fp1, fp2 := lookup.Fingerprint(d.Paths[i]), lookup.Fingerprint(d.Paths[j])
+			if fp1 == fp2 {
+				continue
+			}
+			shared, known := dj.Bottlenecks.SharesBottleneck(fp1, fp2)
+			switch {
+			case !known:
+			case shared && d.InterfaceConflicts(i, j) == 0:
+				d.SetConflicts(i, j, 1, d.LinkConflicts(i, j))
+			case !shared:
+				d.SetConflicts(i, j, 0, 0)
+			}
 		}
 	}
-
-	sort.Slice(allPaths, func(i, j int) bool {
-		return allPaths[i].NumConflicts < allPaths[j].NumConflicts
-	})
-
-	logrus.Debug("[DisjointPathselection] Updated PathConflictEntries to remote ", dj.remote.Peer.String(), " got ", len(allPaths), " entries")
-
-	return allPaths, nil
 }
 
 type PathWrap struct {
@@ -87,122 +97,146 @@ type DisjointPathselection struct {
 	remote                   *PanSocket
 	NumExploreConns          int
 	NumConns                 int
-	metricsMap               map[string]*packets.PathMetrics // Indicates the performance of the particular pathset -> id = path1|path2|path3 etc
+	metricsMap               map[string]*packets.PathMetrics // Indicates the performance of the particular pathset -> id = pathsetID
 	latestBestWriteBandwidth int64
 	numUpdates               int64
 	latestPathSet            []snet.Path
 	currentPathSet           []snet.Path
+	// Detects shared bottlenecks of the used paths from their metrics,
+	// nil disables the detection
+	Bottlenecks *pathselection.BottleneckDetector
+	// Maximum number of candidate pathsets examined per exploration step
+	ExplorationBudget int
+	// Goodput reported by the remote since the last evaluation
+	goodputSamples []int64
 }
 
-// Perm calls f with each permutation of a.
-func Perm(a []string, f func([]string)) {
-	perm(a, f, 0)
+// Default number of candidate pathsets examined per exploration step
+const defaultExplorationBudget = 1000
+
+// Name of the selection in recorded decisions
+const disjointSelectionName = "DisjointPathselection"
+
+// Canonical identity of a pathset, independent of the order of its paths
+func pathsetID(paths []snet.Path) string {
+	fps := make([]string, 0, len(paths))
+	for _, p := range paths {
+		fps = append(fps, string(lookup.Fingerprint(p)))
+	}
+	sort.Strings(fps)
+	return strings.Join(fps, "|")
 }
 
-// Permute the values at index i to len(a)-1.
-func perm(a []string, f func([]string), i int) {
-	if i > len(a) {
-		f(a)
+// Calls f with the indices of each k-subset of n elements in
+// lexicographic order, until f returns false
+func combinations(n, k int, f func([]int) bool) {
+	if k < 0 || k > n {
 		return
 	}
-	perm(a, f, i+1)
-	for j := i + 1; j < len(a); j++ {
-		a[i], a[j] = a[j], a[i]
-		perm(a, f, i+1)
-		a[i], a[j] = a[j], a[i]
+	idx := make([]int, k)
+	for i := range idx {
+		idx[i] = i
+	}
+	for {
+		if !f(idx) {
+			return
+		}
+		i := k - 1
+		for i >= 0 && idx[i] == n-k+i {
+			i--
+		}
+		if i < 0 {
+			return
+		}
+		idx[i]++
+		for j := i + 1; j < k; j++ {
+			idx[j] = idx[j-1] + 1
+		}
 	}
 }
 
+//
+// Returns the next pathset that was not evaluated yet. NumConns - NumExploreConns
+// paths are kept, selected greedily to be as disjoint as possible, the others are chosen
+// from the remaining paths. Candidates are examined in the order of the conflict ranking,
+// at most ExplorationBudget of them, and the one with the fewest interface conflicts
+// between its paths is returned, ties are broken by link conflicts.
+// Returns an empty pathset if all examined candidates were evaluated before
+//
 func (dj *DisjointPathselection) GetNextProbingPathset() (pathselection.PathSet, error) {
 	logrus.Debug("[DisjointPathselection] GetNextProbingPathSet called")
-	alreadyCheckedPathsets := make([]string, 0)
-	for k, _ := range dj.metricsMap {
-		alreadyCheckedPathsets = append(alreadyCheckedPathsets, k)
-	}
-
-	conflictPaths, err := dj.GetPathConflictEntries()
+	d, err := dj.disjointness()
 	if err != nil {
 		return pathselection.PathSet{}, err
 	}
+	paths := d.Paths
 
-	psId := ""
-	defaultPsId := ""
-
-	fixedPaths := dj.NumConns - dj.NumExploreConns
-	for i := 0; i < fixedPaths; i++ {
-		defaultPsId += lookup.PathToString(conflictPaths[i].Path) + "|"
+	numConns := dj.NumConns
+	if numConns > len(paths) {
+		numConns = len(paths)
 	}
-
-	matchingPsId := ""
-	remainingPaths := conflictPaths[fixedPaths:]
-	remainginPathIds := make([]string, 0)
-	for _, p := range remainingPaths {
-		remainginPathIds = append(remainginPathIds, lookup.PathToString(p.Path))
+	fixedPaths := numConns - dj.NumExploreConns
+	if fixedPaths < 0 {
+		fixedPaths = 0
 	}
 
-	matchingPs := pathselection.PathSet{}
-	Perm(remainginPathIds, func(s []string) {
-		psId = defaultPsId
-		for i, v := range s {
-			if i < (dj.NumConns - fixedPaths) {
-				psId = psId + v + "|"
-			}
-
+	fixed := d.SelectDisjoint(fixedPaths)
+	isFixed := make([]bool, len(paths))
+	for _, i := range fixed {
+		isFixed[i] = true
+	}
+	remaining := make([]int, 0, len(paths)-fixedPaths)
+	for _, i := range d.Ranking() {
+		if !isFixed[i] {
+			remaining = append(remaining, i)
 		}
+	}
 
-		parts := strings.Split(psId, "|")
-		isPathNewForAlreadyChecked := make([]bool, 0)
-		for _, p := range alreadyCheckedPathsets {
-			newP := false // One path is new
-			for _, v := range parts {
-				if !strings.Contains(p, v) {
-					newP = true
-					break
-				}
-			}
-			isPathNewForAlreadyChecked = append(isPathNewForAlreadyChecked, newP)
-		}
+	budget := dj.ExplorationBudget
+	if budget <= 0 {
+		budget = defaultExplorationBudget
+	}
 
-		pathCombinationWasUsedBefore := false
-		// If at least one entry is false, then this one is not new
-		for _, newP := range isPathNewForAlreadyChecked {
-			if !newP {
-				pathCombinationWasUsedBefore = true
-				break
-			}
+	var best []int
+	bestInterfaces, bestLinks := 0, 0
+	examined := 0
+	candidate := make([]int, numConns)
+	copy(candidate, fixed)
+	combinations(len(remaining), numConns-fixedPaths, func(idx []int) bool {
+		examined++
+		for i, j := range idx {
+			candidate[fixedPaths+i] = remaining[j]
 		}
 
-		if !pathCombinationWasUsedBefore && matchingPsId == "" {
-			matchingPsId = psId
-			logrus.Debug("[DisjointPathselection] Found new Pathset to evaluate: ", psId)
-			paths := make([]snet.Path, 0)
-
-			for k := 0; k < fixedPaths; k++ {
-				paths = append(paths, conflictPaths[k].Path)
+		candidatePaths := make([]snet.Path, numConns)
+		for i, j := range candidate {
+			candidatePaths[i] = paths[j]
+		}
+		if _, evaluated := dj.metricsMap[pathsetID(candidatePaths)]; !evaluated {
+			interfaces, links := d.Conflicts(candidate)
+			if best == nil || interfaces < bestInterfaces || (interfaces == bestInterfaces && links < bestLinks) {
+				best = append([]int{}, candidate...)
+				bestInterfaces, bestLinks = interfaces, links
 			}
-
-			for i, pId := range s {
-				if i < (dj.NumConns - fixedPaths) {
-					for _, p := range conflictPaths {
-						if lookup.PathToString(p.Path) == pId {
-							paths = append(paths, p.Path)
-							break
-						}
-					}
-				}
+			// A disjoint candidate cannot be improved
+			if interfaces == 0 && links == 0 {
+				return false
 			}
-
-			matchingPs = pathselection.WrapPathset(paths)
 		}
+		return examined < budget
 	})
 
-	if matchingPsId != "" {
-		return matchingPs, nil
+	if best == nil {
+		logrus.Debug("[DisjointPathselection] No new Pathset found after examining ", examined, " candidates")
+		return pathselection.PathSet{}, nil
 	}
 
-	logrus.Debug("[DisjointPathselection] No new Pathset found")
-
-	return pathselection.PathSet{}, nil
+	selected := make([]snet.Path, len(best))
+	for i, j := range best {
+		selected[i] = paths[j]
+	}
+	logrus.Debug("[DisjointPathselection] Found new Pathset to evaluate: ", pathsetID(selected), " with ", bestInterfaces, " conflicts")
+	return pathselection.WrapPathset(selected), nil
 }
 
 func (dj *DisjointPathselection) InitialPathset() (pathselection.PathSet, error) {
@@ -214,34 +248,105 @@ func (dj *DisjointPathselection) InitialPathset() (pathselection.PathSet, error)
 		return ps, err
 	}
 	logrus.Debug("[DisjointPathSelection] Initial paths: ", ps.Paths)
+	if len(ps.Paths) > 0 {
+		dj.currentPathSet = pathselection.UnwrapPathset(ps)
+		dj.remote.recordDecision(disjointSelectionName, dj.currentPathSet)
+	}
 	return ps, nil
 }
 
+//
+// Changes the number of connections used by the selection,
+// the active set grows or shrinks with the next pathset applied
+//
+func (dj *DisjointPathselection) SetNumConns(numConns, numExploreConns int) {
+	dj.NumConns = numConns
+	dj.NumExploreConns = numExploreConns
+}
+
+// Moves the existing connections to the passed paths and opens or closes
+// connections if the number of paths changed. Returns true, if connections
+// were added or removed
+func (dj *DisjointPathselection) applyPathset(paths []snet.Path) (bool, error) {
+	return applyPathset(dj.remote, paths)
+}
+
+func applyPathset(remote *PanSocket, paths []snet.Path) (bool, error) {
+	paths, err := remote.pinPaths(paths)
+	if err != nil {
+		return false, err
+	}
+	conns := remote.UnderlaySocket.GetConnections()
+	for i, c := range conns {
+		if i < len(paths) {
+			c.SetPath(&paths[i])
+			continue
+		}
+		logrus.Debug("[PanSocket] Shrinking active set, removing conn to ", c.GetRemote().String())
+		err := remote.RemovePath(c)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	for i := len(conns); i < len(paths); i++ {
+		logrus.Debug("[PanSocket] Growing active set, adding path ", lookup.PathToString(paths[i]))
+		_, err := remote.AddPath(paths[i])
+		if err != nil {
+			return true, err
+		}
+	}
+
+	remote.updateCoupling()
+	return len(conns) != len(paths), nil
+}
+
+// Bandwidth of the current pathset, the goodput reported by the remote
+// if available, otherwise the bandwidth written to the conns
+func (dj *DisjointPathselection) pathsetBandwidth(metrics *packets.PathMetrics) int64 {
+	samples := dj.goodputSamples
+	dj.goodputSamples = nil
+	if len(samples) == 0 {
+		return metrics.LastAverageWriteBandwidth(5)
+	}
+	var sum int64
+	for _, s := range samples {
+		sum += s
+	}
+	return sum / int64(len(samples))
+}
+
 func (dj *DisjointPathselection) UpdatePathSelection() (bool, error) {
 	if dj.remote == nil {
 		return false, nil
 	}
-	pathSet := dj.remote.GetCurrentPathset()
-	currentId := ""
-	for _, p := range pathSet.Paths {
-		currentId += lookup.PathToString(p.SnetPath) + "|"
-	}
+	currentId := pathsetID(pathselection.UnwrapPathset(dj.remote.GetCurrentPathset()))
 
 	logrus.Trace("Looking up id ", currentId)
 
 	newMetrics := dj.remote.AggregateMetrics()
 	dj.metricsMap[currentId] = newMetrics
+	if dj.Bottlenecks != nil {
+		connMetrics := make([]*packets.PathMetrics, 0)
+		for _, c := range dj.remote.UnderlaySocket.GetConnections() {
+			connMetrics = append(connMetrics, c.GetMetrics())
+		}
+		dj.Bottlenecks.Observe(connMetrics)
+	}
+	if goodput, ok := dj.remote.Goodput(); ok {
+		dj.goodputSamples = append(dj.goodputSamples, goodput)
+	}
 
 	logrus.Debug("[DisjointPathselection] UpdatePathSelection called")
 	dj.numUpdates++
 
 	// Compare to best, to make socket re-dial to improve performance
 	if dj.numUpdates%5 == 0 {
-		logrus.Error("[DisjointPathselection] Comparing old bw ", dj.latestBestWriteBandwidth, " to ", newMetrics.LastAverageWriteBandwidth(5))
-		// TODO: This is not working properly here...
-		if newMetrics.LastAverageWriteBandwidth(5) > dj.latestBestWriteBandwidth {
+		bw := dj.pathsetBandwidth(newMetrics)
+		logrus.Debug("[DisjointPathselection] Comparing old bw ", dj.latestBestWriteBandwidth, " to ", bw)
+		if bw > dj.latestBestWriteBandwidth {
 			logrus.Debug("[DisjointPathselection] Got better pathset, reconnecting")
-			dj.latestBestWriteBandwidth = newMetrics.LastAverageWriteBandwidth(5)
+			dj.latestBestWriteBandwidth = bw
 
 			// Here we have our new path set, from which we start
 			dj.latestPathSet = dj.currentPathSet
@@ -259,19 +364,19 @@ func (dj *DisjointPathselection) UpdatePathSelection() (bool, error) {
 		if len(ps.Paths) == 0 {
 			paths = dj.latestPathSet
 		}
-		logrus.Warn(paths)
-		conns := dj.remote.UnderlaySocket.GetConnections()
-		if len(paths) < len(conns) {
+		if len(paths) == 0 {
 			logrus.Warn("[DisjointPathSelection] Invalid pathset found...")
 			return false, nil
 		}
-		// Here the number of connections won't change, so we have the same number of connections
-		// as paths
 
-		for i, c := range conns {
-			c.SetPath(&paths[i])
+		dj.remote.recordDecision(disjointSelectionName, paths)
+		changed, err := dj.applyPathset(paths)
+		if err != nil {
+			return changed, err
 		}
-		return false, nil
+		// Measured until the next comparison
+		dj.currentPathSet = paths
+		return changed, nil
 
 	}
 	// }
@@ -0,0 +1,160 @@
+package smp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/netsys-lab/scion-path-discovery/trace"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+var (
+	via111 = testutil.Path("1-ff00:0:110", 1, "1-ff00:0:111", 1, "1-ff00:0:111", 2, "1-ff00:0:113", 1)
+	via112 = testutil.Path("1-ff00:0:110", 2, "1-ff00:0:112", 1, "1-ff00:0:112", 2, "1-ff00:0:113", 2)
+	via114 = testutil.Path("1-ff00:0:110", 3, "1-ff00:0:114", 1, "1-ff00:0:114", 2, "1-ff00:0:113", 3)
+)
+
+// Socket whose lookups return paths, without a network
+func lookupSocket(t *testing.T, paths ...snet.Path) *PanSocket {
+	sock, err := NewReplaySocket(&trace.Trace{Events: []trace.Event{{
+		Type:   trace.EventLookup,
+		Remote: "1-ff00:0:113,[127.0.0.2]:41000",
+		Paths:  trace.NewPaths(paths),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sock
+}
+
+func Test_DisjointPathselection(t *testing.T) {
+	t.Run("Combinations", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			n, k     int
+			expected [][]int
+		}{
+			{"Pairs", 4, 2, [][]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}, {2, 3}}},
+			{"All Elements", 3, 3, [][]int{{0, 1, 2}}},
+			{"Singles", 3, 1, [][]int{{0}, {1}, {2}}},
+			{"Empty Subset", 3, 0, [][]int{{}}},
+			{"More Than Available", 2, 3, nil},
+			{"Negative Size", 2, -1, nil},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				var got [][]int
+				combinations(tc.n, tc.k, func(idx []int) bool {
+					got = append(got, append([]int{}, idx...))
+					return true
+				})
+				if !reflect.DeepEqual(got, tc.expected) {
+					t.Fatalf("Expected %v, got %v", tc.expected, got)
+				}
+			})
+		}
+	})
+
+	t.Run("Combinations Stop Early", func(t *testing.T) {
+		var got [][]int
+		combinations(5, 2, func(idx []int) bool {
+			got = append(got, append([]int{}, idx...))
+			return len(got) < 3
+		})
+		expected := [][]int{{0, 1}, {0, 2}, {0, 3}}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("Expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("Pathset ID Is Order Independent", func(t *testing.T) {
+		id := pathsetID([]snet.Path{via111, via112, via114})
+		for _, paths := range [][]snet.Path{
+			{via114, via112, via111},
+			{via112, via111, via114},
+		} {
+			if got := pathsetID(paths); got != id {
+				t.Fatalf("Expected %q, got %q", id, got)
+			}
+		}
+		if pathsetID([]snet.Path{via111, via112}) == id {
+			t.Fatal("Expected pathsets of different paths to differ")
+		}
+		if pathsetID(nil) != "" {
+			t.Fatalf("Expected an empty ID for an empty pathset, got %q", pathsetID(nil))
+		}
+	})
+
+	t.Run("Exploration Budget", func(t *testing.T) {
+		// Single paths are examined in fingerprint order, since none of
+		// them conflict. The first two were evaluated before
+		paths := []snet.Path{via111, via112, via114}
+		tests := []struct {
+			budget   int
+			expected []snet.Path
+		}{
+			{1, nil},
+			{2, nil},
+			{3, []snet.Path{via114}},
+			{0, []snet.Path{via114}},
+		}
+		for _, tc := range tests {
+			sel := NewDisjointPathSelectionSocket(lookupSocket(t, paths...), 1, 1)
+			sel.ExplorationBudget = tc.budget
+			sel.metricsMap[pathsetID([]snet.Path{via111})] = packets.NewPathMetrics(0)
+			sel.metricsMap[pathsetID([]snet.Path{via112})] = packets.NewPathMetrics(0)
+
+			ps, err := sel.GetNextProbingPathset()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ps.Paths) != len(tc.expected) {
+				t.Fatalf("Budget %d: expected %d paths, got %d", tc.budget, len(tc.expected), len(ps.Paths))
+			}
+			for i, p := range tc.expected {
+				if got := lookup.Fingerprint(ps.Paths[i].SnetPath); got != lookup.Fingerprint(p) {
+					t.Fatalf("Budget %d: expected path %s, got %s", tc.budget, lookup.Fingerprint(p), got)
+				}
+			}
+		}
+	})
+	t.Run("Exhausted Exploration Returns To Best Pathset", func(t *testing.T) {
+		sock := lookupSocket(t, via111, via112, via114)
+		sel := NewDisjointPathSelectionSocket(sock, 1, 1)
+		pathset, err := sel.InitialPathset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pathset.Address = *sock.Peer
+		err = sock.Connect(&pathset, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Each pathset is compared after 5 updates, the first one is the best
+		var explored []snet.Path
+		for _, bw := range []int64{300, 100, 200} {
+			explored = append(explored, *sock.UnderlaySocket.GetConnections()[0].GetPath())
+			sel.goodputSamples = []int64{bw}
+			for i := 0; i < 5; i++ {
+				_, err := sel.UpdatePathSelection()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if pathsetID(explored) != pathsetID([]snet.Path{via111, via112, via114}) {
+			t.Fatalf("Expected all paths to be explored, got %s", pathsetID(explored))
+		}
+		conns := sock.UnderlaySocket.GetConnections()
+		if len(conns) != 1 {
+			t.Fatalf("Expected 1 conn, got %d", len(conns))
+		}
+		if got := lookup.Fingerprint(*conns[0].GetPath()); got != lookup.Fingerprint(explored[0]) {
+			t.Fatalf("Expected the best pathset %s, got %s", lookup.Fingerprint(explored[0]), got)
+		}
+	})
+}
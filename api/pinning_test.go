@@ -0,0 +1,118 @@
+package smp
+
+import (
+	"errors"
+	"testing"
+
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/netsys-lab/scion-path-discovery/pathselection"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
+	"github.com/netsys-lab/scion-path-discovery/socket"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+func Test_Pinning(t *testing.T) {
+	network := newEmulatedNetwork(t)
+	scionhost.SetNetwork(network)
+	defer scionhost.SetNetwork(nil)
+	defer network.Close()
+
+	peer, err := snet.ParseUDPAddr("1-ff00:0:113,[127.0.0.2]:41200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin := "[1-ff00:0:110 3>1 1-ff00:0:114 2>3 1-ff00:0:113]"
+
+	t.Run("Pinned Path Stays In Active Set", func(t *testing.T) {
+		server, err := NewPanSock(peer.String(), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = server.Listen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Disconnect()
+		accepted := make(chan error, 1)
+		go func() {
+			_, err := server.WaitForPeerConnect(nil)
+			accepted <- err
+		}()
+
+		client, err := NewPanSock("1-ff00:0:110,[127.0.0.1]:41300", peer, &PanSocketOptions{
+			Transport:   "SCION",
+			PinnedPaths: []string{pin},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = client.Listen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Disconnect()
+
+		sel := NewDisjointPathSelectionSocket(client, 1, 1)
+		pathset, err := sel.InitialPathset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pathset.Address = *peer
+		err = client.Connect(&pathset, &socket.ConnectOptions{SendAddrPacket: true, NoMetricsCollection: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = <-accepted
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pinned := func() bool {
+			for _, p := range pathselection.UnwrapPathset(client.GetCurrentPathset()) {
+				if lookup.PathToString(p) == pin {
+					return true
+				}
+			}
+			return false
+		}
+		if !pinned() {
+			t.Fatalf("Expected the pinned path after connecting, got %v", client.GetCurrentPathset().Paths)
+		}
+		for i := 0; i < 10; i++ {
+			client.updateMetrics()
+			_, err := sel.UpdatePathSelection()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !pinned() {
+				t.Fatalf("Expected the pinned path after update %d, got %v", i, client.GetCurrentPathset().Paths)
+			}
+		}
+	})
+
+	t.Run("Missing Pinned Path Fails", func(t *testing.T) {
+		client, err := NewPanSock("1-ff00:0:110,[127.0.0.1]:41301", peer, &PanSocketOptions{Transport: "SCION"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = client.Listen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Disconnect()
+
+		paths, err := client.GetAvailablePaths()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pathset := pathselection.WrapPathset(paths[:1])
+		pathset.Address = *peer
+		err = client.Connect(&pathset, &socket.ConnectOptions{
+			PinnedPaths: []string{"[1-ff00:0:110 4>1 1-ff00:0:113]"},
+			PinPolicy:   pathselection.PinFail,
+		})
+		if !errors.Is(err, pathselection.ErrPinnedPathMissing) {
+			t.Errorf("Expected ErrPinnedPathMissing, got %v", err)
+		}
+	})
+}
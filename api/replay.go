@@ -0,0 +1,251 @@
+package smp
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/netsys-lab/scion-path-discovery/pathselection"
+	"github.com/netsys-lab/scion-path-discovery/socket"
+	"github.com/netsys-lab/scion-path-discovery/trace"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// Returned by the conns of a replayed socket, which do not send or receive
+var ErrReplay = errors.New("replayed socket does not send or receive")
+
+// Implemented by underlay sockets that add and remove conns without
+// a control channel to the remote, e.g. the underlay of a replay
+type pathManager interface {
+	AddPath(path snet.Path) (packets.UDPConn, error)
+	RemovePath(conn packets.UDPConn) error
+}
+
+//
+// Returns a PanSocket that replays a trace recorded via PanSocketOptions.Recorder.
+// Path lookups return the recorded paths and ReplayTick sets the metrics of its
+// conns from the recorded ticks, so that selections using the socket make the
+// same decisions as during the recording. Conns are opened and moved like on a
+// connected socket, but do not send or receive. The replayed lookups, ticks and
+// decisions are recorded in memory, available via Options.Recorder.Trace()
+//
+func NewReplaySocket(t *trace.Trace) (*PanSocket, error) {
+	peer, err := snet.ParseUDPAddr(t.Remote())
+	if err != nil {
+		return nil, err
+	}
+
+	underlay := &replaySocket{
+		local:   &snet.UDPAddr{Host: &net.UDPAddr{}},
+		remote:  peer,
+		session: socket.NewPeerSession(nil, peer),
+		conns:   make([]*replayConn, 0),
+	}
+	return &PanSocket{
+		Peer:              peer,
+		UnderlaySocket:    underlay,
+		PathQualityDB:     pathselection.NewInMemoryPathQualityDatabase(),
+		Options:           &PanSocketOptions{Recorder: trace.NewRecorder(nil)},
+		MetricsInterval:   1000 * time.Millisecond,
+		OnNewConnReceived: make(chan packets.UDPConn, 16),
+		replay:            trace.NewReplay(t),
+	}, nil
+}
+
+//
+// Applies the next metrics tick of the replayed trace to the conns, selections
+// using the socket are updated afterwards like after each metrics interval.
+// Conns over paths missing in the tick get a sample without traffic.
+// Returns false at the end of the trace or if the socket is not replayed
+//
+func (mp *PanSocket) ReplayTick() bool {
+	underlay, ok := mp.UnderlaySocket.(*replaySocket)
+	if mp.replay == nil || !ok {
+		return false
+	}
+	e, ok := mp.replay.NextTick()
+	if !ok {
+		return false
+	}
+	underlay.apply(e)
+	mp.recordMetrics()
+	return true
+}
+
+// Underlay of a replayed trace, its conns only carry metrics
+type replaySocket struct {
+	local   *snet.UDPAddr
+	remote  *snet.UDPAddr
+	session *socket.PeerSession
+	conns   []*replayConn
+}
+
+// Matches the samples of a tick to the conns by their path
+func (s *replaySocket) apply(e trace.Event) {
+	used := make([]bool, len(e.Conns))
+	for _, c := range s.conns {
+		fp := lookup.Fingerprint(c.path)
+		m := c.GetMetrics()
+		sample := trace.ConnMetrics{ReadBytes: m.ReadBytes, WrittenBytes: m.WrittenBytes}
+		for i, cm := range e.Conns {
+			if !used[i] && cm.Fingerprint == fp {
+				used[i] = true
+				sample = cm
+				break
+			}
+		}
+		sample.Apply(m)
+	}
+}
+
+func (s *replaySocket) Listen() error {
+	return nil
+}
+
+func (s *replaySocket) Local() *snet.UDPAddr {
+	return s.local
+}
+
+func (s *replaySocket) AggregateMetrics() *packets.PathMetrics {
+	metrics := make([]*packets.PathMetrics, len(s.conns))
+	for i, c := range s.conns {
+		metrics[i] = c.GetMetrics()
+	}
+	return socket.AggregateMetrics(metrics)
+}
+
+func (s *replaySocket) WaitForDialIn() (*snet.UDPAddr, error) {
+	return nil, ErrReplay
+}
+
+func (s *replaySocket) Accept() (*socket.PeerSession, error) {
+	return nil, ErrReplay
+}
+
+func (s *replaySocket) WaitForIncomingConn(snet.UDPAddr) (packets.UDPConn, error) {
+	return nil, ErrReplay
+}
+
+func (s *replaySocket) DialAll(remote snet.UDPAddr, paths []pathselection.PathQuality, options socket.DialOptions) ([]packets.UDPConn, error) {
+	for _, p := range paths {
+		s.conns = append(s.conns, newReplayConn(s.local, &remote, p.SnetPath))
+	}
+	return s.GetConnections(), nil
+}
+
+func (s *replaySocket) AddPath(path snet.Path) (packets.UDPConn, error) {
+	conn := newReplayConn(s.local, s.remote, path)
+	s.conns = append(s.conns, conn)
+	return conn, nil
+}
+
+func (s *replaySocket) RemovePath(conn packets.UDPConn) error {
+	for i, c := range s.conns {
+		if c == conn {
+			s.conns = append(s.conns[:i], s.conns[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("conn is not part of this session")
+}
+
+func (s *replaySocket) CloseAll() []error {
+	s.conns = make([]*replayConn, 0)
+	return nil
+}
+
+func (s *replaySocket) GetConnections() []packets.UDPConn {
+	conns := make([]packets.UDPConn, len(s.conns))
+	for i, c := range s.conns {
+		conns[i] = c
+	}
+	return conns
+}
+
+func (s *replaySocket) GetSession() *socket.PeerSession {
+	return s.session
+}
+
+func (s *replaySocket) SetKeepalive(socket.KeepaliveOptions) {}
+
+func (s *replaySocket) SetReadReportInterval(time.Duration) {}
+
+// Conn of a replayed socket. Like the conns of the transports, it keeps
+// separate metrics per path, which are restored when moving back to a path
+type replayConn struct {
+	packets.BasicConn
+	local   *snet.UDPAddr
+	remote  *snet.UDPAddr
+	path    snet.Path
+	metrics map[lookup.PathFingerprint]*packets.PathMetrics
+}
+
+func newReplayConn(local, remote *snet.UDPAddr, path snet.Path) *replayConn {
+	c := &replayConn{
+		local:   local,
+		remote:  remote,
+		metrics: make(map[lookup.PathFingerprint]*packets.PathMetrics),
+	}
+	c.SetState(packets.ConnectionStates.Open)
+	c.SetPath(&path)
+	return c
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	return 0, ErrReplay
+}
+
+func (c *replayConn) Write(b []byte) (int, error) {
+	return 0, ErrReplay
+}
+
+func (c *replayConn) Close() error {
+	c.SetState(packets.ConnectionStates.Closed)
+	return nil
+}
+
+func (c *replayConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *replayConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *replayConn) SetDeadline(time.Time) error {
+	return nil
+}
+
+func (c *replayConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (c *replayConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (c *replayConn) GetMetrics() *packets.PathMetrics {
+	return c.metrics[lookup.Fingerprint(c.path)]
+}
+
+func (c *replayConn) GetPath() *snet.Path {
+	return &c.path
+}
+
+func (c *replayConn) SetPath(path *snet.Path) error {
+	c.path = *path
+	fp := lookup.Fingerprint(c.path)
+	if _, ok := c.metrics[fp]; !ok {
+		m := packets.NewPathMetrics(time.Second)
+		p := c.path
+		m.Path = &p
+		c.metrics[fp] = m
+	}
+	return nil
+}
+
+func (c *replayConn) GetRemote() *snet.UDPAddr {
+	return c.remote
+}
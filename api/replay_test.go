@@ -0,0 +1,183 @@
+package smp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/emulator"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/netsys-lab/scion-path-discovery/pathselection"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
+	"github.com/netsys-lab/scion-path-discovery/socket"
+	"github.com/netsys-lab/scion-path-discovery/trace"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+	"inet.af/netaddr"
+)
+
+// Client in 1-ff00:0:110 and server in 1-ff00:0:113,
+// connected via three ASes in between
+func newEmulatedNetwork(t *testing.T) *emulator.Network {
+	ias := make(map[string]addr.IA)
+	for _, s := range []string{"1-ff00:0:110", "1-ff00:0:111", "1-ff00:0:112", "1-ff00:0:113", "1-ff00:0:114"} {
+		ia, err := addr.IAFromString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ias[s] = ia
+	}
+
+	n := emulator.NewNetwork(ias["1-ff00:0:110"], 1)
+	n.AddHost(ias["1-ff00:0:110"], netaddr.IPv4(127, 0, 0, 1))
+	n.AddHost(ias["1-ff00:0:113"], netaddr.IPv4(127, 0, 0, 2))
+	props := emulator.LinkProperties{Bandwidth: 100000000, Latency: time.Millisecond}
+	links := []struct {
+		a, b     string
+		aIf, bIf common.IFIDType
+	}{
+		{"1-ff00:0:110", "1-ff00:0:111", 1, 1},
+		{"1-ff00:0:110", "1-ff00:0:112", 2, 1},
+		{"1-ff00:0:110", "1-ff00:0:114", 3, 1},
+		{"1-ff00:0:111", "1-ff00:0:113", 2, 1},
+		{"1-ff00:0:112", "1-ff00:0:113", 2, 2},
+		{"1-ff00:0:114", "1-ff00:0:113", 2, 3},
+	}
+	for _, l := range links {
+		_, err := n.AddLink(ias[l.a], l.aIf, ias[l.b], l.bIf, props)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return n
+}
+
+func fingerprints(paths []trace.Path) []string {
+	fps := make([]string, len(paths))
+	for i, p := range paths {
+		fps[i] = string(p.Fingerprint)
+	}
+	return fps
+}
+
+func Test_Replay(t *testing.T) {
+	network := newEmulatedNetwork(t)
+	scionhost.SetNetwork(network)
+	defer scionhost.SetNetwork(nil)
+	defer network.Close()
+
+	t.Run("Replay Reproduces Decisions", func(t *testing.T) {
+		server, err := NewPanSock("1-ff00:0:113,[127.0.0.2]:41000", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = server.Listen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Disconnect()
+		accepted := make(chan error, 1)
+		go func() {
+			_, err := server.WaitForPeerConnect(nil)
+			accepted <- err
+		}()
+
+		peer, err := snet.ParseUDPAddr("1-ff00:0:113,[127.0.0.2]:41000")
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := trace.NewRecorder(nil)
+		client, err := NewPanSock("1-ff00:0:110,[127.0.0.1]:41100", peer, &PanSocketOptions{
+			Transport: "SCION",
+			Recorder:  recorder,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = client.Listen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Disconnect()
+
+		sel := NewDisjointPathSelectionSocket(client, 2, 1)
+		pathset, err := sel.InitialPathset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pathset.Address = *peer
+		err = client.Connect(&pathset, &socket.ConnectOptions{SendAddrPacket: true, NoMetricsCollection: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = <-accepted
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Writes vary per tick and conn, so that pathsets differ in bandwidth
+		for i := 0; i < 15; i++ {
+			for j, c := range client.UnderlaySocket.GetConnections() {
+				for k := 0; k < (i*j)%4+1; k++ {
+					c.Write(make([]byte, 1000))
+				}
+			}
+			client.updateMetrics()
+			_, err := sel.UpdatePathSelection()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		recorded := recorder.Trace()
+		if len(recorded.Decisions()) < 2 || len(recorded.Ticks()) != 15 {
+			t.Fatalf("Expected an initial and an explored pathset, got %d decisions and %d ticks",
+				len(recorded.Decisions()), len(recorded.Ticks()))
+		}
+
+		replayed, err := NewReplaySocket(recorded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replaySel := NewDisjointPathSelectionSocket(replayed, 2, 1)
+		pathset, err = replaySel.InitialPathset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pathset.Address = *replayed.Peer
+		err = replayed.Connect(&pathset, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for replayed.ReplayTick() {
+			_, err := replaySel.UpdatePathSelection()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected, got := recorded.Decisions(), replayed.Options.Recorder.Trace().Decisions()
+		if len(got) != len(expected) {
+			t.Fatalf("Expected %d decisions, got %d", len(expected), len(got))
+		}
+		for i := range expected {
+			e, g := fingerprints(expected[i].Paths), fingerprints(got[i].Paths)
+			if expected[i].Tick != got[i].Tick || len(e) != len(g) {
+				t.Errorf("Expected decision %v at tick %d, got %v at tick %d", e, expected[i].Tick, g, got[i].Tick)
+				continue
+			}
+			for j := range e {
+				if e[j] != g[j] {
+					t.Errorf("Expected decision %v at tick %d, got %v", e, expected[i].Tick, g)
+					break
+				}
+			}
+		}
+
+		current := pathselection.UnwrapPathset(replayed.GetCurrentPathset())
+		last := expected[len(expected)-1].Paths
+		if len(current) != len(last) || lookup.Fingerprint(current[0]) != last[0].Fingerprint {
+			t.Errorf("Expected the replayed socket to use the last pathset %v", fingerprints(last))
+		}
+	})
+}
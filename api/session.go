@@ -0,0 +1,162 @@
+package smp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/congestion"
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/netsys-lab/scion-path-discovery/pathselection"
+	"github.com/netsys-lab/scion-path-discovery/socket"
+	"github.com/scionproto/scion/go/lib/snet"
+	log "github.com/sirupsen/logrus"
+)
+
+// PanSession represents a single remote peer accepted by a listening PanSocket.
+// It holds the connections to this peer, their metrics and the peer's
+// PathQualityDB entry
+type PanSession struct {
+	Peer              *snet.UDPAddr
+	Session           *socket.PeerSession
+	PathQualityDB     pathselection.PathQualityDatabase
+	MetricsInterval   time.Duration
+	metrics           metricsCollector
+	coupling          *congestion.CoupledGroup
+	OnNewConnReceived chan packets.UDPConn
+	closeOnce         sync.Once
+}
+
+func newPanSession(session *socket.PeerSession, metricsInterval time.Duration, coupling *congestion.CoupledGroup,
+	lookupOpts *lookup.LookupOptions) *PanSession {
+	ps := &PanSession{
+		Peer:              session.Remote,
+		Session:           session,
+		PathQualityDB:     newPathQualityDB(lookupOpts),
+		MetricsInterval:   metricsInterval,
+		coupling:          coupling,
+		OnNewConnReceived: make(chan packets.UDPConn, 16),
+	}
+	session.SetConnCallbacks(ps.onConnAdded, ps.onConnRemoved)
+	session.SetClosedCallback(ps.onClosed)
+	return ps
+}
+
+func (ps *PanSession) onConnAdded(conn packets.UDPConn) {
+	ps.PathQualityDB.SetConnections(ps.GetConnections())
+	ps.updateCoupling()
+	select {
+	case ps.OnNewConnReceived <- conn:
+	default:
+		log.Warn("[PanSession] OnNewConnReceived is full, dropping notification for ", conn.GetRemote().String())
+	}
+}
+
+func (ps *PanSession) onConnRemoved(conn packets.UDPConn) {
+	ps.PathQualityDB.SetConnections(ps.GetConnections())
+	ps.updateCoupling()
+}
+
+// Invoked when the session was closed locally or by the peer,
+// only the first close cleans up
+func (ps *PanSession) onClosed() {
+	ps.closeOnce.Do(func() {
+		ps.metrics.stop()
+		ps.PathQualityDB.SetConnections(ps.GetConnections())
+		ps.PathQualityDB.RemovePathSet(ps.Peer)
+	})
+}
+
+//
+// Waits for the next remote PanSocket that connects to this socket's local address
+// and returns a session holding all connections to this peer.
+// The listener stays open, so Accept may be called in a loop to serve many peers,
+// handshakes of different peers are processed concurrently
+//
+func (mp *PanSocket) Accept() (*PanSession, error) {
+	log.Debugf("[PanSocket] Accepting next peer")
+	session, err := mp.UnderlaySocket.Accept()
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("[PanSocket] Accepted peer %s", session.Remote.String())
+
+	ps := newPanSession(session, mp.MetricsInterval, mp.coupling, mp.Options.Lookup)
+	ps.PathQualityDB.UpdatePathQualities(ps.Peer, 1*time.Second)
+	ps.PathQualityDB.SetConnections(session.GetConnections())
+	ps.updateCoupling()
+	ps.collectMetrics()
+	return ps, nil
+}
+
+func (ps *PanSession) GetConnections() []packets.UDPConn {
+	return ps.Session.GetConnections()
+}
+
+func (ps *PanSession) GetMetrics() []*packets.PathMetrics {
+	return ps.Session.GetMetrics()
+}
+
+func (ps *PanSession) AggregateMetrics() *packets.PathMetrics {
+	return ps.Session.AggregateMetrics()
+}
+
+func (ps *PanSession) AverageReadBandwidth() int64 {
+	return ps.AggregateMetrics().AverageReadBandwidth()
+}
+
+func (ps *PanSession) AverageWriteBandwidth() int64 {
+	return ps.AggregateMetrics().AverageWriteBandwidth()
+}
+
+// Returns the sum of the bandwidth the peer received on all connections,
+// as reported by the peer. False if the peer does not send reports
+func (ps *PanSession) Goodput() (int64, bool) {
+	return goodput(ps.GetConnections())
+}
+
+func (ps *PanSession) GetCurrentPathset() pathselection.PathSet {
+	paths := make([]snet.Path, 0)
+	for _, c := range ps.GetConnections() {
+		paths = append(paths, *c.GetPath())
+	}
+
+	return pathselection.WrapPathset(paths)
+}
+
+func (ps *PanSession) collectMetrics() {
+	ps.metrics.start(ps.MetricsInterval, ps.PathQualityDB.UpdateMetrics)
+}
+
+// Runs the passed selection on the paths to the peer and sends
+// over the selected paths on each connection (server-side path selection)
+func (ps *PanSession) ApplyReplySelection(selection pathselection.CustomPathSelection) error {
+	err := applyReplySelection(ps.PathQualityDB, ps.Peer, ps.GetConnections(), selection)
+	ps.updateCoupling()
+	return err
+}
+
+// Opens an additional connection over the passed path to the peer
+func (ps *PanSession) AddPath(path snet.Path) (packets.UDPConn, error) {
+	conn, err := ps.Session.AddPath(path)
+	if err != nil {
+		return nil, err
+	}
+	ps.PathQualityDB.SetConnections(ps.GetConnections())
+	ps.updateCoupling()
+	return conn, nil
+}
+
+// Closes the passed connection on both sides, without affecting the others
+func (ps *PanSession) RemovePath(conn packets.UDPConn) error {
+	err := ps.Session.RemovePath(conn)
+	ps.PathQualityDB.SetConnections(ps.GetConnections())
+	ps.updateCoupling()
+	return err
+}
+
+// Closes all connections to the peer gracefully, the listening PanSocket stays open.
+// Metrics and the PathQualityDB entry are cleaned up by the closed callback
+func (ps *PanSession) Disconnect() []error {
+	return ps.Session.CloseAll()
+}
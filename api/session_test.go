@@ -0,0 +1,114 @@
+package smp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/pathselection"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
+	"github.com/netsys-lab/scion-path-discovery/socket"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+func Test_PanSession(t *testing.T) {
+	network := newEmulatedNetwork(t)
+	scionhost.SetNetwork(network)
+	defer scionhost.SetNetwork(nil)
+	defer network.Close()
+
+	t.Run("Paths Change While Metrics Are Collected", func(t *testing.T) {
+		server, err := NewPanSock("1-ff00:0:113,[127.0.0.2]:42000", nil, &PanSocketOptions{Transport: "SCION"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.MetricsInterval = time.Millisecond
+		err = server.Listen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Disconnect()
+		sessions := make(chan *PanSession, 1)
+		go func() {
+			session, err := server.Accept()
+			if err != nil {
+				t.Error(err)
+			}
+			sessions <- session
+		}()
+
+		peer, err := snet.ParseUDPAddr("1-ff00:0:113,[127.0.0.2]:42000")
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := NewPanSock("1-ff00:0:110,[127.0.0.1]:42100", peer, &PanSocketOptions{Transport: "SCION"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.MetricsInterval = time.Millisecond
+		err = client.Listen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Disconnect()
+
+		paths, err := client.GetAvailablePaths()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != 3 {
+			t.Fatalf("Expected 3 paths, got %d", len(paths))
+		}
+		pathset := pathselection.WrapPathset(paths[:1])
+		pathset.Address = *peer
+		err = client.Connect(&pathset, &socket.ConnectOptions{SendAddrPacket: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		session := <-sessions
+		if session == nil {
+			return
+		}
+
+		// Reads the path qualities of both sides while they are updated
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				client.PathQualityDB.GetPathSet(peer)
+				session.PathQualityDB.GetPathSet(session.Peer)
+			}
+		}()
+
+		for i := 0; i < 10; i++ {
+			for _, p := range paths[1:] {
+				conn, err := client.AddPath(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(2 * time.Millisecond)
+				err = client.RemovePath(conn)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		close(stop)
+		<-done
+
+		if conns := client.UnderlaySocket.GetConnections(); len(conns) != 1 {
+			t.Fatalf("Expected 1 conn after removing the added ones, got %d", len(conns))
+		}
+		for i := 0; i < 100 && len(session.GetConnections()) != 1; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if conns := session.GetConnections(); len(conns) != 1 {
+			t.Fatalf("Expected the peer to keep 1 conn, got %d", len(conns))
+		}
+	})
+}
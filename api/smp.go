@@ -1,18 +1,49 @@
 package smp
 
 import (
+	"errors"
+	"sync"
 	"time"
 
+	"github.com/netsys-lab/scion-path-discovery/congestion"
 	"github.com/netsys-lab/scion-path-discovery/packets"
 	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
 	"github.com/netsys-lab/scion-path-discovery/pathselection"
 	"github.com/netsys-lab/scion-path-discovery/socket"
+	"github.com/netsys-lab/scion-path-discovery/trace"
 	"github.com/scionproto/scion/go/lib/snet"
 	log "github.com/sirupsen/logrus"
 )
 
 type PanSocketOptions struct {
-	Transport string // "QUIC" | "SCION"
+	Transport string // "QUIC" | "QUIC-DATAGRAM" | "SCION"
+	// Optional liveness detection, the state of each conn is available via GetState.
+	// Only supported by the SCION transport, Listen fails for the QUIC transports
+	Keepalive socket.KeepaliveOptions
+	// TLS identity, peer authentication and ALPN of the QUIC transports.
+	// Defaults to a self-signed certificate without verifying peers
+	TLS *socket.TLSOptions
+	// Optional reliable, congestion-controlled delivery of messages on the
+	// "SCION" transport. Both peers have to enable it
+	Reliable *socket.ReliableOptions
+	// Couples the congestion windows of conns over paths that share
+	// interfaces with the passed algorithm. Enables the reliable message
+	// layer of the "SCION" transport, other transports are not affected
+	Coupling congestion.CouplingAlgorithm
+	// Interval in which the bandwidth received per path is reported to
+	// the remote, which uses it to evaluate pathsets. 0 disables the reports
+	ReadReportInterval time.Duration
+	// Records the path lookups, metrics ticks and pathset decisions of
+	// the socket and of the selections using it, nil disables recording
+	Recorder *trace.Recorder
+	// Paths that are always part of the active set, as fingerprints or hop
+	// strings, see lookup.ParsePath. They are resolved again after each lookup
+	PinnedPaths []string
+	// What happens if a pinned path is not available, defaults to PinFail
+	PinPolicy pathselection.PinPolicy
+	// Flags and filters of all path lookups of the socket, e.g. to include
+	// hidden paths or to use only direct links. nil uses the defaults
+	Lookup *lookup.LookupOptions
 }
 
 var defaultSocketOptions = &PanSocketOptions{
@@ -27,20 +58,27 @@ type PanSocket struct {
 	Mode              string
 	Options           *PanSocketOptions
 	MetricsInterval   time.Duration
-	metricsTicker     *time.Ticker
+	metrics           metricsCollector
+	coupling          *congestion.CoupledGroup
 	OnNewConnReceived chan packets.UDPConn
+	// Serves path lookups from a trace instead of the network
+	replay *trace.Replay
+	// Keeps the pinned paths in the active set, nil if none are pinned
+	pinner *pathselection.PathPinner
+	// Result of the latest successful lookup, pins are resolved against it
+	paths []snet.Path
 }
 
 //
 // Instantiates a new Multipath Peer Socket
-// peer argument may be omitted for a socket waiting for an incoming connections
+// peer argument may be omitted for a socket waiting for an incoming connections.
+// Returns an error if the TLS options of a QUIC transport are invalid
 //
-func NewPanSock(local string, peer *snet.UDPAddr, options *PanSocketOptions) *PanSocket {
+func NewPanSock(local string, peer *snet.UDPAddr, options *PanSocketOptions) (*PanSocket, error) {
 
 	sock := &PanSocket{
 		Peer:              peer,
 		Local:             local,
-		PathQualityDB:     pathselection.NewInMemoryPathQualityDatabase(),
 		Options:           defaultSocketOptions,
 		MetricsInterval:   1000 * time.Millisecond,
 		OnNewConnReceived: make(chan packets.UDPConn, 16),
@@ -49,17 +87,84 @@ func NewPanSock(local string, peer *snet.UDPAddr, options *PanSocketOptions) *Pa
 	if options != nil {
 		sock.Options = options
 	}
+	sock.PathQualityDB = newPathQualityDB(sock.Options.Lookup)
 
 	switch sock.Options.Transport {
 	case "QUIC":
-		sock.UnderlaySocket = socket.NewQUICSocket(local)
+		quicSock := socket.NewQUICSocket(local)
+		if sock.Options.TLS != nil {
+			err := quicSock.SetTLSOptions(sock.Options.TLS)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sock.UnderlaySocket = quicSock
+		break
+	case "QUIC-DATAGRAM":
+		quicSock := socket.NewQUICDatagramSocket(local)
+		if sock.Options.TLS != nil {
+			err := quicSock.SetTLSOptions(sock.Options.TLS)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sock.UnderlaySocket = quicSock
 		break
 	case "SCION":
-		sock.UnderlaySocket = socket.NewSCIONSocket(local)
+		scionSock := socket.NewSCIONSocket(local)
+		reliable := sock.Options.Reliable
+		if sock.Options.Coupling != "" {
+			sock.coupling = congestion.NewCoupledGroup(sock.Options.Coupling)
+			opts := socket.ReliableOptions{}
+			if reliable != nil {
+				opts = *reliable
+			}
+			opts.Congestion = sock.coupling.NewController
+			reliable = &opts
+		}
+		scionSock.SetReliability(reliable)
+		sock.UnderlaySocket = scionSock
 		break
 	}
 
-	return sock
+	sock.UnderlaySocket.SetKeepalive(sock.Options.Keepalive)
+	sock.UnderlaySocket.SetReadReportInterval(sock.Options.ReadReportInterval)
+	sock.UnderlaySocket.GetSession().SetConnCallbacks(sock.onConnAdded, sock.onConnRemoved)
+	sock.UnderlaySocket.GetSession().SetClosedCallback(sock.onClosed)
+
+	return sock, nil
+}
+
+// Path quality DB whose lookups use the lookup options of the socket
+func newPathQualityDB(opts *lookup.LookupOptions) *pathselection.InMemoryPathQualityDatabase {
+	db := pathselection.NewInMemoryPathQualityDatabase()
+	db.LookupOptions = opts
+	return db
+}
+
+// Connections added by the remote are passed to the application via OnNewConnReceived
+func (mp *PanSocket) onConnAdded(conn packets.UDPConn) {
+	mp.PathQualityDB.SetConnections(mp.UnderlaySocket.GetConnections())
+	mp.updateCoupling()
+	select {
+	case mp.OnNewConnReceived <- conn:
+	default:
+		log.Warn("[PanSocket] OnNewConnReceived is full, dropping notification for ", conn.GetRemote().String())
+	}
+}
+
+func (mp *PanSocket) onConnRemoved(conn packets.UDPConn) {
+	mp.PathQualityDB.SetConnections(mp.UnderlaySocket.GetConnections())
+	mp.updateCoupling()
+}
+
+// Invoked when the session was closed locally or by the remote
+func (mp *PanSocket) onClosed() {
+	mp.metrics.stop()
+	mp.PathQualityDB.SetConnections(mp.UnderlaySocket.GetConnections())
+	if mp.Peer != nil {
+		mp.PathQualityDB.RemovePathSet(mp.Peer)
+	}
 }
 
 func (mp *PanSocket) GetMetrics() []*packets.PathMetrics {
@@ -74,6 +179,30 @@ func (mp *PanSocket) AverageWriteBandwidth() int64 {
 	return mp.AggregateMetrics().AverageWriteBandwidth()
 }
 
+//
+// Returns the sum of the bandwidth the remote received on all connections,
+// as reported by the remote. False if the remote does not send reports
+//
+func (mp *PanSocket) Goodput() (int64, bool) {
+	return goodput(mp.UnderlaySocket.GetConnections())
+}
+
+func goodput(conns []packets.UDPConn) (int64, bool) {
+	var sum int64
+	reported := false
+	for _, c := range conns {
+		m := c.GetMetrics()
+		if ac, ok := c.(packets.AsymmetricConn); ok {
+			m = ac.GetReplyMetrics()
+		}
+		if bw, ok := m.PeerGoodput(); ok {
+			sum += bw
+			reported = true
+		}
+	}
+	return sum, reported
+}
+
 func (mp *PanSocket) AggregateMetrics() *packets.PathMetrics {
 	return mp.UnderlaySocket.AggregateMetrics()
 }
@@ -108,13 +237,12 @@ func (mp *PanSocket) Listen() error {
 //
 // This method waits until a remote MPPeerSock calls connect to this
 // socket's local address
-// A pathselection may be passed, which lets the socket dialing back to its remote
-// (e.g. for server-side path selection)
-// Since the MPPeerSock waits for only one incoming connection to determine a new peer
-// it starts waiting for other connections (if no selection passed) and fires the
-// OnConnectionsChange event for each new incoming connection
+// A pathselection may be passed, which lets the socket choose the paths for
+// its outgoing direction (server-side path selection). Replies on each connection
+// are then sent over the selected paths, while the remote keeps its own paths.
+// Passing nil means that the remote performs the path selection for both directions
 //
-func (mp *PanSocket) WaitForPeerConnect() (*snet.UDPAddr, error) {
+func (mp *PanSocket) WaitForPeerConnect(selection pathselection.CustomPathSelection) (*snet.UDPAddr, error) {
 	log.Debugf("[PanSocket] Waiting for incoming connection")
 	remote, err := mp.UnderlaySocket.WaitForDialIn()
 	if err != nil {
@@ -128,28 +256,203 @@ func (mp *PanSocket) WaitForPeerConnect() (*snet.UDPAddr, error) {
 	conns := mp.UnderlaySocket.GetConnections()
 	mp.PathQualityDB.SetConnections(conns)
 
+	if selection != nil {
+		err = applyReplySelection(mp.PathQualityDB, remote, conns, selection)
+		if err != nil {
+			return remote, err
+		}
+	}
+	mp.updateCoupling()
+
 	return remote, err
 }
 
+// Runs the passed selection on the paths to remote and binds the
+// outgoing direction of each accepted conn to one of the selected paths
+func applyReplySelection(db pathselection.PathQualityDatabase, remote *snet.UDPAddr, conns []packets.UDPConn, selection pathselection.CustomPathSelection) error {
+	pathSet, err := db.GetPathSet(remote)
+	if err != nil {
+		return err
+	}
+
+	selected, err := selection.CustomPathSelectAlg(&pathSet)
+	if err != nil {
+		return err
+	}
+
+	if len(selected.Paths) == 0 {
+		return errors.New("server-side path selection returned no paths")
+	}
+
+	for i, c := range conns {
+		ac, ok := c.(packets.AsymmetricConn)
+		if !ok {
+			return errors.New("transport does not support server-side path selection")
+		}
+		path := selected.Paths[i%len(selected.Paths)].SnetPath
+		err := ac.SetReplyPath(&path)
+		if err != nil {
+			return err
+		}
+		log.Debugf("[PanSocket] Reply path for conn %d to %s: %s", i, remote.String(), lookup.PathToString(path))
+	}
+
+	return nil
+}
+
+// Metrics of a replayed socket are ticked by ReplayTick
 func (mp *PanSocket) collectMetrics() {
-	mp.metricsTicker = time.NewTicker(mp.MetricsInterval)
-	go func() {
+	if mp.replay != nil {
+		return
+	}
+	mp.metrics.start(mp.MetricsInterval, mp.updateMetrics)
+}
+
+func (mp *PanSocket) updateMetrics() {
+	mp.PathQualityDB.UpdateMetrics()
+	mp.recordMetrics()
+}
+
+// Records the latest metrics of all conns if a Recorder is set
+func (mp *PanSocket) recordMetrics() {
+	if rec := mp.Options.Recorder; rec != nil {
+		metrics := make([]*packets.PathMetrics, 0)
+		for _, c := range mp.UnderlaySocket.GetConnections() {
+			metrics = append(metrics, c.GetMetrics())
+		}
+		rec.RecordMetrics(mp.Peer, metrics)
+	}
+}
+
+// Records the pathset chosen by a selection if a Recorder is set
+func (mp *PanSocket) recordDecision(selection string, paths []snet.Path) {
+	if rec := mp.Options.Recorder; rec != nil {
+		rec.RecordDecision(selection, mp.Peer, paths)
+	}
+}
+
+// Periodically calls tick, e.g. to update the metrics of a PathQualityDatabase, until stopped
+type metricsCollector struct {
+	mutex  sync.Mutex
+	ticker *time.Ticker
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+func (mc *metricsCollector) start(interval time.Duration, tick func()) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	if mc.ticker != nil {
+		return
+	}
+	mc.ticker = time.NewTicker(interval)
+	mc.stopCh = make(chan struct{})
+	mc.doneCh = make(chan struct{})
+	go func(ticker *time.Ticker, stopCh, doneCh chan struct{}) {
+		defer close(doneCh)
 		for {
 			select {
-			case <-mp.metricsTicker.C:
-				mp.PathQualityDB.UpdateMetrics()
-				break
-				// case <-mp.metricsChan:
-				// 	return
+			case <-ticker.C:
+				tick()
+			case <-stopCh:
+				return
 			}
 		}
+	}(mc.ticker, mc.stopCh, mc.doneCh)
+}
 
-	}()
-
+// Stops the collection and waits for a running update to finish,
+// does nothing if metrics were never collected
+func (mc *metricsCollector) stop() {
+	mc.mutex.Lock()
+	if mc.ticker == nil {
+		mc.mutex.Unlock()
+		return
+	}
+	mc.ticker.Stop()
+	close(mc.stopCh)
+	doneCh := mc.doneCh
+	mc.ticker = nil
+	mc.mutex.Unlock()
+	<-doneCh
 }
 
 func (mp *PanSocket) GetAvailablePaths() ([]snet.Path, error) {
-	return lookup.PathLookup(mp.Peer.String())
+	return mp.lookupPaths()
+}
+
+// Looks up the paths to the peer, or takes them from the replayed
+// trace. Lookups are recorded if a Recorder is set
+func (mp *PanSocket) lookupPaths() ([]snet.Path, error) {
+	var paths []snet.Path
+	var err error
+	if mp.replay != nil {
+		paths, err = mp.replay.Lookup()
+	} else {
+		paths, err = lookup.PathLookupWithOptions(mp.Peer.String(), mp.Options.Lookup)
+	}
+	if rec := mp.Options.Recorder; rec != nil {
+		rec.RecordLookup(mp.Peer.String(), paths, err)
+	}
+	if err == nil {
+		mp.paths = paths
+	}
+	return paths, err
+}
+
+// Sets up the pinned paths of the options, falling back to the socket options
+func (mp *PanSocket) setPins(options *socket.ConnectOptions) error {
+	pins, policy := mp.Options.PinnedPaths, mp.Options.PinPolicy
+	if options != nil && len(options.PinnedPaths) > 0 {
+		pins, policy = options.PinnedPaths, options.PinPolicy
+	}
+	if len(pins) == 0 {
+		mp.pinner = nil
+		return nil
+	}
+	pinner, err := pathselection.NewPathPinner(pins, policy)
+	if err != nil {
+		return err
+	}
+	mp.pinner = pinner
+	return nil
+}
+
+// Adds the pinned paths to paths, resolved against the latest lookup
+func (mp *PanSocket) pinPaths(paths []snet.Path) ([]snet.Path, error) {
+	if mp.pinner == nil {
+		return paths, nil
+	}
+	available := mp.paths
+	if available == nil {
+		var err error
+		available, err = mp.lookupPaths()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mp.pinner.Apply(paths, available)
+}
+
+// Adds the pinned paths to a pathset, the qualities of selected paths are kept
+func (mp *PanSocket) pinPathset(ps *pathselection.PathSet) (*pathselection.PathSet, error) {
+	if mp.pinner == nil {
+		return ps, nil
+	}
+	paths, err := mp.pinPaths(pathselection.UnwrapPathset(*ps))
+	if err != nil {
+		return nil, err
+	}
+	pinned := &pathselection.PathSet{Address: ps.Address, Paths: make([]pathselection.PathQuality, len(paths))}
+	for i, p := range paths {
+		fp := lookup.Fingerprint(p)
+		if j := pathselection.FindIndexByFingerprint(ps.Paths, fp); j >= 0 {
+			pinned.Paths[i] = ps.Paths[j]
+			continue
+		}
+		pinned.Paths[i] = pathselection.PathQuality{SnetPath: p, Id: string(fp)}
+	}
+	return pinned, nil
 }
 
 //
@@ -167,6 +470,14 @@ func (mp *PanSocket) DialAll(pathAlternatives *pathselection.PathSet, options *s
 	if options != nil {
 		opts.SendAddrPacket = options.SendAddrPacket
 	}
+	err := mp.setPins(options)
+	if err != nil {
+		return err
+	}
+	pathAlternatives, err = mp.pinPathset(pathAlternatives)
+	if err != nil {
+		return err
+	}
 	conns, err := mp.UnderlaySocket.DialAll(*mp.Peer, pathAlternatives.Paths, opts)
 	if err != nil {
 		return err
@@ -175,7 +486,11 @@ func (mp *PanSocket) DialAll(pathAlternatives *pathselection.PathSet, options *s
 	log.Debugf("[PanSocket] Dialed all to %s, got %d connections", mp.Peer.String(), len(conns))
 
 	mp.PathQualityDB.SetConnections(conns)
-	mp.PathQualityDB.UpdatePathQualities(&pathAlternatives.Address, 1*time.Second)
+	// A replayed socket has no network to look up the path qualities in
+	if mp.replay == nil {
+		mp.PathQualityDB.UpdatePathQualities(&pathAlternatives.Address, 1*time.Second)
+	}
+	mp.updateCoupling()
 	return nil
 }
 
@@ -202,8 +517,49 @@ func (mp *PanSocket) Connect(pathAlternatives *pathselection.PathSet, options *s
 	return nil
 }
 
+//
+// Opens an additional connection over the passed path to the connected peer.
+// All other connections stay untouched, the remote socket is informed via
+// the control channel and announces the new connection via OnNewConnReceived
+//
+func (mp *PanSocket) AddPath(path snet.Path) (packets.UDPConn, error) {
+	var conn packets.UDPConn
+	var err error
+	if pm, ok := mp.UnderlaySocket.(pathManager); ok {
+		conn, err = pm.AddPath(path)
+	} else {
+		conn, err = mp.UnderlaySocket.GetSession().AddPath(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	mp.PathQualityDB.SetConnections(mp.UnderlaySocket.GetConnections())
+	mp.updateCoupling()
+	return conn, nil
+}
+
+//
+// Closes the passed connection on both sides, without affecting the others
+//
+func (mp *PanSocket) RemovePath(conn packets.UDPConn) error {
+	var err error
+	if pm, ok := mp.UnderlaySocket.(pathManager); ok {
+		err = pm.RemovePath(conn)
+	} else {
+		err = mp.UnderlaySocket.GetSession().RemovePath(conn)
+	}
+	mp.PathQualityDB.SetConnections(mp.UnderlaySocket.GetConnections())
+	mp.updateCoupling()
+	return err
+}
+
+//
+// Closes all connections gracefully, the remote is notified and its
+// reads return packets.ErrPeerClosed. Metrics collection is stopped and the
+// metrics and path qualities of the closed connections are removed
+//
 func (mp *PanSocket) Disconnect() []error {
 	errs := mp.UnderlaySocket.CloseAll()
-	mp.metricsTicker.Stop()
+	mp.onClosed()
 	return errs
 }
@@ -0,0 +1,103 @@
+package congestion
+
+import "time"
+
+const (
+	bbrMinWindow     = 4
+	bbrCwndGain      = 2
+	bbrBwSamples     = 10
+	bbrMinRTTWindow  = 10 * time.Second
+	bbrStartupGrowth = 1.25
+	bbrStartupRounds = 3
+)
+
+// BBR is a simplified model-based controller: It estimates the bottleneck
+// bandwidth as maximum delivery rate of the recent RTTs and the propagation
+// delay as minimum RTT, and keeps twice their product in flight. Losses
+// alone do not reduce the window. Pacing and probing phases of the full
+// algorithm are omitted
+type BBR struct {
+	cwnd          float64
+	startup       bool
+	fullBw        float64
+	fullBwRounds  int
+	bwSamples     []float64
+	btlBw         float64
+	minRTT        time.Duration
+	minRTTStamp   time.Time
+	delivered     int
+	intervalStart time.Time
+	now           func() time.Time
+}
+
+func NewBBR() Controller {
+	return &BBR{
+		cwnd:      InitialWindow,
+		startup:   true,
+		bwSamples: make([]float64, 0, bbrBwSamples),
+		now:       time.Now,
+	}
+}
+
+func (b *BBR) Window() int {
+	return int(b.cwnd)
+}
+
+func (b *BBR) OnAck(acked int, rtt time.Duration) {
+	now := b.now()
+	if rtt > 0 && (b.minRTT == 0 || rtt < b.minRTT || now.Sub(b.minRTTStamp) > bbrMinRTTWindow) {
+		b.minRTT = rtt
+		b.minRTTStamp = now
+	}
+
+	// One delivery rate sample per min RTT
+	b.delivered += acked
+	if b.intervalStart.IsZero() {
+		b.intervalStart = now
+	}
+	elapsed := now.Sub(b.intervalStart)
+	if b.minRTT > 0 && elapsed >= b.minRTT {
+		b.addSample(float64(b.delivered) / elapsed.Seconds())
+		b.delivered = 0
+		b.intervalStart = now
+	}
+
+	if b.startup {
+		b.cwnd += float64(acked)
+		return
+	}
+	bdp := b.btlBw * b.minRTT.Seconds()
+	b.cwnd = max(bbrCwndGain*bdp, bbrMinWindow)
+}
+
+func (b *BBR) addSample(rate float64) {
+	if len(b.bwSamples) == bbrBwSamples {
+		b.bwSamples = b.bwSamples[1:]
+	}
+	b.bwSamples = append(b.bwSamples, rate)
+	b.btlBw = 0
+	for _, s := range b.bwSamples {
+		b.btlBw = max(b.btlBw, s)
+	}
+
+	// Startup ends once the bandwidth stopped growing for some rounds
+	if !b.startup {
+		return
+	}
+	if b.btlBw >= b.fullBw*bbrStartupGrowth {
+		b.fullBw = b.btlBw
+		b.fullBwRounds = 0
+		return
+	}
+	b.fullBwRounds++
+	if b.fullBwRounds >= bbrStartupRounds {
+		b.startup = false
+	}
+}
+
+func (b *BBR) OnLoss() {
+}
+
+func (b *BBR) OnTimeout() {
+	b.cwnd = bbrMinWindow
+}
@@ -0,0 +1,43 @@
+// Package congestion contains congestion controllers for the reliable
+// message layer over raw SCION connections. Windows are counted in packets,
+// since all packets of the layer have at most packets.PACKET_SIZE bytes
+package congestion
+
+import "time"
+
+const (
+	// Window of a new connection
+	InitialWindow = 10
+	// Lower bound of the window after losses
+	MinWindow = 2
+)
+
+// Controller decides how many packets may be in flight on one path.
+// Its methods are called sequentially by the connection using it
+type Controller interface {
+	// Current congestion window in packets
+	Window() int
+	// Called for newly acknowledged packets with the latest
+	// RTT sample, rtt is 0 if only retransmitted packets were acked
+	OnAck(acked int, rtt time.Duration)
+	// Called at most once per window in which packets were lost
+	OnLoss()
+	// Called when the retransmission timer expired
+	OnTimeout()
+}
+
+// Constructor creates the controller for a new connection
+type Constructor func() Controller
+
+// Implemented by controllers that share state with others,
+// called once the connection using the controller is closed
+type Releaser interface {
+	Release()
+}
+
+func max(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
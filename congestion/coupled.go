@@ -0,0 +1,265 @@
+package congestion
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CouplingAlgorithm determines how the windows of coupled subflows grow
+// and shrink. All of them behave like Reno for a subflow that is not
+// coupled to any other one
+type CouplingAlgorithm string
+
+const (
+	// Linked Increases Algorithm, RFC 6356
+	LIA CouplingAlgorithm = "LIA"
+	// Opportunistic Linked Increases Algorithm, Khalili et al., 2013
+	OLIA CouplingAlgorithm = "OLIA"
+	// Balanced Linked Adaptation, Peng et al., 2016
+	BALIA CouplingAlgorithm = "BALIA"
+)
+
+// Assumed for subflows without RTT sample
+const defaultRTT = 100 * time.Millisecond
+
+// CoupledGroup holds the subflows of one multipath connection.
+// Each subflow is coupled to the subflows that may share a bottleneck
+// with it, see Couple, and adapts its window to the windows and RTTs
+// of these subflows, so that all of them together take no more
+// capacity of a shared link than a single flow
+type CoupledGroup struct {
+	mutex     sync.Mutex
+	algorithm CouplingAlgorithm
+	subflows  map[*Subflow]struct{}
+}
+
+func NewCoupledGroup(algorithm CouplingAlgorithm) *CoupledGroup {
+	switch algorithm {
+	case LIA, OLIA, BALIA:
+	default:
+		logrus.Warn("[Congestion] Unknown coupling algorithm ", algorithm, ", using ", LIA)
+		algorithm = LIA
+	}
+	return &CoupledGroup{
+		algorithm: algorithm,
+		subflows:  make(map[*Subflow]struct{}),
+	}
+}
+
+// NewController adds a new, uncoupled subflow to the group.
+// It is a Constructor, e.g. for socket.ReliableOptions
+func (g *CoupledGroup) NewController() Controller {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	sf := &Subflow{
+		group:    g,
+		cwnd:     InitialWindow,
+		ssthresh: math.MaxFloat64,
+		coupled:  make(map[*Subflow]struct{}),
+	}
+	g.subflows[sf] = struct{}{}
+	return sf
+}
+
+// Couple sets whether a and b share a bottleneck
+func (g *CoupledGroup) Couple(a, b *Subflow, coupled bool) {
+	if a == b || a.group != g || b.group != g {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if coupled {
+		a.coupled[b] = struct{}{}
+		b.coupled[a] = struct{}{}
+		return
+	}
+	delete(a.coupled, b)
+	delete(b.coupled, a)
+}
+
+// Number of subflows currently in the group
+func (g *CoupledGroup) Len() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return len(g.subflows)
+}
+
+// Subflow is the Controller of one path of a CoupledGroup
+type Subflow struct {
+	group    *CoupledGroup
+	cwnd     float64
+	ssthresh float64
+	srtt     time.Duration
+	coupled  map[*Subflow]struct{}
+	// Packets acked since the last loss and between the last two losses,
+	// OLIA uses them to find the paths with the best throughput
+	sinceLoss     float64
+	betweenLosses float64
+}
+
+// The subflow itself and all subflows coupled to it
+func (s *Subflow) set() []*Subflow {
+	set := make([]*Subflow, 0, len(s.coupled)+1)
+	set = append(set, s)
+	for sf := range s.coupled {
+		set = append(set, sf)
+	}
+	return set
+}
+
+func (s *Subflow) rtt() float64 {
+	if s.srtt == 0 {
+		return defaultRTT.Seconds()
+	}
+	return s.srtt.Seconds()
+}
+
+// Sending rate in packets per second
+func (s *Subflow) rate() float64 {
+	return s.cwnd / s.rtt()
+}
+
+func (s *Subflow) Window() int {
+	s.group.mutex.Lock()
+	defer s.group.mutex.Unlock()
+	return int(s.cwnd)
+}
+
+func (s *Subflow) OnAck(acked int, rtt time.Duration) {
+	s.group.mutex.Lock()
+	defer s.group.mutex.Unlock()
+
+	if rtt > 0 {
+		if s.srtt == 0 {
+			s.srtt = rtt
+		} else {
+			s.srtt = (7*s.srtt + rtt) / 8
+		}
+	}
+	s.sinceLoss += float64(acked)
+
+	if s.cwnd < s.ssthresh {
+		s.cwnd += float64(acked)
+		return
+	}
+
+	var increase float64
+	switch s.group.algorithm {
+	case OLIA:
+		increase = s.oliaIncrease()
+	case BALIA:
+		increase = s.baliaIncrease()
+	default:
+		increase = s.liaIncrease()
+	}
+	s.cwnd = max(s.cwnd+float64(acked)*increase, MinWindow)
+}
+
+// Increase per acked packet, min(alpha / total window, 1 / window)
+func (s *Subflow) liaIncrease() float64 {
+	var total, maxTerm, sumRates float64
+	for _, sf := range s.set() {
+		total += sf.cwnd
+		maxTerm = max(maxTerm, sf.cwnd/(sf.rtt()*sf.rtt()))
+		sumRates += sf.rate()
+	}
+	alpha := total * maxTerm / (sumRates * sumRates)
+	return math.Min(alpha/total, 1/s.cwnd)
+}
+
+// Increase per acked packet, (w/rtt^2) / (sum of rates)^2 + alpha / w.
+// Alpha shifts traffic from the paths with the largest windows to the
+// paths with the best throughput that do not have the largest window yet
+func (s *Subflow) oliaIncrease() float64 {
+	set := s.set()
+	var sumRates, maxWindow, maxQuality float64
+	quality := func(sf *Subflow) float64 {
+		l := max(sf.sinceLoss, sf.betweenLosses)
+		return l * l / sf.rtt()
+	}
+	for _, sf := range set {
+		sumRates += sf.rate()
+		maxWindow = max(maxWindow, sf.cwnd)
+		maxQuality = max(maxQuality, quality(sf))
+	}
+
+	numMax, numCollected := 0, 0
+	isMax := func(sf *Subflow) bool { return sf.cwnd == maxWindow }
+	isCollected := func(sf *Subflow) bool { return quality(sf) == maxQuality && !isMax(sf) }
+	for _, sf := range set {
+		if isMax(sf) {
+			numMax++
+		}
+		if isCollected(sf) {
+			numCollected++
+		}
+	}
+
+	alpha := 0.0
+	if numCollected > 0 {
+		n := float64(len(set))
+		if isCollected(s) {
+			alpha = 1 / (n * float64(numCollected))
+		} else if isMax(s) {
+			alpha = -1 / (n * float64(numMax))
+		}
+	}
+	return (s.cwnd/(s.rtt()*s.rtt()))/(sumRates*sumRates) + alpha/s.cwnd
+}
+
+// Ratio of the highest rate of the set to the own rate
+func (s *Subflow) baliaAlpha() float64 {
+	maxRate := 0.0
+	for _, sf := range s.set() {
+		maxRate = max(maxRate, sf.rate())
+	}
+	return maxRate / s.rate()
+}
+
+// Increase per acked packet, (x/rtt) / (sum of rates)^2 * (1+a)/2 * (4+a)/5
+func (s *Subflow) baliaIncrease() float64 {
+	sumRates := 0.0
+	for _, sf := range s.set() {
+		sumRates += sf.rate()
+	}
+	alpha := s.baliaAlpha()
+	return (s.rate() / s.rtt()) / (sumRates * sumRates) * ((1 + alpha) / 2) * ((4 + alpha) / 5)
+}
+
+func (s *Subflow) OnLoss() {
+	s.group.mutex.Lock()
+	defer s.group.mutex.Unlock()
+
+	s.betweenLosses = s.sinceLoss
+	s.sinceLoss = 0
+	if s.group.algorithm == BALIA {
+		s.cwnd = max(s.cwnd-s.cwnd/2*math.Min(s.baliaAlpha(), 1.5), MinWindow)
+	} else {
+		s.cwnd = max(s.cwnd/2, MinWindow)
+	}
+	s.ssthresh = s.cwnd
+}
+
+func (s *Subflow) OnTimeout() {
+	s.group.mutex.Lock()
+	defer s.group.mutex.Unlock()
+
+	s.betweenLosses = s.sinceLoss
+	s.sinceLoss = 0
+	s.ssthresh = max(s.cwnd/2, MinWindow)
+	s.cwnd = MinWindow
+}
+
+// Release removes the subflow from its group
+func (s *Subflow) Release() {
+	s.group.mutex.Lock()
+	defer s.group.mutex.Unlock()
+	for sf := range s.coupled {
+		delete(sf.coupled, s)
+	}
+	s.coupled = make(map[*Subflow]struct{})
+	delete(s.group.subflows, s)
+}
@@ -0,0 +1,162 @@
+package congestion
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// Window, RTT and packets acked since the last loss of a subflow
+type subflowState struct {
+	cwnd      float64
+	rtt       time.Duration
+	sinceLoss float64
+}
+
+// Returns coupled subflows in congestion avoidance with the passed states
+func coupledSubflows(algorithm CouplingAlgorithm, states ...subflowState) []*Subflow {
+	g := NewCoupledGroup(algorithm)
+	subflows := make([]*Subflow, len(states))
+	for i, st := range states {
+		sf := g.NewController().(*Subflow)
+		sf.cwnd, sf.srtt, sf.sinceLoss = st.cwnd, st.rtt, st.sinceLoss
+		sf.ssthresh = 0
+		subflows[i] = sf
+		for _, other := range subflows[:i] {
+			g.Couple(sf, other, true)
+		}
+	}
+	return subflows
+}
+
+func expectWindow(t *testing.T, sf *Subflow, expected float64) {
+	t.Helper()
+	if math.Abs(sf.cwnd-expected) > 1e-9 {
+		t.Errorf("Expected window %v, got %v", expected, sf.cwnd)
+	}
+}
+
+func Test_CoupledGroup(t *testing.T) {
+	ms100 := 100 * time.Millisecond
+
+	t.Run("Window Increase", func(t *testing.T) {
+		cases := []struct {
+			name      string
+			algorithm CouplingAlgorithm
+			subflows  []subflowState
+			// Index of the subflow that receives one ack
+			acked    int
+			expected float64
+		}{
+			// A single subflow increases by 1/cwnd like Reno
+			{"LIA Uncoupled", LIA, []subflowState{{20, ms100, 0}}, 0, 20 + 1.0/20},
+			{"OLIA Uncoupled", OLIA, []subflowState{{20, ms100, 0}}, 0, 20 + 1.0/20},
+			{"BALIA Uncoupled", BALIA, []subflowState{{20, ms100, 0}}, 0, 20 + 1.0/20},
+			// alpha = 20 * 1000 / 200^2 = 0.5, increase alpha / 20
+			{"LIA Equal Paths", LIA, []subflowState{{10, ms100, 0}, {10, ms100, 0}}, 0, 10 + 0.5/20},
+			// alpha = 20 * 1000 / 150^2, the faster path determines the aggressiveness
+			{"LIA Different RTTs", LIA, []subflowState{{10, ms100, 0}, {10, 2 * ms100, 0}}, 1, 10 + 20*1000/(150.0*150)/20},
+			// alpha / total exceeds 1 / cwnd of the large window
+			{"LIA Capped By Reno", LIA, []subflowState{{2, 10 * time.Millisecond, 0}, {1000, time.Second, 0}}, 1, 1000 + 1.0/1000},
+			// (10 / 0.01) / 200^2 without alpha, both windows are maximal
+			{"OLIA Equal Paths", OLIA, []subflowState{{10, ms100, 0}, {10, ms100, 0}}, 0, 10 + 1000/40000.0},
+			// The second path has the best quality but not the largest window, alpha = 1/2
+			{"OLIA Collected Path", OLIA, []subflowState{{20, ms100, 10}, {10, ms100, 100}}, 1, 10 + 1000/90000.0 + 0.5/10},
+			// The largest window shrinks by alpha = -1/2
+			{"OLIA Largest Window", OLIA, []subflowState{{20, ms100, 10}, {10, ms100, 100}}, 0, 20 + 2000/90000.0 - 0.5/20},
+			// (100 / 0.1) / 200^2 with alpha = 1
+			{"BALIA Equal Paths", BALIA, []subflowState{{10, ms100, 0}, {10, ms100, 0}}, 0, 10 + 1000/40000.0},
+			// alpha = 100 / 50 = 2 for the slower path
+			{"BALIA Slower Path", BALIA, []subflowState{{10, ms100, 0}, {5, ms100, 0}}, 1, 5 + 500/22500.0*1.5*1.2},
+			{"BALIA Faster Path", BALIA, []subflowState{{10, ms100, 0}, {5, ms100, 0}}, 0, 10 + 1000/22500.0},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				subflows := coupledSubflows(c.algorithm, c.subflows...)
+				subflows[c.acked].OnAck(1, 0)
+				expectWindow(t, subflows[c.acked], c.expected)
+			})
+		}
+	})
+
+	t.Run("Slow Start", func(t *testing.T) {
+		for _, algorithm := range []CouplingAlgorithm{LIA, OLIA, BALIA} {
+			subflows := coupledSubflows(algorithm, subflowState{10, 0, 0}, subflowState{10, ms100, 0})
+			subflows[0].ssthresh = math.MaxFloat64
+			subflows[0].OnAck(5, 50*time.Millisecond)
+			expectWindow(t, subflows[0], 15)
+			if subflows[0].srtt != 50*time.Millisecond {
+				t.Errorf("Expected the first RTT sample as srtt, got %s", subflows[0].srtt)
+			}
+		}
+	})
+
+	t.Run("Window Decrease", func(t *testing.T) {
+		cases := []struct {
+			name      string
+			algorithm CouplingAlgorithm
+			timeout   bool
+			expected  []float64
+		}{
+			{"LIA Loss", LIA, false, []float64{40, 20}},
+			{"OLIA Loss", OLIA, false, []float64{40, 20}},
+			// The slower path has alpha = 2, capped at 1.5
+			{"BALIA Loss", BALIA, false, []float64{40, 40 - 40.0/2*1.5}},
+			{"Timeout", LIA, true, []float64{MinWindow, MinWindow}},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				decrease := func(sf *Subflow) {
+					if c.timeout {
+						sf.OnTimeout()
+					} else {
+						sf.OnLoss()
+					}
+				}
+				// Each subflow is decreased in a fresh group, so that the windows of
+				// the others are unchanged. The last group is the one of the first
+				// subflow, whose counters are checked afterwards
+				var subflows []*Subflow
+				for i := len(c.expected) - 1; i >= 0; i-- {
+					subflows = coupledSubflows(c.algorithm, subflowState{80, ms100, 30}, subflowState{40, ms100, 0})
+					decrease(subflows[i])
+					expectWindow(t, subflows[i], c.expected[i])
+				}
+				if subflows[0].sinceLoss != 0 || subflows[0].betweenLosses != 30 {
+					t.Errorf("Expected the acked packets to move to betweenLosses, got %v and %v",
+						subflows[0].sinceLoss, subflows[0].betweenLosses)
+				}
+				if c.timeout && subflows[0].ssthresh != 40 {
+					t.Errorf("Expected half the window as ssthresh after a timeout, got %v", subflows[0].ssthresh)
+				}
+			})
+		}
+	})
+
+	t.Run("Coupling", func(t *testing.T) {
+		subflows := coupledSubflows(LIA, subflowState{10, ms100, 0}, subflowState{10, ms100, 0})
+		a, b := subflows[0], subflows[1]
+		other := NewCoupledGroup(LIA).NewController().(*Subflow)
+		a.group.Couple(a, a, true)
+		a.group.Couple(a, other, true)
+		if len(a.coupled) != 1 || len(other.coupled) != 0 {
+			t.Errorf("Expected no coupling with itself or subflows of other groups")
+		}
+
+		a.group.Couple(a, b, false)
+		a.OnAck(1, 0)
+		expectWindow(t, a, 10+1.0/10)
+
+		a.group.Couple(a, b, true)
+		b.Release()
+		if len(a.coupled) != 0 || a.group.Len() != 1 {
+			t.Errorf("Expected the released subflow to leave the group")
+		}
+	})
+
+	t.Run("Unknown Algorithm", func(t *testing.T) {
+		if g := NewCoupledGroup("CUBIC"); g.algorithm != LIA {
+			t.Errorf("Expected LIA for an unknown algorithm, got %s", g.algorithm)
+		}
+	})
+}
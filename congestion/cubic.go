@@ -0,0 +1,88 @@
+package congestion
+
+import (
+	"math"
+	"time"
+)
+
+// Constants of RFC 8312
+const (
+	cubicC    = 0.4
+	cubicBeta = 0.7
+)
+
+// Cubic grows the window along a cubic function of the time since the
+// last loss, which recovers faster than Reno on paths with a large BDP
+type Cubic struct {
+	cwnd       float64
+	ssthresh   float64
+	wMax       float64
+	lastWMax   float64
+	k          float64
+	wEst       float64
+	epochStart time.Time
+	now        func() time.Time
+}
+
+func NewCubic() Controller {
+	return &Cubic{
+		cwnd:     InitialWindow,
+		ssthresh: math.MaxFloat64,
+		now:      time.Now,
+	}
+}
+
+func (c *Cubic) Window() int {
+	return int(c.cwnd)
+}
+
+func (c *Cubic) OnAck(acked int, rtt time.Duration) {
+	if c.cwnd < c.ssthresh {
+		c.cwnd += float64(acked)
+		return
+	}
+
+	now := c.now()
+	if c.epochStart.IsZero() {
+		c.epochStart = now
+		c.wEst = c.cwnd
+		if c.cwnd < c.wMax {
+			c.k = math.Cbrt((c.wMax - c.cwnd) / cubicC)
+		} else {
+			c.k = 0
+			c.wMax = c.cwnd
+		}
+	}
+
+	t := now.Sub(c.epochStart).Seconds() + rtt.Seconds()
+	target := cubicC*math.Pow(t-c.k, 3) + c.wMax
+	if target > c.cwnd {
+		c.cwnd += (target - c.cwnd) / c.cwnd * float64(acked)
+	} else {
+		c.cwnd += 0.01 * float64(acked) / c.cwnd
+	}
+
+	// Stay at least as aggressive as Reno
+	c.wEst += 3 * (1 - cubicBeta) / (1 + cubicBeta) * float64(acked) / c.cwnd
+	if c.wEst > c.cwnd {
+		c.cwnd = c.wEst
+	}
+}
+
+func (c *Cubic) OnLoss() {
+	c.epochStart = time.Time{}
+	// Fast convergence, release bandwidth for new flows
+	if c.cwnd < c.lastWMax {
+		c.wMax = c.cwnd * (1 + cubicBeta) / 2
+	} else {
+		c.wMax = c.cwnd
+	}
+	c.lastWMax = c.wMax
+	c.cwnd = max(c.cwnd*cubicBeta, MinWindow)
+	c.ssthresh = c.cwnd
+}
+
+func (c *Cubic) OnTimeout() {
+	c.OnLoss()
+	c.cwnd = MinWindow
+}
@@ -0,0 +1,41 @@
+package congestion
+
+import (
+	"math"
+	"time"
+)
+
+// Reno grows the window by one packet per RTT and halves it on loss
+type Reno struct {
+	cwnd     float64
+	ssthresh float64
+}
+
+func NewReno() Controller {
+	return &Reno{
+		cwnd:     InitialWindow,
+		ssthresh: math.MaxFloat64,
+	}
+}
+
+func (r *Reno) Window() int {
+	return int(r.cwnd)
+}
+
+func (r *Reno) OnAck(acked int, rtt time.Duration) {
+	if r.cwnd < r.ssthresh {
+		r.cwnd += float64(acked)
+		return
+	}
+	r.cwnd += float64(acked) / r.cwnd
+}
+
+func (r *Reno) OnLoss() {
+	r.ssthresh = max(r.cwnd/2, MinWindow)
+	r.cwnd = r.ssthresh
+}
+
+func (r *Reno) OnTimeout() {
+	r.ssthresh = max(r.cwnd/2, MinWindow)
+	r.cwnd = MinWindow
+}
@@ -0,0 +1,464 @@
+package emulator
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/scionproto/scion/go/lib/addr"
+	"inet.af/netaddr"
+)
+
+var errBadDstAddress = errors.New("dst address not a UDPAddr")
+
+type packet struct {
+	data []byte
+	src  pan.UDPAddr
+	dst  pan.UDPAddr
+	// Path from the receiver back to the sender, nil within an AS
+	path    *pan.Path
+	arrival time.Time
+	// Orders packets arriving at the same time by sending order
+	seq uint64
+}
+
+type packetHeap []*packet
+
+func (h packetHeap) Len() int { return len(h) }
+
+func (h packetHeap) Less(i, j int) bool {
+	if !h[i].arrival.Equal(h[j].arrival) {
+		return h[i].arrival.Before(h[j].arrival)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h packetHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *packetHeap) Push(x interface{}) { *h = append(*h, x.(*packet)) }
+
+func (h *packetHeap) Pop() interface{} {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
+
+// Delivers packets in the order of their arrival time
+type scheduler struct {
+	network  *Network
+	mutex    sync.Mutex
+	packets  packetHeap
+	seq      uint64
+	wake     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newScheduler(n *Network) *scheduler {
+	return &scheduler{
+		network: n,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+func (s *scheduler) schedule(p *packet) {
+	s.mutex.Lock()
+	p.seq = s.seq
+	s.seq++
+	heap.Push(&s.packets, p)
+	s.mutex.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) run() {
+	for {
+		s.mutex.Lock()
+		now := time.Now()
+		due := make([]*packet, 0)
+		for len(s.packets) > 0 && !s.packets[0].arrival.After(now) {
+			due = append(due, heap.Pop(&s.packets).(*packet))
+		}
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if len(s.packets) > 0 {
+			timer = time.NewTimer(s.packets[0].arrival.Sub(now))
+			timeout = timer.C
+		}
+		s.mutex.Unlock()
+
+		for _, p := range due {
+			s.network.deliver(p)
+		}
+
+		select {
+		case <-s.wake:
+		case <-timeout:
+		case <-s.done:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+	}
+}
+
+func (s *scheduler) stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// Hands p to the conn bound to its destination, packets to
+// unbound addresses or to conns with a full queue are dropped
+func (n *Network) deliver(p *packet) {
+	n.mutex.Lock()
+	e := n.endpoints[keyOf(p.dst)]
+	n.mutex.Unlock()
+	if e == nil {
+		return
+	}
+	select {
+	case e.queue <- p:
+	default:
+	}
+}
+
+type endpointKey struct {
+	ia   addr.IA
+	ip   netaddr.IP
+	port uint16
+}
+
+func keyOf(a pan.UDPAddr) endpointKey {
+	return endpointKey{ia: addr.IA(a.IA), ip: a.IP, port: a.Port}
+}
+
+// endpoint is the part shared by dialed and listening conns
+type endpoint struct {
+	network   *Network
+	local     pan.UDPAddr
+	queue     chan *packet
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mutex           sync.Mutex
+	readDeadline    time.Time
+	deadlineChanged chan struct{}
+}
+
+// Returns the IP of conns bound to an unspecified IP, which is the
+// smallest IP added to the Local AS. n.mutex has to be held
+func (n *Network) defaultIP() netaddr.IP {
+	ips := make([]netaddr.IP, 0)
+	for ip, ia := range n.hosts {
+		if ia == n.Local {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return netaddr.IPv4(127, 0, 0, 1)
+	}
+	sort.Slice(ips, func(i, j int) bool { return ips[i].Less(ips[j]) })
+	return ips[0]
+}
+
+// Binds a new endpoint to local, an unspecified IP
+// or port is chosen like the dispatcher would
+func (n *Network) bind(local netaddr.IPPort) (*endpoint, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	ip := local.IP()
+	if ip.IsZero() || ip.IsUnspecified() {
+		ip = n.defaultIP()
+	}
+	key := endpointKey{ia: n.hostIA(ip), ip: ip, port: local.Port()}
+	if key.port == 0 {
+		for {
+			key.port = n.nextPort
+			n.nextPort++
+			if n.nextPort == 0 {
+				n.nextPort = firstEphemeralPort
+			}
+			if _, ok := n.endpoints[key]; !ok {
+				break
+			}
+		}
+	}
+	if _, ok := n.endpoints[key]; ok {
+		return nil, fmt.Errorf("%w: %s,%s:%d", ErrAddressInUse, key.ia, key.ip, key.port)
+	}
+
+	e := &endpoint{
+		network:         n,
+		local:           pan.UDPAddr{IA: pan.IA(key.ia), IP: key.ip, Port: key.port},
+		queue:           make(chan *packet, receiveQueueSize),
+		closed:          make(chan struct{}),
+		deadlineChanged: make(chan struct{}),
+	}
+	n.endpoints[key] = e
+	return e, nil
+}
+
+func (e *endpoint) read(b []byte) (int, *packet, error) {
+	for {
+		e.mutex.Lock()
+		deadline, changed := e.readDeadline, e.deadlineChanged
+		e.mutex.Unlock()
+
+		select {
+		case <-e.closed:
+			return 0, nil, net.ErrClosed
+		default:
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+
+		select {
+		case p := <-e.queue:
+			if timer != nil {
+				timer.Stop()
+			}
+			return copy(b, p.data), p, nil
+		case <-e.closed:
+			if timer != nil {
+				timer.Stop()
+			}
+			return 0, nil, net.ErrClosed
+		case <-timeout:
+			return 0, nil, os.ErrDeadlineExceeded
+		case <-changed:
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+	}
+}
+
+func (e *endpoint) write(dst pan.UDPAddr, path *pan.Path, b []byte) (int, error) {
+	select {
+	case <-e.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	err := e.network.send(e.local, dst, path, b)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (e *endpoint) LocalAddr() net.Addr {
+	return e.local
+}
+
+func (e *endpoint) SetDeadline(t time.Time) error {
+	return e.SetReadDeadline(t)
+}
+
+func (e *endpoint) SetReadDeadline(t time.Time) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.readDeadline = t
+	close(e.deadlineChanged)
+	e.deadlineChanged = make(chan struct{})
+	return nil
+}
+
+// Writes never block, so the write deadline is ignored
+func (e *endpoint) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (e *endpoint) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.closed)
+		n := e.network
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+		if key := keyOf(e.local); n.endpoints[key] == e {
+			delete(n.endpoints, key)
+		}
+	})
+	return nil
+}
+
+// Paths from the AS of local to remote as filtered by policy
+func (n *Network) policyPaths(local, remote pan.IA, policy pan.Policy) []*pan.Path {
+	paths := n.panPaths(addr.IA(local), addr.IA(remote))
+	if policy != nil {
+		paths = policy.Filter(paths)
+	}
+	return paths
+}
+
+// ListenUDP opens a conn on local, like pan.ListenUDP does in a SCION network
+func (n *Network) ListenUDP(ctx context.Context, local netaddr.IPPort, selector pan.ReplySelector) (pan.ListenConn, error) {
+	e, err := n.bind(local)
+	if err != nil {
+		return nil, err
+	}
+	if selector == nil {
+		selector = pan.NewDefaultReplySelector()
+	}
+	selector.Initialize(e.local)
+	return &listenConn{endpoint: e, selector: selector}, nil
+}
+
+// DialUDP opens a conn from local to remote, like pan.DialUDP does in a SCION
+// network. The paths to remote are the ones returned by Paths
+func (n *Network) DialUDP(ctx context.Context, local netaddr.IPPort, remote pan.UDPAddr,
+	policy pan.Policy, selector pan.Selector) (pan.Conn, error) {
+	e, err := n.bind(local)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &dialedConn{endpoint: e, remote: remote}
+	if remote.IA != e.local.IA {
+		if selector == nil {
+			selector = pan.NewDefaultSelector()
+		}
+		paths := n.policyPaths(e.local.IA, remote.IA, policy)
+		if len(paths) == 0 {
+			e.Close()
+			return nil, fmt.Errorf("%w %s", ErrNoPath, remote.IA)
+		}
+		selector.Initialize(e.local, remote, paths)
+		c.selector = selector
+	}
+	return c, nil
+}
+
+type dialedConn struct {
+	*endpoint
+	remote   pan.UDPAddr
+	selector pan.Selector
+}
+
+var _ pan.Conn = (*dialedConn)(nil)
+
+func (c *dialedConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// Applies policy to the paths to the remote, the selector
+// is refreshed with the new paths
+func (c *dialedConn) SetPolicy(policy pan.Policy) {
+	if c.selector == nil {
+		return
+	}
+	c.selector.Refresh(c.network.policyPaths(c.local.IA, c.remote.IA, policy))
+}
+
+func (c *dialedConn) Write(b []byte) (int, error) {
+	var path *pan.Path
+	if c.selector != nil {
+		path = c.selector.Path()
+		if path == nil {
+			return 0, fmt.Errorf("%w %s", ErrNoPath, c.remote.IA)
+		}
+	}
+	return c.write(c.remote, path, b)
+}
+
+func (c *dialedConn) WriteVia(path *pan.Path, b []byte) (int, error) {
+	return c.write(c.remote, path, b)
+}
+
+// Packets from other sources than the remote are ignored, as in pan
+func (c *dialedConn) Read(b []byte) (int, error) {
+	n, _, err := c.ReadVia(b)
+	return n, err
+}
+
+func (c *dialedConn) ReadVia(b []byte) (int, *pan.Path, error) {
+	for {
+		n, p, err := c.read(b)
+		if err != nil {
+			return n, nil, err
+		}
+		if p.src != c.remote {
+			continue
+		}
+		return n, p.path, nil
+	}
+}
+
+func (c *dialedConn) Close() error {
+	if c.selector != nil {
+		c.selector.Close()
+	}
+	return c.endpoint.Close()
+}
+
+type listenConn struct {
+	*endpoint
+	selector pan.ReplySelector
+}
+
+var _ pan.ListenConn = (*listenConn)(nil)
+
+func (c *listenConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, remote, _, err := c.ReadFromVia(b)
+	return n, remote, err
+}
+
+func (c *listenConn) ReadFromVia(b []byte) (int, pan.UDPAddr, *pan.Path, error) {
+	n, p, err := c.read(b)
+	if err != nil {
+		return n, pan.UDPAddr{}, nil, err
+	}
+	c.selector.Record(p.src, p.path)
+	return n, p.src, p.path, nil
+}
+
+func (c *listenConn) WriteTo(b []byte, dst net.Addr) (int, error) {
+	sdst, ok := dst.(pan.UDPAddr)
+	if !ok {
+		return 0, errBadDstAddress
+	}
+	var path *pan.Path
+	if c.local.IA != sdst.IA {
+		path = c.selector.Path(sdst)
+		if path == nil {
+			return 0, fmt.Errorf("%w %s", ErrNoPath, sdst.IA)
+		}
+	}
+	return c.WriteToVia(b, sdst, path)
+}
+
+func (c *listenConn) WriteToVia(b []byte, dst pan.UDPAddr, path *pan.Path) (int, error) {
+	return c.write(dst, path, b)
+}
+
+func (c *listenConn) Close() error {
+	c.selector.Close()
+	return c.endpoint.Close()
+}
@@ -0,0 +1,567 @@
+// Package emulator provides an in-process SCION network to run sockets and
+// path selection against without a SCION daemon or dispatcher. ASes are
+// connected by links with configurable bandwidth, latency, loss and
+// interface IDs. The network serves paths like the SCION daemon and delivers
+// packets along the links of their path. Losses are drawn from a random source
+// seeded in NewNetwork, so a run is reproducible as long as the order in which
+// packets are sent is the same.
+//
+// A network is installed for all sockets and path lookups via
+// scionhost.SetNetwork(network)
+package emulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/slayers/path/scion"
+	"github.com/scionproto/scion/go/lib/snet"
+	snetpath "github.com/scionproto/scion/go/lib/snet/path"
+	"github.com/scionproto/scion/go/lib/spath"
+	"inet.af/netaddr"
+)
+
+var (
+	ErrNoPath          = errors.New("no path to destination")
+	ErrInvalidPath     = errors.New("path does not lead to destination")
+	ErrAddressInUse    = errors.New("address already in use")
+	ErrInterfaceInUse  = errors.New("interface already connected")
+	ErrInvalidEndpoint = errors.New("links must connect two different ASes")
+)
+
+const (
+	defaultMaxHops  = 6
+	defaultMaxPaths = 64
+	defaultMTU      = 1472
+	// Queueing delay of links without Queue
+	defaultQueue = 100 * time.Millisecond
+	// Expiry of paths announced by QueryPaths
+	pathLifetime = 6 * time.Hour
+	// Packets waiting to be read per conn, further packets are dropped
+	receiveQueueSize   = 4096
+	firstEphemeralPort = 40000
+)
+
+// LinkProperties apply to both directions of a link
+type LinkProperties struct {
+	// Bandwidth in bit/s, 0 is unlimited
+	Bandwidth int64
+	// One-way propagation delay
+	Latency time.Duration
+	// Probability in [0, 1] that a packet is dropped
+	Loss float64
+	// Maximum queueing delay, packets that would wait longer are dropped.
+	// 0 uses 100ms
+	Queue time.Duration
+	// Link type announced in the path metadata
+	LinkType snet.LinkType
+	// Paths over hidden links are only returned by lookups with
+	// scionhost.QueryOptions.Hidden, like paths of a hidden path group
+	Hidden bool
+}
+
+// Link connects the interfaces A and B of two ASes. Each direction
+// has its own queue, packets are transmitted one after another
+type Link struct {
+	A, B  snet.PathInterface
+	props LinkProperties
+	// MTU of links loaded from a topology, 0 if only the MTU of the network applies
+	mtu uint16
+	// Time until which each direction is busy sending queued packets,
+	// index 0 is A to B
+	busyUntil [2]time.Time
+	sent      [2]int64
+	dropped   [2]int64
+}
+
+// A link traversed in one direction, dir 0 is A to B
+type hop struct {
+	link *Link
+	dir  int
+}
+
+func (h hop) from() snet.PathInterface {
+	if h.dir == 0 {
+		return h.link.A
+	}
+	return h.link.B
+}
+
+func (h hop) to() snet.PathInterface {
+	if h.dir == 0 {
+		return h.link.B
+	}
+	return h.link.A
+}
+
+// Network is an emulated SCION network. Its exported fields
+// have to be set before conns are opened
+type Network struct {
+	// AS of paths returned by QueryPaths and of hosts not added via AddHost
+	Local addr.IA
+	// Maximum number of links of a path
+	MaxHops int
+	// Maximum number of paths returned by QueryPaths, shortest first
+	MaxPaths int
+	// MTU announced in the path metadata
+	MTU uint16
+
+	mutex      sync.Mutex
+	rand       *rand.Rand
+	links      []*Link
+	interfaces map[snet.PathInterface]*Link
+	hosts      map[netaddr.IP]addr.IA
+	endpoints  map[endpointKey]*endpoint
+	nextPort   uint16
+	pathCache  map[string]*pan.Path
+	scheduler  *scheduler
+	// Set for networks created from a topology, whose paths are built from
+	// segments. topologyLinks are the links of the topology in its order
+	topology      *Topology
+	topologyLinks []*Link
+}
+
+var _ scionhost.Network = (*Network)(nil)
+var _ scionhost.OptionsQuerier = (*Network)(nil)
+
+// NewNetwork creates an empty network, paths are looked up from local.
+// seed initializes the random source of packet losses
+func NewNetwork(local addr.IA, seed int64) *Network {
+	n := &Network{
+		Local:      local,
+		MaxHops:    defaultMaxHops,
+		MaxPaths:   defaultMaxPaths,
+		MTU:        defaultMTU,
+		rand:       rand.New(rand.NewSource(seed)),
+		interfaces: make(map[snet.PathInterface]*Link),
+		hosts:      make(map[netaddr.IP]addr.IA),
+		endpoints:  make(map[endpointKey]*endpoint),
+		nextPort:   firstEphemeralPort,
+		pathCache:  make(map[string]*pan.Path),
+	}
+	n.scheduler = newScheduler(n)
+	go n.scheduler.run()
+	return n
+}
+
+// Close closes all conns of the network and stops delivering packets
+func (n *Network) Close() error {
+	n.mutex.Lock()
+	endpoints := make([]*endpoint, 0, len(n.endpoints))
+	for _, e := range n.endpoints {
+		endpoints = append(endpoints, e)
+	}
+	n.mutex.Unlock()
+
+	for _, e := range endpoints {
+		e.Close()
+	}
+	n.scheduler.stop()
+	return nil
+}
+
+// AddLink connects interface aIf of AS a with interface bIf of AS b
+func (n *Network) AddLink(a addr.IA, aIf common.IFIDType, b addr.IA, bIf common.IFIDType, props LinkProperties) (*Link, error) {
+	if a == b {
+		return nil, ErrInvalidEndpoint
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	l := &Link{
+		A:     snet.PathInterface{IA: a, ID: aIf},
+		B:     snet.PathInterface{IA: b, ID: bIf},
+		props: props,
+	}
+	for _, i := range []snet.PathInterface{l.A, l.B} {
+		if _, ok := n.interfaces[i]; ok {
+			return nil, fmt.Errorf("%w: %s#%d", ErrInterfaceInUse, i.IA, i.ID)
+		}
+	}
+	n.interfaces[l.A] = l
+	n.interfaces[l.B] = l
+	n.links = append(n.links, l)
+	return l, nil
+}
+
+// Returns the link attached to interface ifID of ia, or nil
+func (n *Network) Link(ia addr.IA, ifID common.IFIDType) *Link {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.interfaces[snet.PathInterface{IA: ia, ID: ifID}]
+}
+
+// Changes the properties of l from now on, packets already
+// in transit are not affected
+func (n *Network) SetLinkProperties(l *Link, props LinkProperties) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	l.props = props
+	// Cached paths announce the old latency and bandwidth
+	n.pathCache = make(map[string]*pan.Path)
+}
+
+func (n *Network) LinkProperties(l *Link) LinkProperties {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return l.props
+}
+
+// Returns the number of packets sent and dropped in each
+// direction of l, index 0 is the direction from A to B
+func (n *Network) LinkStats(l *Link) (sent [2]int64, dropped [2]int64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return l.sent, l.dropped
+}
+
+// AddHost places the host with ip in AS ia. Conns bound to an ip
+// that was not added are in the Local AS
+func (n *Network) AddHost(ia addr.IA, ip netaddr.IP) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.hosts[ip] = ia
+}
+
+func (n *Network) hostIA(ip netaddr.IP) addr.IA {
+	if ia, ok := n.hosts[ip]; ok {
+		return ia
+	}
+	return n.Local
+}
+
+// Paths returns all paths from src to dst with at most MaxHops links and
+// without loops, ordered by the number of links and their interfaces.
+// As for the SCION daemon, the only path within an AS is the empty path
+func (n *Network) Paths(src, dst addr.IA) []snet.Path {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	routes := n.routes(src, dst)
+	paths := make([]snet.Path, len(routes))
+	for i, r := range routes {
+		paths[i] = snetPath(dst, r, n.MTU)
+	}
+	return paths
+}
+
+// QueryPaths returns the paths from the Local AS to dst, except hidden ones
+func (n *Network) QueryPaths(ctx context.Context, dst pan.IA) ([]snet.Path, error) {
+	return n.QueryPathsWithOptions(ctx, dst, scionhost.QueryOptions{})
+}
+
+// QueryPathsWithOptions returns the paths from the Local AS to dst, including
+// paths over hidden links if requested. Paths are always fresh
+func (n *Network) QueryPathsWithOptions(ctx context.Context, dst pan.IA, opts scionhost.QueryOptions) ([]snet.Path, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	paths := make([]snet.Path, 0)
+	for _, r := range n.routes(n.Local, addr.IA(dst)) {
+		if !opts.Hidden && isHidden(r) {
+			continue
+		}
+		paths = append(paths, snetPath(addr.IA(dst), r, n.MTU))
+	}
+	return paths, nil
+}
+
+func isHidden(route []hop) bool {
+	for _, h := range route {
+		if h.link.props.Hidden {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the routes from src to dst, shortest first. n.mutex has to be held
+func (n *Network) routes(src, dst addr.IA) [][]hop {
+	var routes [][]hop
+	if n.topology != nil {
+		routes = n.topology.routes(src, dst, n.topologyLinks)
+	} else {
+		routes = searchRoutes(src, dst, n.links, n.MaxHops)
+	}
+	return sortRoutes(routes, n.MaxPaths)
+}
+
+// Depth-first search for all loop-free routes over links
+func searchRoutes(src, dst addr.IA, links []*Link, maxHops int) [][]hop {
+	if src == dst {
+		return [][]hop{{}}
+	}
+	if maxHops <= 0 {
+		maxHops = defaultMaxHops
+	}
+
+	routes := make([][]hop, 0)
+	visited := map[addr.IA]bool{src: true}
+	current := make([]hop, 0, maxHops)
+	var search func(ia addr.IA)
+	search = func(ia addr.IA) {
+		if ia == dst {
+			routes = append(routes, append([]hop(nil), current...))
+			return
+		}
+		if len(current) == maxHops {
+			return
+		}
+		for _, l := range links {
+			var h hop
+			switch ia {
+			case l.A.IA:
+				h = hop{link: l, dir: 0}
+			case l.B.IA:
+				h = hop{link: l, dir: 1}
+			default:
+				continue
+			}
+			next := h.to().IA
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			current = append(current, h)
+			search(next)
+			current = current[:len(current)-1]
+			visited[next] = false
+		}
+	}
+	search(src)
+	return routes
+}
+
+// Sorts routes by their number of links and interfaces and
+// returns at most maxPaths of them, duplicates are removed
+func sortRoutes(routes [][]hop, maxPaths int) [][]hop {
+	keys := make([]string, 0, len(routes))
+	unique := make([][]hop, 0, len(routes))
+	seen := make(map[string]bool)
+	for _, r := range routes {
+		key := routeKey(r)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+		unique = append(unique, r)
+	}
+	sort.Sort(byLength{unique, keys})
+
+	if maxPaths <= 0 {
+		maxPaths = defaultMaxPaths
+	}
+	if len(unique) > maxPaths {
+		unique = unique[:maxPaths]
+	}
+	return unique
+}
+
+type byLength struct {
+	routes [][]hop
+	keys   []string
+}
+
+func (b byLength) Len() int { return len(b.routes) }
+
+func (b byLength) Less(i, j int) bool {
+	if len(b.routes[i]) != len(b.routes[j]) {
+		return len(b.routes[i]) < len(b.routes[j])
+	}
+	return b.keys[i] < b.keys[j]
+}
+
+func (b byLength) Swap(i, j int) {
+	b.routes[i], b.routes[j] = b.routes[j], b.routes[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+func interfacesOf(route []hop) []snet.PathInterface {
+	interfaces := make([]snet.PathInterface, 0, 2*len(route))
+	for _, h := range route {
+		interfaces = append(interfaces, h.from(), h.to())
+	}
+	return interfaces
+}
+
+// Identifies a route by its interfaces, it is also used as raw path
+func routeKey(route []hop) string {
+	parts := make([]string, 0, 2*len(route))
+	for _, i := range interfacesOf(route) {
+		parts = append(parts, fmt.Sprintf("%s#%d", i.IA, i.ID))
+	}
+	return strings.Join(parts, " ")
+}
+
+func reverseRoute(route []hop) []hop {
+	reversed := make([]hop, len(route))
+	for i, h := range route {
+		reversed[len(route)-1-i] = hop{link: h.link, dir: 1 - h.dir}
+	}
+	return reversed
+}
+
+// Metadata as announced by the ASes: latency, bandwidth and type of each
+// link, latency and bandwidth are unknown within ASes. The MTU is the
+// smallest of mtu and the MTUs of the links
+func metadata(route []hop, mtu uint16) snet.PathMetadata {
+	interfaces := interfacesOf(route)
+	meta := snet.PathMetadata{
+		Interfaces: interfaces,
+		MTU:        mtu,
+		Expiry:     time.Now().Add(pathLifetime),
+	}
+	if len(interfaces) > 0 {
+		meta.Latency = make([]time.Duration, len(interfaces)-1)
+		meta.Bandwidth = make([]uint64, len(interfaces)-1)
+		meta.LinkType = make([]snet.LinkType, len(route))
+		for i, h := range route {
+			meta.Latency[2*i] = h.link.props.Latency
+			meta.Bandwidth[2*i] = uint64(h.link.props.Bandwidth / 1000)
+			meta.LinkType[i] = h.link.props.LinkType
+			if h.link.mtu > 0 && h.link.mtu < meta.MTU {
+				meta.MTU = h.link.mtu
+			}
+		}
+	}
+	return meta
+}
+
+func snetPath(dst addr.IA, route []hop, mtu uint16) snet.Path {
+	return snetpath.Path{
+		Dst:   dst,
+		SPath: spath.Path{Raw: []byte(routeKey(route)), Type: scion.PathType},
+		Meta:  metadata(route, mtu),
+	}
+}
+
+// Returns the pan path of route, which is cached to keep
+// the allocations per packet low. n.mutex has to be held
+func (n *Network) panPath(src, dst addr.IA, route []hop) *pan.Path {
+	key := routeKey(route)
+	if p, ok := n.pathCache[key]; ok {
+		return p
+	}
+
+	p := lookup.PanPath(snetPath(dst, route, n.MTU))
+	p.Source = pan.IA(src)
+	n.pathCache[key] = p
+	return p
+}
+
+func (n *Network) panPaths(src, dst addr.IA) []*pan.Path {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	routes := n.routes(src, dst)
+	paths := make([]*pan.Path, len(routes))
+	for i, r := range routes {
+		paths[i] = n.panPath(src, dst, r)
+	}
+	return paths
+}
+
+// Resolves the links of a pan path from src to dst. n.mutex has to be held
+func (n *Network) routeOf(src, dst addr.IA, p *pan.Path) ([]hop, error) {
+	if src == dst {
+		return nil, nil
+	}
+	if p == nil {
+		return nil, ErrNoPath
+	}
+	if p.Metadata == nil || len(p.Metadata.Interfaces)%2 != 0 {
+		return nil, ErrInvalidPath
+	}
+
+	interfaces := p.Metadata.Interfaces
+	route := make([]hop, 0, len(interfaces)/2)
+	ia := src
+	for i := 0; i < len(interfaces); i += 2 {
+		from := snet.PathInterface{IA: addr.IA(interfaces[i].IA), ID: common.IFIDType(interfaces[i].IfID)}
+		to := snet.PathInterface{IA: addr.IA(interfaces[i+1].IA), ID: common.IFIDType(interfaces[i+1].IfID)}
+		l, ok := n.interfaces[from]
+		if !ok || from.IA != ia {
+			return nil, ErrInvalidPath
+		}
+		h := hop{link: l, dir: 0}
+		if l.B == from {
+			h.dir = 1
+		}
+		if h.to() != to {
+			return nil, ErrInvalidPath
+		}
+		route = append(route, h)
+		ia = to.IA
+	}
+	if ia != dst {
+		return nil, ErrInvalidPath
+	}
+	return route, nil
+}
+
+// Sends b from src to dst along path. Like UDP, packets that are lost
+// or dropped at a full queue do not return an error
+func (n *Network) send(src, dst pan.UDPAddr, path *pan.Path, b []byte) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	route, err := n.routeOf(addr.IA(src.IA), addr.IA(dst.IA), path)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	arrival := now
+	for _, h := range route {
+		props := h.link.props
+		h.link.sent[h.dir]++
+		if props.Loss > 0 && n.rand.Float64() < props.Loss {
+			h.link.dropped[h.dir]++
+			return nil
+		}
+
+		start := arrival
+		if h.link.busyUntil[h.dir].After(start) {
+			start = h.link.busyUntil[h.dir]
+		}
+		queue := props.Queue
+		if queue <= 0 {
+			queue = defaultQueue
+		}
+		if start.Sub(arrival) > queue {
+			h.link.dropped[h.dir]++
+			return nil
+		}
+		if props.Bandwidth > 0 {
+			start = start.Add(time.Duration(int64(len(b)) * 8 * int64(time.Second) / props.Bandwidth))
+		}
+		h.link.busyUntil[h.dir] = start
+		arrival = start.Add(props.Latency)
+	}
+
+	data := make([]byte, len(b))
+	copy(data, b)
+	p := &packet{
+		data:    data,
+		src:     src,
+		dst:     dst,
+		arrival: arrival,
+	}
+	// Packets within an AS have no path, as in pan
+	if len(route) > 0 {
+		p.path = n.panPath(addr.IA(dst.IA), addr.IA(src.IA), reverseRoute(route))
+	}
+	n.scheduler.schedule(p)
+	return nil
+}
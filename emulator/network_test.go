@@ -0,0 +1,273 @@
+package emulator
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/netsys-lab/scion-path-discovery/pathselection"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+	"inet.af/netaddr"
+)
+
+var (
+	ia110 = testutil.MustIA("1-ff00:0:110")
+	ia111 = testutil.MustIA("1-ff00:0:111")
+	ia112 = testutil.MustIA("1-ff00:0:112")
+	ia113 = testutil.MustIA("1-ff00:0:113")
+)
+
+// Two ASes between 110 and 113, which are connected to each other
+func newTestNetwork(t *testing.T, props LinkProperties) *Network {
+	n := NewNetwork(ia110, 1)
+	n.AddHost(ia110, netaddr.IPv4(127, 0, 0, 1))
+	n.AddHost(ia113, netaddr.IPv4(127, 0, 0, 2))
+	links := []struct {
+		a, b     addr.IA
+		aIf, bIf uint16
+	}{
+		{ia110, ia111, 1, 1},
+		{ia110, ia112, 2, 1},
+		{ia111, ia113, 2, 1},
+		{ia112, ia113, 2, 2},
+		{ia111, ia112, 3, 3},
+	}
+	for _, l := range links {
+		_, err := n.AddLink(l.a, common.IFIDType(l.aIf), l.b, common.IFIDType(l.bIf), props)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return n
+}
+
+func serverAddr(port uint16) pan.UDPAddr {
+	return pan.UDPAddr{IA: pan.IA(ia113), IP: netaddr.IPv4(127, 0, 0, 2), Port: port}
+}
+
+// Sends count numbered packets from a new conn to a listener and returns the received numbers
+func transfer(t *testing.T, n *Network, count int, size int) []int {
+	listener, err := n.ListenUDP(context.Background(), netaddr.IPPortFrom(netaddr.IPv4(127, 0, 0, 2), 5000), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conn, err := n.DialUDP(context.Background(), netaddr.IPPort{}, serverAddr(5000), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i := 0; i < count; i++ {
+		b := make([]byte, size)
+		copy(b, fmt.Sprintf("%d", i))
+		_, err := conn.Write(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received := make([]int, 0)
+	b := make([]byte, size)
+	for {
+		listener.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		_, _, err := listener.ReadFrom(b)
+		if err != nil {
+			break
+		}
+		var i int
+		fmt.Sscanf(string(b), "%d", &i)
+		received = append(received, i)
+	}
+	return received
+}
+
+func Test_Network(t *testing.T) {
+	t.Run("Network Paths", func(t *testing.T) {
+		n := newTestNetwork(t, LinkProperties{Latency: 5 * time.Millisecond, Bandwidth: 1000000})
+		defer n.Close()
+
+		paths, err := n.QueryPaths(context.Background(), pan.IA(ia113))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []lookup.PathFingerprint{
+			"1-ff00:0:110#1 1-ff00:0:111#1 1-ff00:0:111#2 1-ff00:0:113#1",
+			"1-ff00:0:110#2 1-ff00:0:112#1 1-ff00:0:112#2 1-ff00:0:113#2",
+			"1-ff00:0:110#1 1-ff00:0:111#1 1-ff00:0:111#3 1-ff00:0:112#3 1-ff00:0:112#2 1-ff00:0:113#2",
+			"1-ff00:0:110#2 1-ff00:0:112#1 1-ff00:0:112#3 1-ff00:0:111#3 1-ff00:0:111#2 1-ff00:0:113#1",
+		}
+		if len(paths) != len(expected) {
+			t.Fatalf("Expected %d paths, got %d", len(expected), len(paths))
+		}
+		for i, p := range paths {
+			if fp := lookup.Fingerprint(p); fp != expected[i] {
+				t.Errorf("Expected path %d to be %q, got %q", i, expected[i], fp)
+			}
+			if p.Destination() != ia113 {
+				t.Errorf("Expected destination %s, got %s", ia113, p.Destination())
+			}
+			meta := p.Metadata()
+			if meta.Latency[0] != 5*time.Millisecond || meta.Bandwidth[0] != 1000 {
+				t.Errorf("Expected link metadata in path %d, got %v %v", i, meta.Latency, meta.Bandwidth)
+			}
+		}
+
+		local := n.Paths(ia110, ia110)
+		if len(local) != 1 || len(local[0].Metadata().Interfaces) != 0 {
+			t.Errorf("Expected one empty path within the AS, got %v", local)
+		}
+	})
+
+	t.Run("Network Hides Hidden Links", func(t *testing.T) {
+		n := newTestNetwork(t, LinkProperties{LinkType: snet.LinkTypeDirect})
+		defer n.Close()
+		n.SetLinkProperties(n.Link(ia112, 2), LinkProperties{LinkType: snet.LinkTypeOpennet, Hidden: true})
+
+		paths, err := n.QueryPaths(context.Background(), pan.IA(ia113))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != 2 {
+			t.Errorf("Expected the 2 paths without the hidden link, got %d", len(paths))
+		}
+		paths, err = n.QueryPathsWithOptions(context.Background(), pan.IA(ia113), scionhost.QueryOptions{Hidden: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != 4 {
+			t.Fatalf("Expected all 4 paths, got %d", len(paths))
+		}
+		if lt := paths[1].Metadata().LinkType; len(lt) != 2 || lt[0] != snet.LinkTypeDirect || lt[1] != snet.LinkTypeOpennet {
+			t.Errorf("Expected the link types of the path, got %v", lt)
+		}
+	})
+
+	t.Run("Network Replies Over Reverse Path", func(t *testing.T) {
+		n := newTestNetwork(t, LinkProperties{Latency: 10 * time.Millisecond})
+		defer n.Close()
+
+		listener, err := n.ListenUDP(context.Background(), netaddr.IPPortFrom(netaddr.IPv4(127, 0, 0, 2), 5000), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+
+		paths := n.panPaths(ia110, ia113)
+		sel := &pathselection.FixedSelector{FixedPath: paths[1]}
+		conn, err := n.DialUDP(context.Background(), netaddr.IPPort{}, serverAddr(5000), nil, sel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		start := time.Now()
+		_, err = conn.Write([]byte("ping"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 16)
+		_, remote, path, err := listener.ReadFromVia(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("Expected a delay of two links, got %s", elapsed)
+		}
+		if remote != conn.LocalAddr().(pan.UDPAddr) {
+			t.Errorf("Expected packet from %s, got %s", conn.LocalAddr(), remote)
+		}
+		if path.Fingerprint != "2 2 1 2" {
+			t.Errorf("Expected reverse of %s, got %s", paths[1].Fingerprint, path.Fingerprint)
+		}
+
+		_, err = listener.WriteTo([]byte("pong"), remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, path, err = conn.ReadVia(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path.Fingerprint != paths[1].Fingerprint {
+			t.Errorf("Expected reply over %s, got %s", paths[1].Fingerprint, path.Fingerprint)
+		}
+	})
+
+	t.Run("Network Losses Are Reproducible", func(t *testing.T) {
+		props := LinkProperties{Loss: 0.2}
+		first := newTestNetwork(t, props)
+		defer first.Close()
+		second := newTestNetwork(t, props)
+		defer second.Close()
+
+		a := transfer(t, first, 500, 100)
+		b := transfer(t, second, 500, 100)
+		if len(a) == 500 || len(a) < 250 {
+			t.Errorf("Expected about 36%% loss over two links, received %d of 500", len(a))
+		}
+		if fmt.Sprint(a) != fmt.Sprint(b) {
+			t.Errorf("Expected the same packets with the same seed, got %d and %d", len(a), len(b))
+		}
+		for i := 1; i < len(a); i++ {
+			if a[i] <= a[i-1] {
+				t.Fatalf("Expected packets in order, got %d after %d", a[i], a[i-1])
+			}
+		}
+	})
+
+	t.Run("Network Limits Bandwidth", func(t *testing.T) {
+		// 100 packets of 1000 bytes take 100ms at 8 Mbit/s
+		n := newTestNetwork(t, LinkProperties{Bandwidth: 8000000, Queue: time.Second})
+		defer n.Close()
+
+		start := time.Now()
+		received := transfer(t, n, 100, 1000)
+		elapsed := time.Since(start) - 500*time.Millisecond
+		if len(received) != 100 {
+			t.Errorf("Expected all packets, received %d", len(received))
+		}
+		if elapsed < 100*time.Millisecond {
+			t.Errorf("Expected the transfer to take at least 100ms, took %s", elapsed)
+		}
+	})
+
+	t.Run("Network Drops At Full Queue", func(t *testing.T) {
+		n := newTestNetwork(t, LinkProperties{Bandwidth: 8000000, Queue: 10 * time.Millisecond})
+		defer n.Close()
+
+		received := transfer(t, n, 100, 1000)
+		if len(received) > 20 {
+			t.Errorf("Expected a queue of about 10 packets, received %d", len(received))
+		}
+	})
+
+	t.Run("Network Rejects Bound Address", func(t *testing.T) {
+		n := newTestNetwork(t, LinkProperties{})
+		defer n.Close()
+
+		local := netaddr.IPPortFrom(netaddr.IPv4(127, 0, 0, 2), 5000)
+		listener, err := n.ListenUDP(context.Background(), local, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = n.ListenUDP(context.Background(), local, nil)
+		if err == nil {
+			t.Error("Expected error when binding twice")
+		}
+		listener.Close()
+		listener, err = n.ListenUDP(context.Background(), local, nil)
+		if err != nil {
+			t.Errorf("Expected address to be free after close, got %s", err)
+			return
+		}
+		listener.Close()
+	})
+}
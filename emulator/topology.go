@@ -0,0 +1,376 @@
+package emulator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+	"gopkg.in/yaml.v2"
+)
+
+// Type of a link as in the linkAtoB field of a topology file
+type LinkType string
+
+const (
+	LinkCore  LinkType = "CORE"
+	LinkChild LinkType = "CHILD"
+	LinkPeer  LinkType = "PEER"
+)
+
+const (
+	// MTU of ASes without mtu, as in scionproto's topology generator
+	defaultASMTU           = 1472
+	defaultTopologyMaxHops = 12
+)
+
+type TopologyAS struct {
+	IA   addr.IA
+	Core bool
+	MTU  uint16
+}
+
+type TopologyLink struct {
+	A, B snet.PathInterface
+	// Relation of B to A, B is the child of A for LinkChild
+	Type LinkType
+	// MTU of the link, 0 if only the MTU of the ASes applies
+	MTU        uint16
+	Properties LinkProperties
+}
+
+// Topology describes ASes and the links between them as in the .topo files
+// of scionproto's local topology generator. Paths are combined from up, core
+// and down segments, including shortcuts and peering links, like the SCION
+// control plane does
+type Topology struct {
+	ASes  map[addr.IA]TopologyAS
+	Links []TopologyLink
+	// Maximum number of links of a path
+	MaxHops int
+	// Maximum number of paths returned by Paths, shortest first
+	MaxPaths int
+}
+
+type topologyFile struct {
+	ASes map[string]struct {
+		Core bool `yaml:"core"`
+		MTU  int  `yaml:"mtu"`
+	} `yaml:"ASes"`
+	Links []struct {
+		A        string `yaml:"a"`
+		B        string `yaml:"b"`
+		LinkAtoB string `yaml:"linkAtoB"`
+		MTU      int    `yaml:"mtu"`
+		// Mbit/s
+		Bandwidth float64 `yaml:"bw"`
+		// Not part of scionproto's format: one-way latency
+		// in milliseconds and loss probability of the link
+		Latency float64 `yaml:"latency"`
+		Loss    float64 `yaml:"loss"`
+	} `yaml:"links"`
+}
+
+// LoadTopology reads a topology from a .topo file
+func LoadTopology(file string) (*Topology, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTopology(data)
+}
+
+// ParseTopology parses a topology in the .topo format. Besides the mtu and
+// bw (Mbit/s) of links, the optional fields latency (ms) and loss are used
+// to emulate them. Border router names in interfaces, e.g. 1-ff00:0:110-A#1,
+// are ignored
+func ParseTopology(data []byte) (*Topology, error) {
+	var file topologyFile
+	err := yaml.Unmarshal(data, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Topology{
+		ASes:     make(map[addr.IA]TopologyAS),
+		Links:    make([]TopologyLink, 0, len(file.Links)),
+		MaxHops:  defaultTopologyMaxHops,
+		MaxPaths: defaultMaxPaths,
+	}
+	for s, as := range file.ASes {
+		ia, err := addr.IAFromString(s)
+		if err != nil {
+			return nil, err
+		}
+		mtu := uint16(as.MTU)
+		if mtu == 0 {
+			mtu = defaultASMTU
+		}
+		t.ASes[ia] = TopologyAS{IA: ia, Core: as.Core, MTU: mtu}
+	}
+
+	for _, l := range file.Links {
+		a, err := parseTopologyInterface(l.A)
+		if err != nil {
+			return nil, err
+		}
+		b, err := parseTopologyInterface(l.B)
+		if err != nil {
+			return nil, err
+		}
+		linkType := LinkType(strings.ToUpper(l.LinkAtoB))
+		switch linkType {
+		case LinkCore, LinkChild, LinkPeer:
+		default:
+			return nil, fmt.Errorf("link %s-%s: unknown linkAtoB %q", l.A, l.B, l.LinkAtoB)
+		}
+		for _, i := range []snet.PathInterface{a, b} {
+			if _, ok := t.ASes[i.IA]; !ok {
+				t.ASes[i.IA] = TopologyAS{IA: i.IA, MTU: defaultASMTU}
+			}
+		}
+		if linkType == LinkCore && (!t.ASes[a.IA].Core || !t.ASes[b.IA].Core) {
+			return nil, fmt.Errorf("link %s-%s: core link between non-core ASes", l.A, l.B)
+		}
+		t.Links = append(t.Links, TopologyLink{
+			A:    a,
+			B:    b,
+			Type: linkType,
+			MTU:  uint16(l.MTU),
+			Properties: LinkProperties{
+				Bandwidth: int64(l.Bandwidth * 1000000),
+				Latency:   time.Duration(l.Latency * float64(time.Millisecond)),
+				Loss:      l.Loss,
+			},
+		})
+	}
+	return t, nil
+}
+
+// Parses interfaces like 1-ff00:0:110#1 or 1-ff00:0:110-A#1
+func parseTopologyInterface(s string) (snet.PathInterface, error) {
+	parts := strings.Split(s, "#")
+	if len(parts) != 2 {
+		return snet.PathInterface{}, fmt.Errorf("invalid interface %q", s)
+	}
+	ifID, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return snet.PathInterface{}, fmt.Errorf("invalid interface %q: %w", s, err)
+	}
+	iaParts := strings.SplitN(parts[0], "-", 3)
+	if len(iaParts) < 2 {
+		return snet.PathInterface{}, fmt.Errorf("invalid interface %q", s)
+	}
+	ia, err := addr.IAFromString(iaParts[0] + "-" + iaParts[1])
+	if err != nil {
+		return snet.PathInterface{}, err
+	}
+	return snet.PathInterface{IA: ia, ID: common.IFIDType(ifID)}, nil
+}
+
+// Creates the links of the topology, which are not attached to a network
+func (t *Topology) links() []*Link {
+	links := make([]*Link, len(t.Links))
+	for i, l := range t.Links {
+		links[i] = &Link{A: l.A, B: l.B, props: l.Properties, mtu: t.linkMTU(l)}
+	}
+	return links
+}
+
+// Smallest MTU of the link and the ASes at both ends
+func (t *Topology) linkMTU(l TopologyLink) uint16 {
+	mtu := t.ASes[l.A.IA].MTU
+	if m := t.ASes[l.B.IA].MTU; m < mtu {
+		mtu = m
+	}
+	if l.MTU > 0 && l.MTU < mtu {
+		mtu = l.MTU
+	}
+	return mtu
+}
+
+// Paths returns the paths from src to dst ordered by
+// their number of links and interfaces
+func (t *Topology) Paths(src, dst addr.IA) []snet.Path {
+	routes := sortRoutes(t.routes(src, dst, t.links()), t.MaxPaths)
+	paths := make([]snet.Path, len(routes))
+	for i, r := range routes {
+		mtu := uint16(defaultASMTU)
+		if as, ok := t.ASes[src]; ok {
+			mtu = as.MTU
+		}
+		paths[i] = snetPath(dst, r, mtu)
+	}
+	return paths
+}
+
+// NewNetwork creates an emulated network with the links of the topology,
+// whose path lookups return the paths of the topology. Links added to the
+// network later are not used by its paths
+func (t *Topology) NewNetwork(local addr.IA, seed int64) (*Network, error) {
+	n := NewNetwork(local, seed)
+	n.MaxPaths = t.MaxPaths
+	if as, ok := t.ASes[local]; ok {
+		n.MTU = as.MTU
+	}
+	links := make([]*Link, len(t.Links))
+	for i, l := range t.Links {
+		link, err := n.AddLink(l.A.IA, l.A.ID, l.B.IA, l.B.ID, l.Properties)
+		if err != nil {
+			n.Close()
+			return nil, err
+		}
+		link.mtu = t.linkMTU(l)
+		links[i] = link
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.topology = t
+	n.topologyLinks = links
+	return n, nil
+}
+
+func (t *Topology) isCore(ia addr.IA) bool {
+	return t.ASes[ia].Core
+}
+
+func (t *Topology) maxHops() int {
+	if t.MaxHops <= 0 {
+		return defaultTopologyMaxHops
+	}
+	return t.MaxHops
+}
+
+// Combines up, core and down segments to routes from src to dst over
+// links, which are the links of the topology in the same order
+func (t *Topology) routes(src, dst addr.IA, links []*Link) [][]hop {
+	if src == dst {
+		return [][]hop{{}}
+	}
+
+	ups := t.upSegments(src, links)
+	downs := make([][]hop, 0)
+	for _, s := range t.upSegments(dst, links) {
+		downs = append(downs, reverseRoute(s))
+	}
+
+	routes := make([][]hop, 0)
+	add := func(segments ...[]hop) {
+		route := make([]hop, 0)
+		for _, s := range segments {
+			route = append(route, s...)
+		}
+		if len(route) <= t.maxHops() && loopFree(src, route) {
+			routes = append(routes, route)
+		}
+	}
+	for _, up := range ups {
+		upASes := asesOf(src, up)
+		for _, down := range downs {
+			downStart := dst
+			if len(down) > 0 {
+				downStart = down[0].from().IA
+			}
+			downASes := asesOf(downStart, down)
+
+			for _, core := range t.coreSegments(upASes[len(upASes)-1], downStart, links) {
+				add(up, core, down)
+			}
+
+			// Shortcuts and peering links between the non-core
+			// ASes of both segments, which avoid the core
+			for i, x := range upASes[:len(upASes)-1] {
+				for j := 1; j < len(downASes); j++ {
+					y := downASes[j]
+					if x == y {
+						add(up[:i], down[j:])
+						continue
+					}
+					for k, l := range t.Links {
+						if l.Type != LinkPeer {
+							continue
+						}
+						if l.A.IA == x && l.B.IA == y {
+							add(up[:i], []hop{{link: links[k], dir: 0}}, down[j:])
+						} else if l.B.IA == x && l.A.IA == y {
+							add(up[:i], []hop{{link: links[k], dir: 1}}, down[j:])
+						}
+					}
+				}
+			}
+		}
+	}
+	return routes
+}
+
+// Segments from ia up to a core AS over parent links,
+// a core AS has a single empty segment
+func (t *Topology) upSegments(ia addr.IA, links []*Link) [][]hop {
+	segments := make([][]hop, 0)
+	current := make([]hop, 0)
+	visited := map[addr.IA]bool{ia: true}
+	var search func(ia addr.IA)
+	search = func(ia addr.IA) {
+		if t.isCore(ia) {
+			segments = append(segments, append([]hop(nil), current...))
+			return
+		}
+		if len(current) == t.maxHops() {
+			return
+		}
+		for k, l := range t.Links {
+			if l.Type != LinkChild || l.B.IA != ia || visited[l.A.IA] {
+				continue
+			}
+			visited[l.A.IA] = true
+			current = append(current, hop{link: links[k], dir: 1})
+			search(l.A.IA)
+			current = current[:len(current)-1]
+			visited[l.A.IA] = false
+		}
+	}
+	search(ia)
+	return segments
+}
+
+// Loop-free segments between two core ASes over core links
+func (t *Topology) coreSegments(src, dst addr.IA, links []*Link) [][]hop {
+	if src == dst {
+		return [][]hop{{}}
+	}
+	coreLinks := make([]*Link, 0)
+	for k, l := range t.Links {
+		if l.Type == LinkCore {
+			coreLinks = append(coreLinks, links[k])
+		}
+	}
+	return searchRoutes(src, dst, coreLinks, t.maxHops())
+}
+
+// ASes traversed by route starting at src
+func asesOf(src addr.IA, route []hop) []addr.IA {
+	ases := []addr.IA{src}
+	for _, h := range route {
+		ases = append(ases, h.to().IA)
+	}
+	return ases
+}
+
+func loopFree(src addr.IA, route []hop) bool {
+	ases := asesOf(src, route)
+	sorted := make([]addr.IA, len(ases))
+	copy(sorted, ases)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].IAInt() < sorted[j].IAInt() })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i] == sorted[i-1] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package emulator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// Two cores with one child each, 112 is a child of 111,
+// which peers with 121
+const testTopology = `--- # Test topology
+ASes:
+  "1-ff00:0:110":
+    core: true
+  "1-ff00:0:120":
+    core: true
+  "1-ff00:0:111": {}
+  "1-ff00:0:112":
+    mtu: 1400
+  "1-ff00:0:121": {}
+links:
+  - {a: "1-ff00:0:110#1", b: "1-ff00:0:120#1", linkAtoB: CORE, latency: 20}
+  - {a: "1-ff00:0:110-A#2", b: "1-ff00:0:111#1", linkAtoB: CHILD, bw: 100, latency: 5}
+  - {a: "1-ff00:0:111#2", b: "1-ff00:0:112#1", linkAtoB: CHILD, mtu: 1280}
+  - {a: "1-ff00:0:120#2", b: "1-ff00:0:121#1", linkAtoB: CHILD}
+  - {a: "1-ff00:0:111#3", b: "1-ff00:0:121#2", linkAtoB: PEER}
+`
+
+func fingerprints(paths []snet.Path) []pan.PathFingerprint {
+	fps := make([]pan.PathFingerprint, len(paths))
+	for i, p := range paths {
+		fps[i] = lookup.Fingerprint(p).Pan()
+	}
+	return fps
+}
+
+func Test_Topology(t *testing.T) {
+	t.Run("Topology Combines Segments", func(t *testing.T) {
+		topo, err := ParseTopology([]byte(testTopology))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cases := []struct {
+			src, dst string
+			expected []pan.PathFingerprint
+		}{
+			// Peering link and up, core and down segment
+			{"1-ff00:0:112", "1-ff00:0:121", []pan.PathFingerprint{"1 2 3 2", "1 2 1 2 1 1 2 1"}},
+			// Shortcut to the parent instead of going over the core
+			{"1-ff00:0:112", "1-ff00:0:111", []pan.PathFingerprint{"1 2"}},
+			{"1-ff00:0:110", "1-ff00:0:112", []pan.PathFingerprint{"2 1 2 1"}},
+			{"1-ff00:0:110", "1-ff00:0:120", []pan.PathFingerprint{"1 1"}},
+		}
+		for _, c := range cases {
+			paths := topo.Paths(testutil.MustIA(c.src), testutil.MustIA(c.dst))
+			fps := fingerprints(paths)
+			if len(fps) != len(c.expected) {
+				t.Errorf("Expected paths %v from %s to %s, got %v", c.expected, c.src, c.dst, fps)
+				continue
+			}
+			for i := range fps {
+				if fps[i] != c.expected[i] {
+					t.Errorf("Expected paths %v from %s to %s, got %v", c.expected, c.src, c.dst, fps)
+					break
+				}
+			}
+		}
+
+		paths := topo.Paths(testutil.MustIA("1-ff00:0:112"), testutil.MustIA("1-ff00:0:121"))
+		meta := paths[1].Metadata()
+		if meta.MTU != 1280 {
+			t.Errorf("Expected MTU of the smallest link, got %d", meta.MTU)
+		}
+		if meta.Latency[2] != 5*time.Millisecond || meta.Latency[4] != 20*time.Millisecond {
+			t.Errorf("Expected latency of the links, got %v", meta.Latency)
+		}
+		if meta.Bandwidth[2] != 100000 {
+			t.Errorf("Expected bandwidth of 100 Mbit/s, got %d Kbit/s", meta.Bandwidth[2])
+		}
+	})
+
+	t.Run("Topology Network Serves Its Paths", func(t *testing.T) {
+		topo, err := ParseTopology([]byte(testTopology))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := topo.NewNetwork(testutil.MustIA("1-ff00:0:112"), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer n.Close()
+
+		paths, err := n.QueryPaths(context.Background(), pan.IA(testutil.MustIA("1-ff00:0:121")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fps := fingerprints(paths)
+		if len(fps) != 2 || fps[0] != "1 2 3 2" {
+			t.Errorf("Expected the paths of the topology, got %v", fps)
+		}
+	})
+
+	t.Run("Topology Loads Default Topology", func(t *testing.T) {
+		topo, err := LoadTopology("testdata/default.topo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(topo.ASes) != 16 || len(topo.Links) != 29 {
+			t.Errorf("Expected 16 ASes and 29 links, got %d and %d", len(topo.ASes), len(topo.Links))
+		}
+
+		src, dst := testutil.MustIA("1-ff00:0:112"), testutil.MustIA("2-ff00:0:222")
+		paths := topo.Paths(src, dst)
+		if len(paths) == 0 {
+			t.Fatal("Expected paths between the ISDs")
+		}
+		links := make(map[[2]snet.PathInterface]bool)
+		for _, l := range topo.Links {
+			links[[2]snet.PathInterface{l.A, l.B}] = true
+			links[[2]snet.PathInterface{l.B, l.A}] = true
+		}
+		peering := 0
+		for _, p := range paths {
+			interfaces := p.Metadata().Interfaces
+			if interfaces[0].IA != src || interfaces[len(interfaces)-1].IA != dst {
+				t.Errorf("Expected path from %s to %s, got %s", src, dst, p)
+			}
+			for i := 0; i+1 < len(interfaces); i += 2 {
+				if !links[[2]snet.PathInterface{interfaces[i], interfaces[i+1]}] {
+					t.Errorf("Expected only links of the topology, got %s", p)
+				}
+			}
+			if len(interfaces) == 6 {
+				peering++
+			}
+		}
+		// 111 peers twice with 211, the parent of 222
+		if peering != 2 {
+			t.Errorf("Expected 2 paths over peering links, got %d", peering)
+		}
+	})
+}
@@ -23,10 +23,14 @@ func main() {
 	// peers := []string{"peer1", "peer2", "peer3"} // Later real addresses
 	flag.Parse()
 	logrus.SetLevel(logrus.DebugLevel)
-	mpSock := smp.NewPanSock(*localAddr, nil, &smp.PanSocketOptions{
+	mpSock, err := smp.NewPanSock(*localAddr, nil, &smp.PanSocketOptions{
 		Transport: "QUIC",
 	})
-	err := mpSock.Listen()
+	if err != nil {
+		log.Fatal("Failed to create PanSock: ", err)
+		os.Exit(1)
+	}
+	err = mpSock.Listen()
 	if err != nil {
 		log.Fatal("Failed to listen PanSock: ", err)
 		os.Exit(1)
@@ -37,7 +41,7 @@ func main() {
 		i := 1
 
 		for {
-			remote, err := mpSock.WaitForPeerConnect()
+			remote, err := mpSock.WaitForPeerConnect(nil)
 			if err != nil {
 				log.Fatal("Failed to connect in-dialing peer: ", err)
 				os.Exit(1)
@@ -46,9 +50,13 @@ func main() {
 			addr, _ := pan.ResolveUDPAddr(*localAddr)
 			addr.Port = addr.Port + uint16(i)*32
 
-			mps := smp.NewPanSock(addr.String(), nil, &smp.PanSocketOptions{
+			mps, err := smp.NewPanSock(addr.String(), nil, &smp.PanSocketOptions{
 				Transport: "QUIC",
 			})
+			if err != nil {
+				log.Fatal("Failed to create mps: ", err)
+				os.Exit(1)
+			}
 
 			err = mps.Listen()
 			if err != nil {
@@ -113,7 +121,7 @@ func main() {
 
 		for {
 			mpSock.Disconnect()
-			new, err := mpSock.WaitForPeerConnect()
+			new, err := mpSock.WaitForPeerConnect(nil)
 			if err != nil {
 				log.Fatal("Failed to wait for back MPPeerSock", err)
 				os.Exit(1)
@@ -123,10 +123,13 @@ func main() {
 	gob.Register(PathPacket{})
 	setLogging()
 
-	mpSock := smp.NewPanSock(*localAddr, nil, &smp.PanSocketOptions{
+	mpSock, err := smp.NewPanSock(*localAddr, nil, &smp.PanSocketOptions{
 		Transport: *transport,
 	})
-	err := mpSock.Listen()
+	if err != nil {
+		log.Fatal("Failed to create MPPeerSock", err)
+	}
+	err = mpSock.Listen()
 	if err != nil {
 		log.Fatal("Failed to listen MPPeerSock", err)
 	}
@@ -134,7 +137,7 @@ func main() {
 	log.Infof("Listening on %s", *localAddr)
 	if remoteAddr == nil || *remoteAddr == "" {
 		// TODO: Remote and Get Path is not working anymore
-		remote, err := mpSock.WaitForPeerConnect()
+		remote, err := mpSock.WaitForPeerConnect(nil)
 		if err != nil {
 			log.Fatal("Failed to wait for MPPeerSock connect", err)
 		}
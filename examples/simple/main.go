@@ -20,17 +20,21 @@ func main() {
 	// peers := []string{"peer1", "peer2", "peer3"} // Later real addresses
 	flag.Parse()
 	logrus.SetLevel(logrus.DebugLevel)
-	mpSock := smp.NewPanSock(*localAddr, nil, &smp.PanSocketOptions{
+	mpSock, err := smp.NewPanSock(*localAddr, nil, &smp.PanSocketOptions{
 		Transport: "QUIC",
 	})
-	err := mpSock.Listen()
+	if err != nil {
+		log.Fatal("Failed to create PanSock: ", err)
+		os.Exit(1)
+	}
+	err = mpSock.Listen()
 	if err != nil {
 		log.Fatal("Failed to listen PanSock: ", err)
 		os.Exit(1)
 	}
 
 	if *isServer {
-		remote, err := mpSock.WaitForPeerConnect()
+		remote, err := mpSock.WaitForPeerConnect(nil)
 		if err != nil {
 			log.Fatal("Failed to connect in-dialing peer: ", err)
 			os.Exit(1)
@@ -7,6 +7,7 @@ require (
 	github.com/netsec-ethz/scion-apps v0.5.0
 	github.com/scionproto/scion v0.6.1-0.20210929154253-764d6e2afe47
 	github.com/sirupsen/logrus v1.6.0
+	gopkg.in/yaml.v2 v2.4.0
 	inet.af/netaddr v0.0.0-20220811202034-502d2d690317
 )
 
@@ -59,5 +60,4 @@ require (
 	google.golang.org/grpc v1.38.1 // indirect
 	google.golang.org/protobuf v1.26.0 // indirect
 	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -0,0 +1,37 @@
+// Package testutil holds the fixtures shared by the tests of all packages
+package testutil
+
+import (
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+	snetpath "github.com/scionproto/scion/go/lib/snet/path"
+)
+
+// MustIA parses s and panics if it is not a valid IA
+func MustIA(s string) addr.IA {
+	ia, err := addr.IAFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return ia
+}
+
+// Path returns a path over the passed interfaces, given as pairs of IA
+// and interface ID, e.g. Path("1-ff00:0:110", 1, "1-ff00:0:111", 2).
+// The destination is the IA of the last interface. Further metadata
+// can be set on the returned path
+func Path(hops ...interface{}) snetpath.Path {
+	interfaces := make([]snet.PathInterface, 0, len(hops)/2)
+	for i := 0; i+1 < len(hops); i += 2 {
+		interfaces = append(interfaces, snet.PathInterface{
+			IA: MustIA(hops[i].(string)),
+			ID: common.IFIDType(hops[i+1].(int)),
+		})
+	}
+	p := snetpath.Path{Meta: snet.PathMetadata{Interfaces: interfaces}}
+	if len(interfaces) > 0 {
+		p.Dst = interfaces[len(interfaces)-1].IA
+	}
+	return p
+}
@@ -1,7 +1,9 @@
 package packets
 
 import (
+	"errors"
 	"net"
+	"sync/atomic"
 
 	"github.com/scionproto/scion/go/lib/snet"
 )
@@ -10,6 +12,9 @@ const (
 	PACKET_SIZE = 1400 // At the moment we work only with normal MTUs, no jumbo frames
 )
 
+// Returned by Read and Write of a conn after the remote closed it
+var ErrPeerClosed = errors.New("connection closed by peer")
+
 func ConnTypeToString(connType int) string {
 	switch connType {
 	case ConnectionTypes.Bidirectional:
@@ -48,6 +53,7 @@ func newConnectionStates() *connectionStates {
 		Pending: 1,
 		Open:    2,
 		Closed:  3,
+		Down:    4,
 	}
 }
 
@@ -55,14 +61,50 @@ type connectionStates struct {
 	Pending int
 	Open    int
 	Closed  int
+	// No packets were received within the keepalive dead interval,
+	// the conn becomes Open again once packets arrive
+	Down int
 }
 
+func ConnStateToString(state int) string {
+	switch state {
+	case ConnectionStates.Pending:
+		return "pending"
+	case ConnectionStates.Open:
+		return "open"
+	case ConnectionStates.Closed:
+		return "closed"
+	case ConnectionStates.Down:
+		return "down"
+	}
+
+	return ""
+}
+
+// BasicConn holds the state of a conn, which may be
+// changed concurrently, e.g. by keepalives
 type BasicConn struct {
-	state int
+	state int32
 }
 
 func (c *BasicConn) GetState() int {
-	return c.state
+	state := int(atomic.LoadInt32(&c.state))
+	if state == 0 {
+		return ConnectionStates.Pending
+	}
+	return state
+}
+
+func (c *BasicConn) SetState(state int) {
+	atomic.StoreInt32(&c.state, int32(state))
+}
+
+// Changes the state only if it equals old, returns true on success
+func (c *BasicConn) CompareAndSetState(old, state int) bool {
+	if old == ConnectionStates.Pending && atomic.CompareAndSwapInt32(&c.state, 0, int32(state)) {
+		return true
+	}
+	return atomic.CompareAndSwapInt32(&c.state, int32(old), int32(state))
 }
 
 type UDPConn interface {
@@ -71,6 +113,17 @@ type UDPConn interface {
 	GetPath() *snet.Path
 	SetPath(*snet.Path) error
 	GetRemote() *snet.UDPAddr
+	GetState() int
+}
+
+// Implemented by conns of accepting sockets, which may send over a different
+// path than the one they receive on. Metrics of both directions are
+// recorded separately for the respective path
+type AsymmetricConn interface {
+	UDPConn
+	GetReplyPath() *snet.Path
+	SetReplyPath(*snet.Path) error
+	GetReplyMetrics() *PathMetrics
 }
 
 type TransportConstructor func() UDPConn
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
@@ -14,6 +15,7 @@ import (
 type MetricsDB struct {
 	UpdateInterval time.Duration
 	Data           map[string]*PathMetrics
+	mutex          sync.Mutex
 }
 
 var singletonMetricsDB MetricsDB
@@ -37,10 +39,12 @@ func (mdb *MetricsDB) Tick() {
 
 func (mdb *MetricsDB) GetBySocket(local *snet.UDPAddr) []*PathMetrics {
 	logrus.Trace("[MetricsDB] Get metrics for local ", local)
-	id := local.String()
+	id := local.String() + "-"
 	metrics := make([]*PathMetrics, 0)
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
 	for k, v := range mdb.Data {
-		if strings.Contains(k, id) {
+		if strings.HasPrefix(k, id) {
 			logrus.Trace("[MetricsDB] Got written bw ", v.WrittenBandwidth, " for path ", lookup.PathToString(*v.Path))
 			metrics = append(metrics, v)
 		}
@@ -49,21 +53,32 @@ func (mdb *MetricsDB) GetBySocket(local *snet.UDPAddr) []*PathMetrics {
 	return metrics
 }
 
+// Metrics are stored by the fingerprint of their path, so that they stay
+// assigned after the path was refreshed. Paths without one use their string
+func pathKey(path snet.Path) string {
+	if fp := lookup.Fingerprint(path); fp != "" {
+		return string(fp)
+	}
+	return lookup.PathToString(path)
+}
+
 func (mdb *MetricsDB) GetOrCreate(local *snet.UDPAddr, path *snet.Path) *PathMetrics {
 	ok := false
 	var m *PathMetrics
 	var id string
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
 	if local == nil {
-		id = lookup.PathToString(*path)
+		id = pathKey(*path)
 		for k, v := range mdb.Data {
-			if strings.Contains(k, id) {
+			if k == id || strings.HasSuffix(k, "-"+id) {
 				ok = true
 				m = v
 				break
 			}
 		}
 	} else {
-		id = fmt.Sprintf("%s-%s", local.String(), lookup.PathToString(*path))
+		id = fmt.Sprintf("%s-%s", local.String(), pathKey(*path))
 		m, ok = mdb.Data[id]
 	}
 
@@ -79,6 +94,41 @@ func (mdb *MetricsDB) GetOrCreate(local *snet.UDPAddr, path *snet.Path) *PathMet
 
 }
 
+// Returns the metrics of a conn that migrated from one path to another,
+// linked to the metrics of the previous path to keep the history of the conn
+func (mdb *MetricsDB) Migrate(local *snet.UDPAddr, from, to *snet.Path) *PathMetrics {
+	previous := mdb.GetOrCreate(local, from)
+	m := mdb.GetOrCreate(local, to)
+
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	if m.Previous != nil {
+		return m
+	}
+	// Migrating back to an earlier path must not create a cycle
+	for p := previous; p != nil; p = p.Previous {
+		if p == m {
+			return m
+		}
+	}
+	m.Previous = previous
+	return m
+}
+
+// Removes the passed metrics from the DB, e.g. after their conns were closed
+func (mdb *MetricsDB) Remove(metrics ...*PathMetrics) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	for _, m := range metrics {
+		for k, v := range mdb.Data {
+			if v == m {
+				logrus.Trace("[MetricsDB] Remove metrics ", k)
+				delete(mdb.Data, k)
+			}
+		}
+	}
+}
+
 // Some Metrics to start with
 // Will be extended later
 // NOTE: Add per path metrics here?
@@ -94,6 +144,18 @@ type PathMetrics struct {
 	MaxBandwidth     int64
 	UpdateInterval   time.Duration
 	Path             *snet.Path
+	// Metrics of the path used before a conn migrated to Path
+	Previous *PathMetrics
+	// Reported by conns that acknowledge packets, e.g. socket.ReliableConn
+	RTT                  time.Duration
+	MinRTT               time.Duration
+	LostPackets          int64
+	RetransmittedPackets int64
+	// Bandwidth received by the peer over this path, as reported by it.
+	// Only the latest maxPeerReports reports are kept
+	PeerReadBandwidth  []int64
+	PeerReportInterval time.Duration
+	LastPeerReport     time.Time
 }
 
 func NewPathMetrics(updateInterval time.Duration) *PathMetrics {
@@ -156,6 +218,42 @@ func (m *PathMetrics) LastAverageWriteBandwidth(lastElements int) int64 {
 	return val
 }
 
+// Number of peer reports kept in PeerReadBandwidth, reports arrive
+// for the whole lifetime of a conn
+const maxPeerReports = 16
+
+// Records the bandwidth the peer received over this path within interval
+func (m *PathMetrics) AddPeerReadBandwidth(bw int64, interval time.Duration) {
+	m.PeerReadBandwidth = append(m.PeerReadBandwidth, bw)
+	if n := len(m.PeerReadBandwidth); n > maxPeerReports {
+		m.PeerReadBandwidth = append(m.PeerReadBandwidth[:0], m.PeerReadBandwidth[n-maxPeerReports:]...)
+	}
+	m.PeerReportInterval = interval
+	m.LastPeerReport = time.Now()
+}
+
+// Returns the latest bandwidth reported by the peer, false if the
+// peer did not report within the last three report intervals
+func (m *PathMetrics) PeerGoodput() (int64, bool) {
+	if len(m.PeerReadBandwidth) == 0 || time.Since(m.LastPeerReport) > 3*m.PeerReportInterval {
+		return 0, false
+	}
+	return m.PeerReadBandwidth[len(m.PeerReadBandwidth)-1], true
+}
+
+// Counts a read of n bytes. Safe to call concurrently with other
+// counts and Tick, e.g. by the streams of a QUIC conn
+func (m *PathMetrics) AddRead(n int) {
+	atomic.AddInt64(&m.ReadBytes, int64(n))
+	atomic.AddInt64(&m.ReadPackets, 1)
+}
+
+// Counts a write of n bytes, like AddRead
+func (m *PathMetrics) AddWritten(n int) {
+	atomic.AddInt64(&m.WrittenBytes, int64(n))
+	atomic.AddInt64(&m.WrittenPackets, 1)
+}
+
 func (m *PathMetrics) Tick() {
 
 	// TODO: FIx this
@@ -163,11 +261,13 @@ func (m *PathMetrics) Tick() {
 		m.UpdateInterval = 1000 * time.Millisecond
 	}
 
+	readBytes := atomic.LoadInt64(&m.ReadBytes)
+	writtenBytes := atomic.LoadInt64(&m.WrittenBytes)
 	fac := int64((1000 * time.Millisecond) / m.UpdateInterval)
-	readBw := (m.ReadBytes - m.LastReadBytes) * fac
-	writeBw := (m.WrittenBytes - m.LastWrittenBytes) * fac
+	readBw := (readBytes - m.LastReadBytes) * fac
+	writeBw := (writtenBytes - m.LastWrittenBytes) * fac
 	m.ReadBandwidth = append(m.ReadBandwidth, readBw)
 	m.WrittenBandwidth = append(m.WrittenBandwidth, writeBw)
-	m.LastReadBytes = m.ReadBytes
-	m.LastWrittenBytes = m.WrittenBytes
+	m.LastReadBytes = readBytes
+	m.LastWrittenBytes = writtenBytes
 }
@@ -0,0 +1,155 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// Returned if none of the paths to a destination is the requested one
+var ErrNoMatchingPath = errors.New("no matching path found")
+
+// PathFingerprint identifies a path by its sequence of interfaces including their
+// IAs, e.g. "1-ff00:0:110#1 1-ff00:0:111#2 1-ff00:0:111#3 1-ff00:0:112#1".
+// In contrast to the raw path, it stays the same when the path is refreshed,
+// so it is used as key of metrics, path qualities and selectors. Paths without
+// metadata and paths within an AS have the empty fingerprint
+type PathFingerprint string
+
+func fingerprintOf(interfaces []snet.PathInterface) PathFingerprint {
+	ifaces := make([]string, len(interfaces))
+	for i, iface := range interfaces {
+		ifaces[i] = iface.String()
+	}
+	return PathFingerprint(strings.Join(ifaces, " "))
+}
+
+// Fingerprint returns the fingerprint of an snet path
+func Fingerprint(p snet.Path) PathFingerprint {
+	if p == nil || p.Metadata() == nil {
+		return ""
+	}
+	return fingerprintOf(p.Metadata().Interfaces)
+}
+
+// PanFingerprint returns the fingerprint of a pan path, which is the same as the one
+// of the snet path it was created from. pan.Path.Fingerprint differs, since pan only
+// uses interface IDs. Reply paths of pan have no metadata and the empty fingerprint
+func PanFingerprint(p *pan.Path) PathFingerprint {
+	if p == nil || p.Metadata == nil {
+		return ""
+	}
+	interfaces := make([]snet.PathInterface, len(p.Metadata.Interfaces))
+	for i, iface := range p.Metadata.Interfaces {
+		interfaces[i] = snet.PathInterface{IA: addr.IA(iface.IA), ID: common.IFIDType(iface.IfID)}
+	}
+	return fingerprintOf(interfaces)
+}
+
+// Interfaces parses the interfaces of the fingerprint
+func (fp PathFingerprint) Interfaces() ([]snet.PathInterface, error) {
+	interfaces := make([]snet.PathInterface, 0)
+	for _, s := range strings.Fields(string(fp)) {
+		parts := strings.Split(s, "#")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid interface %q in fingerprint", s)
+		}
+		ia, err := addr.IAFromString(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		ifID, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interface %q in fingerprint: %w", s, err)
+		}
+		interfaces = append(interfaces, snet.PathInterface{IA: ia, ID: common.IFIDType(ifID)})
+	}
+	return interfaces, nil
+}
+
+// Pan returns the fingerprint pan uses for the path, which consists of
+// the interface IDs only. Returns "" if the fingerprint is invalid
+func (fp PathFingerprint) Pan() pan.PathFingerprint {
+	interfaces, err := fp.Interfaces()
+	if err != nil {
+		return ""
+	}
+	ifIDs := make([]string, len(interfaces))
+	for i, iface := range interfaces {
+		ifIDs[i] = strconv.FormatUint(uint64(iface.ID), 10)
+	}
+	return pan.PathFingerprint(strings.Join(ifIDs, " "))
+}
+
+// PanPath converts an snet path to a pan path with the same metadata,
+// which identifies the path, e.g. for selectors. Only pan sets the
+// forwarding path of pan paths, so the result cannot be sent over
+func PanPath(p snet.Path) *pan.Path {
+	meta := p.Metadata()
+	path := &pan.Path{
+		Destination: pan.IA(p.Destination()),
+	}
+	if meta == nil {
+		return path
+	}
+
+	interfaces := make([]pan.PathInterface, len(meta.Interfaces))
+	for i, iface := range meta.Interfaces {
+		interfaces[i] = pan.PathInterface{IA: pan.IA(iface.IA), IfID: pan.IfID(iface.ID)}
+	}
+	if len(interfaces) > 0 {
+		path.Source = interfaces[0].IA
+	} else {
+		path.Source = path.Destination
+	}
+	path.Metadata = &pan.PathMetadata{
+		Interfaces:   interfaces,
+		MTU:          meta.MTU,
+		Latency:      meta.Latency,
+		Bandwidth:    meta.Bandwidth,
+		Geo:          meta.Geo,
+		LinkType:     meta.LinkType,
+		InternalHops: meta.InternalHops,
+		Notes:        meta.Notes,
+	}
+	path.Fingerprint = Fingerprint(p).Pan()
+	path.Expiry = meta.Expiry
+	return path
+}
+
+// FindPath returns the path with the passed fingerprint, false if there is none
+func FindPath(paths []snet.Path, fp PathFingerprint) (snet.Path, bool) {
+	for _, p := range paths {
+		if Fingerprint(p) == fp {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// SnetPath looks up the snet path with the fingerprint of a pan path, which can be
+// sent over by the sockets of this library. Together with PanPath, paths can be
+// converted in both directions
+func SnetPath(p *pan.Path) (snet.Path, error) {
+	fp := PanFingerprint(p)
+	if fp == "" {
+		return nil, ErrNoMatchingPath
+	}
+	paths, err := scionhost.QueryPaths(context.Background(), p.Destination)
+	if err != nil {
+		return nil, err
+	}
+	path, ok := FindPath(paths, fp)
+	if !ok {
+		return nil, ErrNoMatchingPath
+	}
+	return path, nil
+}
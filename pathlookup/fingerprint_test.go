@@ -0,0 +1,59 @@
+package lookup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	"github.com/scionproto/scion/go/lib/snet"
+	snetpath "github.com/scionproto/scion/go/lib/snet/path"
+)
+
+func Test_Fingerprint(t *testing.T) {
+	path := testutil.Path("1-ff00:0:110", 1, "1-ff00:0:111", 2, "1-ff00:0:111", 3, "1-ff00:0:112", 4)
+	path.Meta.MTU = 1280
+	path.Meta.Expiry = time.Unix(1700000000, 0)
+	expected := PathFingerprint("1-ff00:0:110#1 1-ff00:0:111#2 1-ff00:0:111#3 1-ff00:0:112#4")
+
+	t.Run("Fingerprint Includes IAs", func(t *testing.T) {
+		if fp := Fingerprint(path); fp != expected {
+			t.Errorf("Expected %q, got %q", expected, fp)
+		}
+		if fp := expected.Pan(); fp != pan.PathFingerprint("1 2 3 4") {
+			t.Errorf("Expected pan fingerprint \"1 2 3 4\", got %q", fp)
+		}
+		if fp := Fingerprint(snetpath.Path{Dst: testutil.MustIA("1-ff00:0:110")}); fp != "" {
+			t.Errorf("Expected no fingerprint for a path without interfaces, got %q", fp)
+		}
+	})
+
+	t.Run("Fingerprint Parses Interfaces", func(t *testing.T) {
+		interfaces, err := expected.Interfaces()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(interfaces) != 4 || interfaces[3] != path.Meta.Interfaces[3] {
+			t.Errorf("Expected interfaces %v, got %v", path.Meta.Interfaces, interfaces)
+		}
+		if _, err := PathFingerprint("1-ff00:0:110 1").Interfaces(); err == nil {
+			t.Error("Expected an error for an interface without ID")
+		}
+	})
+
+	t.Run("Fingerprint Survives Conversion", func(t *testing.T) {
+		p := PanPath(path)
+		if fp := PanFingerprint(p); fp != expected {
+			t.Errorf("Expected %q after conversion to pan, got %q", expected, fp)
+		}
+		if p.Source != pan.IA(testutil.MustIA("1-ff00:0:110")) || p.Metadata.MTU != 1280 || p.Fingerprint != "1 2 3 4" {
+			t.Errorf("Expected source, metadata and pan fingerprint of %s, got %v", path, p)
+		}
+
+		paths := []snet.Path{snetpath.Path{Dst: testutil.MustIA("1-ff00:0:112")}, path}
+		found, ok := FindPath(paths, PanFingerprint(p))
+		if !ok || Fingerprint(found) != expected {
+			t.Errorf("Expected to find %s, got %v", expected, found)
+		}
+	})
+}
@@ -13,12 +13,11 @@ import (
 // This wraps the usage of appnet to query paths
 // May later be put into an interface or struct
 func PathLookup(peer string) ([]snet.Path, error) {
-	host := scionhost.Host()
 	udpAddr, err := pan.ResolveUDPAddr(peer)
 	if err != nil {
 		return nil, err
 	}
-	return host.QueryPaths(context.Background(), udpAddr.IA)
+	return scionhost.QueryPaths(context.Background(), udpAddr.IA)
 }
 
 func PathToString(path snet.Path) string {
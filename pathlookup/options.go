@@ -0,0 +1,125 @@
+package lookup
+
+import (
+	"context"
+	"strings"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
+	"github.com/scionproto/scion/go/lib/slayers/path"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// LookupOptions determine which paths a lookup requests and returns.
+// Refresh and Hidden are passed to the SCION daemon, the other
+// options filter the returned paths by their characteristics
+type LookupOptions struct {
+	// Fetches fresh paths instead of the cached ones of the daemon
+	Refresh bool
+	// Includes the hidden paths of the hidden path groups of the local AS
+	Hidden bool
+	// Data-plane path types that are allowed, e.g. scion.PathType or
+	// epic.PathType. The metadata of this SCION version does not announce
+	// EPIC authenticators, so EPIC paths are recognized by their type.
+	// Empty allows all types
+	PathTypes []path.Type
+	// Link types that are allowed on all inter-domain links of a path.
+	// Links without announced type are only allowed if snet.LinkTypeUnset
+	// is included. Empty allows all types
+	LinkTypes []snet.LinkType
+	// Each of the notes has to be part of a note of some AS on the path
+	Notes []string
+	// Called for paths that passed the other filters, false drops the path
+	Filter func(snet.Path) bool
+}
+
+// Match returns whether p passes the filters of the options
+func (o *LookupOptions) Match(p snet.Path) bool {
+	if o == nil {
+		return true
+	}
+	if len(o.PathTypes) > 0 && !containsPathType(o.PathTypes, p.Path().Type) {
+		return false
+	}
+	meta := p.Metadata()
+	if len(o.LinkTypes) > 0 {
+		if meta == nil {
+			return false
+		}
+		// Links without entry have no announced type
+		for i := 0; i < len(meta.Interfaces)/2; i++ {
+			linkType := snet.LinkTypeUnset
+			if i < len(meta.LinkType) {
+				linkType = meta.LinkType[i]
+			}
+			if !containsLinkType(o.LinkTypes, linkType) {
+				return false
+			}
+		}
+	}
+	for _, note := range o.Notes {
+		if meta == nil || !containsNote(meta.Notes, note) {
+			return false
+		}
+	}
+	return o.Filter == nil || o.Filter(p)
+}
+
+// FilterPaths returns the paths that pass the filters of the options, in their order
+func (o *LookupOptions) FilterPaths(paths []snet.Path) []snet.Path {
+	filtered := make([]snet.Path, 0, len(paths))
+	for _, p := range paths {
+		if o.Match(p) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+func (o *LookupOptions) queryOptions() scionhost.QueryOptions {
+	if o == nil {
+		return scionhost.QueryOptions{}
+	}
+	return scionhost.QueryOptions{Refresh: o.Refresh, Hidden: o.Hidden}
+}
+
+// PathLookupWithOptions looks up the paths to peer like PathLookup, with the
+// flags of opts and filtered by them. nil options behave like PathLookup
+func PathLookupWithOptions(peer string, opts *LookupOptions) ([]snet.Path, error) {
+	udpAddr, err := pan.ResolveUDPAddr(peer)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := scionhost.QueryPathsWithOptions(context.Background(), udpAddr.IA, opts.queryOptions())
+	if err != nil {
+		return nil, err
+	}
+	return opts.FilterPaths(paths), nil
+}
+
+func containsPathType(types []path.Type, t path.Type) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsLinkType(types []snet.LinkType, t snet.LinkType) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsNote(notes []string, note string) bool {
+	for _, n := range notes {
+		if strings.Contains(n, note) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package lookup
+
+import (
+	"testing"
+
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	"github.com/scionproto/scion/go/lib/slayers/path"
+	"github.com/scionproto/scion/go/lib/slayers/path/epic"
+	"github.com/scionproto/scion/go/lib/slayers/path/scion"
+	"github.com/scionproto/scion/go/lib/snet"
+	snetpath "github.com/scionproto/scion/go/lib/snet/path"
+	"github.com/scionproto/scion/go/lib/spath"
+)
+
+func Test_LookupOptions(t *testing.T) {
+	testPath := func(pathType path.Type, linkTypes ...snet.LinkType) snetpath.Path {
+		p := testutil.Path("1-ff00:0:110", 1, "1-ff00:0:111", 2, "1-ff00:0:111", 3, "1-ff00:0:112", 4)
+		p.SPath = spath.Path{Type: pathType}
+		p.Meta.LinkType = linkTypes
+		return p
+	}
+	direct := testPath(scion.PathType, snet.LinkTypeDirect, snet.LinkTypeDirect)
+	direct.Meta.Notes = []string{"", "operated by provider A"}
+	opennet := testPath(epic.PathType, snet.LinkTypeDirect, snet.LinkTypeOpennet)
+	unannounced := testPath(scion.PathType)
+	paths := []snet.Path{direct, opennet, unannounced}
+
+	cases := []struct {
+		name     string
+		opts     *LookupOptions
+		expected []snet.Path
+	}{
+		{"No Options", nil, paths},
+		{"Path Types", &LookupOptions{PathTypes: []path.Type{epic.PathType}}, []snet.Path{opennet}},
+		{"Link Types", &LookupOptions{LinkTypes: []snet.LinkType{snet.LinkTypeDirect}}, []snet.Path{direct}},
+		{"Unset Link Types", &LookupOptions{LinkTypes: []snet.LinkType{snet.LinkTypeDirect, snet.LinkTypeUnset}}, []snet.Path{direct, unannounced}},
+		{"Notes", &LookupOptions{Notes: []string{"provider A"}}, []snet.Path{direct}},
+		{"Filter", &LookupOptions{Filter: func(p snet.Path) bool { return p.Path().Type == scion.PathType }}, []snet.Path{direct, unannounced}},
+	}
+	for _, c := range cases {
+		t.Run("LookupOptions Filter "+c.name, func(t *testing.T) {
+			filtered := c.opts.FilterPaths(paths)
+			if len(filtered) != len(c.expected) {
+				t.Fatalf("Expected %d paths, got %d", len(c.expected), len(filtered))
+			}
+			for i := range filtered {
+				if filtered[i].Path().Type != c.expected[i].Path().Type ||
+					len(filtered[i].Metadata().LinkType) != len(c.expected[i].Metadata().LinkType) {
+					t.Errorf("Expected path %d to be %v, got %v", i, c.expected[i], filtered[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package lookup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// Hop is an AS on a path with the interfaces the path enters and leaves it.
+// The first hop has no ingress, the last one no egress interface.
+// Zero values of the ISD, AS or interfaces match any value
+type Hop struct {
+	IA      addr.IA
+	Ingress common.IFIDType
+	Egress  common.IFIDType
+}
+
+func (h Hop) matches(o Hop) bool {
+	return (h.IA.I == 0 || h.IA.I == o.IA.I) &&
+		(h.IA.A == 0 || h.IA.A == o.IA.A) &&
+		(h.Ingress == 0 || h.Ingress == o.Ingress) &&
+		(h.Egress == 0 || h.Egress == o.Egress)
+}
+
+// PathPredicate matches paths by the sequence of their hops,
+// as parsed from a hop string by ParsePath
+type PathPredicate []Hop
+
+// Hops of a path, empty if the path has no interfaces
+func hopsOf(interfaces []snet.PathInterface) (PathPredicate, error) {
+	if len(interfaces) == 0 {
+		return PathPredicate{}, nil
+	}
+	if len(interfaces)%2 != 0 {
+		return nil, fmt.Errorf("odd number of interfaces %v", interfaces)
+	}
+	hops := PathPredicate{{IA: interfaces[0].IA, Egress: interfaces[0].ID}}
+	for i := 1; i < len(interfaces)-1; i += 2 {
+		in, out := interfaces[i], interfaces[i+1]
+		if in.IA != out.IA {
+			return nil, fmt.Errorf("interfaces %s and %s are not in the same AS", in, out)
+		}
+		hops = append(hops, Hop{IA: in.IA, Ingress: in.ID, Egress: out.ID})
+	}
+	last := interfaces[len(interfaces)-1]
+	return append(hops, Hop{IA: last.IA, Ingress: last.ID}), nil
+}
+
+// ParsePath parses the hop string of a path. Supported are the format of
+// PathToString and showpaths, e.g. "[1-ff00:0:110 1>2 1-ff00:0:111 3>1 1-ff00:0:112]",
+// optionally with the index and other fields of a showpaths line, and fingerprints,
+// e.g. "1-ff00:0:110#1 1-ff00:0:111#2 1-ff00:0:111#3 1-ff00:0:112#1".
+// 0 as ISD, AS or interface ID matches any value, e.g. "[1-0 0>0 1-ff00:0:111 0>0 1-0]"
+func ParsePath(s string) (PathPredicate, error) {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "Hops:"); i >= 0 {
+		s = strings.TrimSpace(s[i+len("Hops:"):])
+	}
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("missing ] in path %q", s)
+		}
+		s = s[1:end]
+	}
+	if s == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	if strings.Contains(s, "#") {
+		interfaces, err := PathFingerprint(s).Interfaces()
+		if err != nil {
+			return nil, err
+		}
+		return hopsOf(interfaces)
+	}
+
+	segments := strings.Split(s, ">")
+	if len(segments) < 2 {
+		return nil, fmt.Errorf("path %q has less than two hops", s)
+	}
+	hops := make(PathPredicate, len(segments))
+	for i, segment := range segments {
+		fields := strings.Fields(segment)
+		// First and last hop lack one of the interfaces
+		expected := 3
+		if i == 0 || i == len(segments)-1 {
+			expected = 2
+		}
+		if len(fields) != expected {
+			return nil, fmt.Errorf("invalid hop %q in path %q", segment, s)
+		}
+		ia := fields[0]
+		if i > 0 {
+			ia = fields[1]
+		}
+		hop := Hop{}
+		var err error
+		hop.IA, err = addr.IAFromString(ia)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			if hop.Ingress, err = parseIfID(fields[0]); err != nil {
+				return nil, err
+			}
+		}
+		if i < len(segments)-1 {
+			if hop.Egress, err = parseIfID(fields[len(fields)-1]); err != nil {
+				return nil, err
+			}
+		}
+		hops[i] = hop
+	}
+	return hops, nil
+}
+
+func parseIfID(s string) (common.IFIDType, error) {
+	ifID, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interface ID %q: %w", s, err)
+	}
+	return common.IFIDType(ifID), nil
+}
+
+// Match returns whether p has the hops of the predicate
+func (pp PathPredicate) Match(p snet.Path) bool {
+	if p == nil || p.Metadata() == nil {
+		return false
+	}
+	hops, err := hopsOf(p.Metadata().Interfaces)
+	if err != nil || len(hops) != len(pp) || len(pp) == 0 {
+		return false
+	}
+	for i, h := range pp {
+		if !h.matches(hops[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// PredicateOf returns the predicate matching exactly p
+func PredicateOf(p snet.Path) (PathPredicate, error) {
+	if p == nil || p.Metadata() == nil {
+		return nil, fmt.Errorf("path without metadata")
+	}
+	return hopsOf(p.Metadata().Interfaces)
+}
+
+// Similarity returns how close p is to the paths the predicate matches. Hops of p
+// that match a hop of the predicate count 2, hops in one of its ASes over other
+// interfaces count 1, regardless of their position on the path
+func (pp PathPredicate) Similarity(p snet.Path) int {
+	if p == nil || p.Metadata() == nil {
+		return 0
+	}
+	hops, err := hopsOf(p.Metadata().Interfaces)
+	if err != nil {
+		return 0
+	}
+	similarity := 0
+	for _, hop := range hops {
+		score := 0
+		for _, h := range pp {
+			if h.matches(hop) {
+				score = 2
+				break
+			}
+			if h.matches(Hop{IA: hop.IA, Ingress: h.Ingress, Egress: h.Egress}) {
+				score = 1
+			}
+		}
+		similarity += score
+	}
+	return similarity
+}
+
+// Filter returns the paths matching the predicate, in their order
+func (pp PathPredicate) Filter(paths []snet.Path) []snet.Path {
+	matching := make([]snet.Path, 0)
+	for _, p := range paths {
+		if pp.Match(p) {
+			matching = append(matching, p)
+		}
+	}
+	return matching
+}
+
+// Fingerprint returns the fingerprint of the only path the predicate
+// matches, false if the predicate contains wildcards
+func (pp PathPredicate) Fingerprint() (PathFingerprint, bool) {
+	if len(pp) < 2 {
+		return "", false
+	}
+	interfaces := make([]snet.PathInterface, 0, 2*len(pp)-2)
+	for i, h := range pp {
+		if h.IA.I == 0 || h.IA.A == 0 || (i > 0 && h.Ingress == 0) || (i < len(pp)-1 && h.Egress == 0) {
+			return "", false
+		}
+		if i > 0 {
+			interfaces = append(interfaces, snet.PathInterface{IA: h.IA, ID: h.Ingress})
+		}
+		if i < len(pp)-1 {
+			interfaces = append(interfaces, snet.PathInterface{IA: h.IA, ID: h.Egress})
+		}
+	}
+	return fingerprintOf(interfaces), true
+}
+
+// String returns the predicate in the format of PathToString
+func (pp PathPredicate) String() string {
+	hops := make([]string, len(pp))
+	for i, h := range pp {
+		fields := make([]string, 0, 3)
+		if i > 0 {
+			fields = append(fields, h.Ingress.String())
+		}
+		fields = append(fields, h.IA.String())
+		if i < len(pp)-1 {
+			fields = append(fields, h.Egress.String())
+		}
+		hops[i] = strings.Join(fields, " ")
+	}
+	return fmt.Sprintf("[%s]", strings.Join(hops, ">"))
+}
+
+// ResolvePath returns the first of paths matching the hop string s, see ParsePath
+func ResolvePath(s string, paths []snet.Path) (snet.Path, error) {
+	pp, err := ParsePath(s)
+	if err != nil {
+		return nil, err
+	}
+	matching := pp.Filter(paths)
+	if len(matching) == 0 {
+		return nil, ErrNoMatchingPath
+	}
+	return matching[0], nil
+}
@@ -0,0 +1,66 @@
+package lookup
+
+import (
+	"testing"
+
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+func Test_ParsePath(t *testing.T) {
+	path := testutil.Path("1-ff00:0:110", 1, "1-ff00:0:111", 2, "1-ff00:0:111", 3, "1-ff00:0:112", 4)
+	other := testutil.Path("1-ff00:0:110", 2, "1-ff00:0:112", 5)
+	paths := []snet.Path{other, path}
+
+	t.Run("ParsePath Inverts PathToString", func(t *testing.T) {
+		s := PathToString(path)
+		pp, err := ParsePath(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pp.String() != s {
+			t.Errorf("Expected %s, got %s", s, pp)
+		}
+		fp, ok := pp.Fingerprint()
+		if !ok || fp != Fingerprint(path) {
+			t.Errorf("Expected fingerprint %q, got %q", Fingerprint(path), fp)
+		}
+		if !pp.Match(path) || pp.Match(other) {
+			t.Errorf("Expected %s to match %s only", s, path)
+		}
+	})
+
+	t.Run("ParsePath Accepts Other Formats", func(t *testing.T) {
+		for _, s := range []string{
+			"[ 0] Hops: [1-ff00:0:110 1>2 1-ff00:0:111 3>4 1-ff00:0:112] MTU: 1472 NextHop: 127.0.0.1:31002 Status: alive",
+			"1-ff00:0:110#1 1-ff00:0:111#2 1-ff00:0:111#3 1-ff00:0:112#4",
+			"[1-0 0>0 1-ff00:0:111 0>0 0-0]",
+		} {
+			p, err := ResolvePath(s, paths)
+			if err != nil {
+				t.Errorf("Expected %q to resolve, got %v", s, err)
+				continue
+			}
+			if Fingerprint(p) != Fingerprint(path) {
+				t.Errorf("Expected %q to resolve to %s, got %s", s, path, p)
+			}
+		}
+		if pp, _ := ParsePath("[1-0 0>0 1-ff00:0:111 0>0 0-0]"); len(pp.Filter(paths)) != 1 {
+			t.Error("Expected the wildcards to match one path")
+		}
+		if _, ok := (PathPredicate{{IA: testutil.MustIA("1-0"), Egress: 1}, {IA: testutil.MustIA("1-ff00:0:112"), Ingress: 5}}).Fingerprint(); ok {
+			t.Error("Expected no fingerprint for a wildcard")
+		}
+	})
+
+	t.Run("ParsePath Rejects Invalid Paths", func(t *testing.T) {
+		for _, s := range []string{"", "[1-ff00:0:110 1]", "[1-ff00:0:110 1>x 1-ff00:0:111]", "[1-ff00:0:110 1>2 1-ff00:0:111", "1-ff00:0:110#1"} {
+			if _, err := ParsePath(s); err == nil {
+				t.Errorf("Expected an error for %q", s)
+			}
+		}
+		if _, err := ResolvePath("[1-ff00:0:110 3>1 1-ff00:0:112]", paths); err != ErrNoMatchingPath {
+			t.Errorf("Expected ErrNoMatchingPath, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package lookup
+
+import (
+	"time"
+
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/slayers/path"
+	"github.com/scionproto/scion/go/lib/snet"
+	snetpath "github.com/scionproto/scion/go/lib/snet/path"
+	"github.com/scionproto/scion/go/lib/spath"
+)
+
+// PathRecord holds everything of a snet.Path the selections use in a form
+// that can be serialized, e.g. to log paths or pass them between processes
+type PathRecord struct {
+	Fingerprint  PathFingerprint       `json:"fingerprint"`
+	Destination  addr.IA               `json:"destination"`
+	Raw          []byte                `json:"raw,omitempty"`
+	Type         path.Type             `json:"type,omitempty"`
+	Interfaces   []snet.PathInterface  `json:"interfaces,omitempty"`
+	MTU          uint16                `json:"mtu"`
+	Expiry       time.Time             `json:"expiry"`
+	Latency      []time.Duration       `json:"latency,omitempty"`
+	Bandwidth    []uint64              `json:"bandwidth,omitempty"`
+	Geo          []snet.GeoCoordinates `json:"geo,omitempty"`
+	LinkType     []snet.LinkType       `json:"linkType,omitempty"`
+	InternalHops []uint32              `json:"internalHops,omitempty"`
+	Notes        []string              `json:"notes,omitempty"`
+}
+
+func NewPathRecord(p snet.Path) PathRecord {
+	r := PathRecord{Destination: p.Destination()}
+	sp := p.Path()
+	if sp.Raw != nil {
+		r.Raw = append([]byte(nil), sp.Raw...)
+	}
+	r.Type = sp.Type
+	if meta := p.Metadata(); meta != nil {
+		r.Fingerprint = Fingerprint(p)
+		r.Interfaces = meta.Interfaces
+		r.MTU = meta.MTU
+		r.Expiry = meta.Expiry
+		r.Latency = meta.Latency
+		r.Bandwidth = meta.Bandwidth
+		r.Geo = meta.Geo
+		r.LinkType = meta.LinkType
+		r.InternalHops = meta.InternalHops
+		r.Notes = meta.Notes
+	}
+	return r
+}
+
+// SnetPath returns a path with the recorded metadata and raw path.
+// It can be compared and selected, but not used to send packets,
+// since the next hop is not recorded
+func (p PathRecord) SnetPath() snet.Path {
+	return snetpath.Path{
+		Dst:   p.Destination,
+		SPath: spath.Path{Raw: p.Raw, Type: p.Type},
+		Meta: snet.PathMetadata{
+			Interfaces:   p.Interfaces,
+			MTU:          p.MTU,
+			Expiry:       p.Expiry,
+			Latency:      p.Latency,
+			Bandwidth:    p.Bandwidth,
+			Geo:          p.Geo,
+			LinkType:     p.LinkType,
+			InternalHops: p.InternalHops,
+			Notes:        p.Notes,
+		},
+	}
+}
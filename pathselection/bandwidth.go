@@ -1,5 +1,62 @@
 package pathselection
 
+import (
+	"sort"
+
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// DeclaredBandwidth returns the bottleneck bandwidth of p in bytes/s, i.e. the
+// minimum of the hop bandwidths announced by the ASes. Hops without announced
+// bandwidth are skipped, false is returned if no hop announced one
+func DeclaredBandwidth(p snet.Path) (int64, bool) {
+	if p == nil || p.Metadata() == nil {
+		return 0, false
+	}
+	var bottleneck uint64
+	for _, kbits := range p.Metadata().Bandwidth {
+		if kbits > 0 && (bottleneck == 0 || kbits < bottleneck) {
+			bottleneck = kbits
+		}
+	}
+	if bottleneck == 0 {
+		return 0, false
+	}
+	// Announced in Kbit/s, measured in bytes/s
+	return int64(bottleneck * 1000 / 8), true
+}
+
+// BandwidthEstimator estimates the bandwidth of paths before and while traffic
+// flows over them. Without measurements, the declared bandwidth is used. Each
+// metrics interval with traffic shifts the estimate towards the measured
+// MaxBandwidth, after Warmup intervals only the measurement counts.
+// A Warmup of 0 ignores the declared bandwidth
+type BandwidthEstimator struct {
+	Warmup int
+}
+
+// DefaultBandwidthEstimator is used to rank paths by GetPathHighBandwidth
+var DefaultBandwidthEstimator = &BandwidthEstimator{Warmup: 10}
+
+// Estimate returns the estimated bandwidth of the path of pq in bytes/s
+func (e *BandwidthEstimator) Estimate(pq *PathQuality) int64 {
+	declared, ok := DeclaredBandwidth(pq.SnetPath)
+	if !ok {
+		return pq.MaxBandwidth
+	}
+	if e.Warmup <= 0 || pq.BandwidthSamples >= e.Warmup {
+		return pq.MaxBandwidth
+	}
+	weight := float64(pq.BandwidthSamples) / float64(e.Warmup)
+	return int64((1-weight)*float64(declared) + weight*float64(pq.MaxBandwidth))
+}
+
+// EstimatedBandwidth returns the bandwidth of the path estimated by the
+// DefaultBandwidthEstimator in bytes/s
+func (pq *PathQuality) EstimatedBandwidth() int64 {
+	return DefaultBandwidthEstimator.Estimate(pq)
+}
+
 type byBandwidth []PathQuality
 
 func (pathSet byBandwidth) Len() int {
@@ -7,15 +64,17 @@ func (pathSet byBandwidth) Len() int {
 }
 
 func (pathSet byBandwidth) Swap(i, j int) {
-	pathSet[i].Path, pathSet[j].Path = pathSet[j].Path, pathSet[i].Path
+	pathSet[i], pathSet[j] = pathSet[j], pathSet[i]
 }
 
+// Highest estimated bandwidth first
 func (pathSet byBandwidth) Less(i, j int) bool {
-	return pathSet[i].MaxBandwidth < pathSet[j].MaxBandwidth
-
+	return pathSet[i].EstimatedBandwidth() > pathSet[j].EstimatedBandwidth()
 }
 
-// GetPathHighBandwidth Select the shortest paths from given path array
+// GetPathHighBandwidth Select the paths with the highest estimated bandwidth.
+// Paths without traffic so far are ranked by their declared bandwidth
 func (pathSet *PathSet) GetPathHighBandwidth(number int) *PathSet {
+	sort.Stable(byBandwidth(pathSet.Paths))
 	return SelectPaths(number, pathSet)
 }
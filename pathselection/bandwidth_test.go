@@ -0,0 +1,61 @@
+package pathselection
+
+import (
+	"testing"
+
+	"github.com/netsys-lab/scion-path-discovery/packets"
+)
+
+func Test_BandwidthEstimator(t *testing.T) {
+	fast := testPath("1-ff00:0:111", zurich, []uint64{100000, 0, 80000})
+	slow := testPath("1-ff00:0:113", zurich, []uint64{10000, 0, 1000000})
+	unannounced := testPath("1-ff00:0:114", zurich, []uint64{0, 0, 0})
+
+	t.Run("Declared Bandwidth", func(t *testing.T) {
+		if bw, ok := DeclaredBandwidth(fast); !ok || bw != 80000*1000/8 {
+			t.Errorf("Expected the bottleneck of 80 Mbit/s in bytes/s, got %d", bw)
+		}
+		if _, ok := DeclaredBandwidth(unannounced); ok {
+			t.Errorf("Expected no declared bandwidth without announcements")
+		}
+	})
+
+	t.Run("Cold Start", func(t *testing.T) {
+		ps := pathSetOf(unannounced, slow, fast)
+		expectVia(t, ps.GetPathHighBandwidth(3), "1-ff00:0:111", "1-ff00:0:113", "1-ff00:0:114")
+	})
+
+	t.Run("Blend With Measurements", func(t *testing.T) {
+		e := &BandwidthEstimator{Warmup: 4}
+		declared, _ := DeclaredBandwidth(fast)
+		pq := PathQuality{SnetPath: fast, MaxBandwidth: 1000}
+		if bw := e.Estimate(&pq); bw != declared {
+			t.Errorf("Expected the declared bandwidth without samples, got %d", bw)
+		}
+		pq.BandwidthSamples = 2
+		if bw := e.Estimate(&pq); bw != (declared+1000)/2 {
+			t.Errorf("Expected the mean of declared and measured bandwidth, got %d", bw)
+		}
+		pq.BandwidthSamples = 4
+		if bw := e.Estimate(&pq); bw != 1000 {
+			t.Errorf("Expected the measured bandwidth after the warmup, got %d", bw)
+		}
+	})
+
+	t.Run("Measurements Override Declarations", func(t *testing.T) {
+		ps := pathSetOf(slow, fast)
+		ps.Paths[1].MaxBandwidth = 500000
+		ps.Paths[1].BandwidthSamples = DefaultBandwidthEstimator.Warmup
+		expectVia(t, ps.GetPathHighBandwidth(2), "1-ff00:0:113", "1-ff00:0:111")
+	})
+
+	t.Run("Traffic Samples", func(t *testing.T) {
+		m := packets.PathMetrics{
+			ReadBandwidth:    []int64{0, 100, 0, 0},
+			WrittenBandwidth: []int64{0, 0, 200},
+		}
+		if samples := trafficSamples(&m); samples != 2 {
+			t.Errorf("Expected 2 intervals with traffic, got %d", samples)
+		}
+	})
+}
@@ -0,0 +1,288 @@
+package pathselection
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+const (
+	defaultBottleneckWindow     = 30
+	defaultBottleneckMinSamples = 10
+	defaultBottleneckThreshold  = 0.5
+)
+
+// Weights of the signals in the similarity of two paths. Queueing delay
+// is the most reliable signal of a shared bottleneck, losses are rare
+// and bandwidth also changes with the application's sending behaviour
+const (
+	rttWeight       = 0.5
+	lossWeight      = 0.25
+	bandwidthWeight = 0.25
+)
+
+// BottleneckDetector determines which paths share a bottleneck from the
+// measured metrics of their conns instead of their interfaces. It keeps a
+// time series of bandwidth, RTT and losses per path and correlates the
+// changes of these series between each pair of paths. Paths behind the
+// same bottleneck see queueing delay and losses rise and fall together,
+// and their bandwidth is either coupled by common cross traffic or
+// anti-correlated because they compete for the same capacity.
+// RTT and losses are only available for conns that measure them,
+// e.g. socket.ReliableConn, otherwise bandwidth is used alone
+type BottleneckDetector struct {
+	// Number of samples per path that are correlated
+	Window int
+	// Number of common samples required before two paths are compared
+	MinSamples int
+	// Similarity in [0, 1] above which two paths share a bottleneck
+	Threshold float64
+
+	mutex  sync.Mutex
+	series map[lookup.PathFingerprint]*pathSeries
+	// Number of calls to Observe, used to align the series
+	round int
+}
+
+type pathSeries struct {
+	// Round of the first sample, samples are consecutive from there
+	start     int
+	bandwidth []float64
+	rtt       []float64
+	loss      []float64
+	lastLost  int64
+}
+
+func NewBottleneckDetector() *BottleneckDetector {
+	return &BottleneckDetector{
+		Window:     defaultBottleneckWindow,
+		MinSamples: defaultBottleneckMinSamples,
+		Threshold:  defaultBottleneckThreshold,
+		series:     make(map[lookup.PathFingerprint]*pathSeries),
+	}
+}
+
+// Returns the fingerprint of path, or "" if it has no metadata
+func fingerprintOf(path *snet.Path) lookup.PathFingerprint {
+	if path == nil {
+		return ""
+	}
+	return lookup.Fingerprint(*path)
+}
+
+// Observe records one sample per path, it has to be called once per
+// metrics interval after the metrics were updated. Paths missing in
+// a round start a new series the next time they are observed
+func (d *BottleneckDetector) Observe(metrics []*packets.PathMetrics) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.round++
+
+	for _, m := range metrics {
+		fp := fingerprintOf(m.Path)
+		if fp == "" {
+			continue
+		}
+
+		s, ok := d.series[fp]
+		if ok && s.start+len(s.bandwidth) == d.round {
+			// Several conns over the same path, the first one is used
+			continue
+		}
+		if !ok || s.start+len(s.bandwidth) != d.round-1 {
+			s = &pathSeries{start: d.round - 1, lastLost: m.LostPackets}
+			d.series[fp] = s
+		}
+
+		var bw int64
+		if len(m.WrittenBandwidth) > 0 {
+			bw += m.WrittenBandwidth[len(m.WrittenBandwidth)-1]
+		}
+		if len(m.ReadBandwidth) > 0 {
+			bw += m.ReadBandwidth[len(m.ReadBandwidth)-1]
+		}
+		s.bandwidth = append(s.bandwidth, float64(bw))
+		s.rtt = append(s.rtt, float64(m.RTT))
+		s.loss = append(s.loss, float64(m.LostPackets-s.lastLost))
+		s.lastLost = m.LostPackets
+
+		if len(s.bandwidth) > d.Window {
+			drop := len(s.bandwidth) - d.Window
+			s.bandwidth = s.bandwidth[drop:]
+			s.rtt = s.rtt[drop:]
+			s.loss = s.loss[drop:]
+			s.start += drop
+		}
+	}
+}
+
+// Removes the samples of a path, e.g. after it was not used for a while
+func (d *BottleneckDetector) Forget(fp lookup.PathFingerprint) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.series, fp)
+}
+
+// Similarity returns how likely a and b share a bottleneck in [0, 1].
+// The second return value is false if there are not enough common samples
+func (d *BottleneckDetector) Similarity(a, b lookup.PathFingerprint) (float64, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.similarity(a, b)
+}
+
+func (d *BottleneckDetector) similarity(a, b lookup.PathFingerprint) (float64, bool) {
+	sa, okA := d.series[a]
+	sb, okB := d.series[b]
+	if !okA || !okB {
+		return 0, false
+	}
+
+	// Align both series to their common rounds
+	start := sa.start
+	if sb.start > start {
+		start = sb.start
+	}
+	end := sa.start + len(sa.bandwidth)
+	if e := sb.start + len(sb.bandwidth); e < end {
+		end = e
+	}
+	if end-start < d.MinSamples {
+		return 0, false
+	}
+	window := func(s *pathSeries, values []float64) []float64 {
+		return values[start-s.start : end-s.start]
+	}
+
+	var score, weights float64
+	add := func(weight float64, x, y []float64, signed bool) {
+		c, ok := correlation(differences(x), differences(y))
+		if !ok {
+			return
+		}
+		if signed {
+			c = math.Max(c, 0)
+		} else {
+			c = math.Abs(c)
+		}
+		score += weight * c
+		weights += weight
+	}
+	add(rttWeight, window(sa, sa.rtt), window(sb, sb.rtt), true)
+	add(lossWeight, window(sa, sa.loss), window(sb, sb.loss), true)
+	add(bandwidthWeight, window(sa, sa.bandwidth), window(sb, sb.bandwidth), false)
+
+	if weights == 0 {
+		return 0, false
+	}
+	return score / weights, true
+}
+
+// SharesBottleneck returns whether a and b share a bottleneck according
+// to the measurements. The second return value is false if this is unknown
+func (d *BottleneckDetector) SharesBottleneck(a, b lookup.PathFingerprint) (bool, bool) {
+	s, ok := d.Similarity(a, b)
+	if !ok {
+		return false, false
+	}
+	return s >= d.Threshold, true
+}
+
+// Groups returns the observed paths grouped by shared bottleneck.
+// Sharing is transitive, paths without enough samples or without a
+// shared bottleneck form their own group. Groups and their
+// fingerprints are sorted to make the result deterministic
+func (d *BottleneckDetector) Groups() [][]lookup.PathFingerprint {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	fps := make([]lookup.PathFingerprint, 0, len(d.series))
+	for fp := range d.series {
+		fps = append(fps, fp)
+	}
+	sort.Slice(fps, func(i, j int) bool { return fps[i] < fps[j] })
+
+	parent := make([]int, len(fps))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range fps {
+		for j := i + 1; j < len(fps); j++ {
+			s, ok := d.similarity(fps[i], fps[j])
+			if ok && s >= d.Threshold {
+				ri, rj := find(i), find(j)
+				if ri < rj {
+					parent[rj] = ri
+				} else {
+					parent[ri] = rj
+				}
+			}
+		}
+	}
+
+	// Roots are the smallest index of their group, so groups
+	// are created in the order of their first fingerprint
+	groups := make([][]lookup.PathFingerprint, 0)
+	index := make(map[int]int)
+	for i, fp := range fps {
+		root := find(i)
+		g, ok := index[root]
+		if !ok {
+			g = len(groups)
+			index[root] = g
+			groups = append(groups, make([]lookup.PathFingerprint, 0))
+		}
+		groups[g] = append(groups[g], fp)
+	}
+	return groups
+}
+
+func differences(values []float64) []float64 {
+	if len(values) < 2 {
+		return nil
+	}
+	diffs := make([]float64, len(values)-1)
+	for i := range diffs {
+		diffs[i] = values[i+1] - values[i]
+	}
+	return diffs
+}
+
+// Pearson correlation of x and y, false if one of them is constant
+func correlation(x, y []float64) (float64, bool) {
+	n := len(x)
+	if n < 2 || n != len(y) {
+		return 0, false
+	}
+	var meanX, meanY float64
+	for i := range x {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= float64(n)
+	meanY /= float64(n)
+
+	var cov, varX, varY float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0, false
+	}
+	return cov / math.Sqrt(varX*varY), true
+}
@@ -0,0 +1,229 @@
+package pathselection
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// Mutually uncorrelated changes with zero mean
+var (
+	alternating = []float64{1, -1, 1, -1}
+	rising      = []float64{1, 1, -1, -1}
+	inner       = []float64{1, -1, -1, 1}
+)
+
+// Series starting at 10 that changes by diffs
+func seriesOf(diffs []float64) []float64 {
+	values := []float64{10}
+	for _, d := range diffs {
+		values = append(values, values[len(values)-1]+d)
+	}
+	return values
+}
+
+func negated(values []float64) []float64 {
+	n := make([]float64, len(values))
+	for i, v := range values {
+		n[i] = 20 - v
+	}
+	return n
+}
+
+// Path from 1-ff00:0:110 to 1-ff00:0:11i, fingerprints are ordered by i
+func bottleneckPath(i int) snet.Path {
+	return testutil.Path("1-ff00:0:110", i, fmt.Sprintf("1-ff00:0:11%d", i), 1)
+}
+
+// Metrics of one interval with the passed RTT in ms, written bandwidth
+// and number of packets lost so far
+func intervalMetrics(path snet.Path, rtt, bandwidth float64, lost int64) *packets.PathMetrics {
+	return &packets.PathMetrics{
+		Path:             &path,
+		RTT:              time.Duration(rtt * float64(time.Millisecond)),
+		WrittenBandwidth: []int64{int64(bandwidth)},
+		LostPackets:      lost,
+	}
+}
+
+// RTT and bandwidth series of a path, a nil bandwidth is constant
+type observedPath struct {
+	path      snet.Path
+	rtt       []float64
+	bandwidth []float64
+}
+
+// Observes the series of the paths, one round per sample. Series
+// may be shorter than others, their paths are missing in later rounds
+func observeAll(d *BottleneckDetector, paths ...observedPath) {
+	rounds := 0
+	for _, p := range paths {
+		if len(p.rtt) > rounds {
+			rounds = len(p.rtt)
+		}
+	}
+	for r := 0; r < rounds; r++ {
+		metrics := make([]*packets.PathMetrics, 0)
+		for _, p := range paths {
+			if r >= len(p.rtt) {
+				continue
+			}
+			bw := 0.0
+			if p.bandwidth != nil {
+				bw = p.bandwidth[r]
+			}
+			metrics = append(metrics, intervalMetrics(p.path, p.rtt[r], bw, 0))
+		}
+		d.Observe(metrics)
+	}
+}
+
+func testDetector(minSamples int) *BottleneckDetector {
+	d := NewBottleneckDetector()
+	d.MinSamples = minSamples
+	return d
+}
+
+func Test_BottleneckDetector(t *testing.T) {
+	a, b, c, e := bottleneckPath(1), bottleneckPath(2), bottleneckPath(3), bottleneckPath(4)
+	fpA, fpB, fpC, fpE := lookup.Fingerprint(a), lookup.Fingerprint(b), lookup.Fingerprint(c), lookup.Fingerprint(e)
+
+	t.Run("Correlation", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			x, y     []float64
+			expected float64
+			ok       bool
+		}{
+			{"Correlated", []float64{1, 2, 3}, []float64{2, 4, 6}, 1, true},
+			{"Anti-Correlated", []float64{1, 2, 3}, []float64{3, 2, 1}, -1, true},
+			{"Uncorrelated", alternating, rising, 0, true},
+			{"Constant", []float64{1, 2, 3}, []float64{5, 5, 5}, 0, false},
+			{"Different Lengths", []float64{1, 2, 3}, []float64{1, 2}, 0, false},
+			{"Single Value", []float64{1}, []float64{1}, 0, false},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				corr, ok := correlation(tc.x, tc.y)
+				if ok != tc.ok || math.Abs(corr-tc.expected) > 1e-9 {
+					t.Errorf("Expected %v (%v), got %v (%v)", tc.expected, tc.ok, corr, ok)
+				}
+			})
+		}
+		if differences([]float64{3}) != nil {
+			t.Errorf("Expected no differences of a single value")
+		}
+	})
+
+	t.Run("Observe Aligns Series", func(t *testing.T) {
+		d := NewBottleneckDetector()
+		d.Window = 4
+		d.Observe([]*packets.PathMetrics{intervalMetrics(a, 1, 0, 5), intervalMetrics(b, 1, 0, 0)})
+		// The second conn over a is ignored
+		d.Observe([]*packets.PathMetrics{intervalMetrics(a, 2, 0, 8), intervalMetrics(a, 9, 0, 9), intervalMetrics(b, 1, 0, 0)})
+		// b is missing in the third round and starts a new series in the fourth
+		d.Observe([]*packets.PathMetrics{intervalMetrics(a, 3, 0, 8)})
+		d.Observe([]*packets.PathMetrics{intervalMetrics(a, 4, 0, 10), intervalMetrics(b, 1, 0, 0)})
+		d.Observe([]*packets.PathMetrics{intervalMetrics(a, 5, 0, 10), intervalMetrics(b, 1, 0, 0)})
+
+		sa, sb := d.series[fpA], d.series[fpB]
+		if sa.start != 1 || fmt.Sprint(sa.rtt) != fmt.Sprint([]float64{2e6, 3e6, 4e6, 5e6}) {
+			t.Errorf("Expected the last 4 RTTs of a from round 1, got %v from %d", sa.rtt, sa.start)
+		}
+		if fmt.Sprint(sa.loss) != fmt.Sprint([]float64{3, 0, 2, 0}) {
+			t.Errorf("Expected the losses of each interval, got %v", sa.loss)
+		}
+		if sb.start != 3 || len(sb.rtt) != 2 {
+			t.Errorf("Expected b to restart in round 3, got %d samples from %d", len(sb.rtt), sb.start)
+		}
+	})
+
+	t.Run("Similarity Window", func(t *testing.T) {
+		// b joins later, so only the last 5 samples of a are common. Correlated with
+		// the first 5 samples of a instead, the similarity would be 0
+		rtt := []float64{1, 5, 2, 6, 1, 9, 3, 8}
+		d := testDetector(5)
+		for _, v := range rtt[:3] {
+			d.Observe([]*packets.PathMetrics{intervalMetrics(a, v, 0, 0)})
+		}
+		for _, v := range rtt[3:] {
+			d.Observe([]*packets.PathMetrics{intervalMetrics(a, v, 0, 0), intervalMetrics(b, v, 0, 0)})
+		}
+		if s, ok := d.Similarity(fpA, fpB); !ok || math.Abs(s-1) > 1e-9 {
+			t.Errorf("Expected the common rounds to be compared, got %v (%v)", s, ok)
+		}
+		d.MinSamples = 6
+		if _, ok := d.Similarity(fpA, fpB); ok {
+			t.Errorf("Expected too few common samples")
+		}
+	})
+
+	t.Run("Shared Bottlenecks", func(t *testing.T) {
+		flat := seriesOf([]float64{0, 0, 0, 0})
+		cases := []struct {
+			name   string
+			a, b   observedPath
+			shared bool
+			known  bool
+		}{
+			{"Correlated RTT", observedPath{a, seriesOf(alternating), nil}, observedPath{b, seriesOf(alternating), nil}, true, true},
+			{"Anti-Correlated RTT", observedPath{a, seriesOf(alternating), nil}, observedPath{b, negated(seriesOf(alternating)), nil}, false, true},
+			{"Uncorrelated RTT", observedPath{a, seriesOf(alternating), nil}, observedPath{b, seriesOf(rising), nil}, false, true},
+			// Paths competing for the same capacity
+			{"Anti-Correlated Bandwidth", observedPath{a, flat, seriesOf(rising)}, observedPath{b, flat, negated(seriesOf(rising))}, true, true},
+			{"Too Few Samples", observedPath{a, seriesOf(alternating), nil}, observedPath{b, seriesOf(alternating)[:2], nil}, false, false},
+			{"Constant", observedPath{a, flat, nil}, observedPath{b, seriesOf(alternating), nil}, false, false},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				d := testDetector(5)
+				observeAll(d, tc.a, tc.b)
+				shared, known := d.SharesBottleneck(fpA, fpB)
+				if shared != tc.shared || known != tc.known {
+					t.Errorf("Expected shared=%v known=%v, got %v %v", tc.shared, tc.known, shared, known)
+				}
+			})
+		}
+
+		// A path missing in a round is compared on its new series only
+		d := testDetector(3)
+		values := seriesOf(alternating)
+		for i, v := range values {
+			metrics := []*packets.PathMetrics{intervalMetrics(a, v, 0, 0)}
+			if i != 1 {
+				metrics = append(metrics, intervalMetrics(b, v, 0, 0))
+			}
+			d.Observe(metrics)
+		}
+		if shared, known := d.SharesBottleneck(fpA, fpB); !shared || !known {
+			t.Errorf("Expected the 3 samples after the gap to be compared, got %v %v", shared, known)
+		}
+	})
+
+	t.Run("Groups", func(t *testing.T) {
+		d := testDetector(5)
+		d.Threshold = 0.3
+		// a and b share the RTT, b and c the bandwidth, a and c nothing.
+		// Sharing is transitive, so all three form one group
+		observeAll(d,
+			observedPath{a, seriesOf(alternating), seriesOf(rising)},
+			observedPath{b, seriesOf(alternating), seriesOf(inner)},
+			observedPath{c, seriesOf(rising), seriesOf(inner)},
+			observedPath{e, seriesOf(inner), seriesOf(alternating)},
+			observedPath{bottleneckPath(5), seriesOf(alternating)[:3], nil},
+		)
+		if shared, _ := d.SharesBottleneck(fpA, fpC); shared {
+			t.Fatalf("Expected a and c not to share a bottleneck directly")
+		}
+		expected := [][]lookup.PathFingerprint{{fpA, fpB, fpC}, {fpE}, {lookup.Fingerprint(bottleneckPath(5))}}
+		if groups := d.Groups(); fmt.Sprint(groups) != fmt.Sprint(expected) {
+			t.Errorf("Expected groups %v, got %v", expected, groups)
+		}
+	})
+}
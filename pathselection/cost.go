@@ -0,0 +1,177 @@
+package pathselection
+
+import (
+	"sort"
+
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// LinkTypeCosts assigns a cost to each announced link type
+type LinkTypeCosts map[snet.LinkType]float64
+
+// DefaultLinkTypeCosts prefers direct links over multihop links over links
+// through the open internet. Links without announced type are treated like
+// open internet links
+var DefaultLinkTypeCosts = LinkTypeCosts{
+	snet.LinkTypeDirect:   0,
+	snet.LinkTypeMultihop: 1,
+	snet.LinkTypeOpennet:  2,
+	snet.LinkTypeUnset:    2,
+}
+
+// LinkTypeCost returns the sum of the costs of the inter-domain links of p.
+// nil costs use DefaultLinkTypeCosts
+func LinkTypeCost(p snet.Path, costs LinkTypeCosts) float64 {
+	if costs == nil {
+		costs = DefaultLinkTypeCosts
+	}
+	interfaces := interfacesOf(p)
+	if len(interfaces) == 0 {
+		return 0
+	}
+	linkTypes := p.Metadata().LinkType
+	cost := 0.0
+	for i := 0; i < len(interfaces)/2; i++ {
+		linkType := snet.LinkTypeUnset
+		if i < len(linkTypes) {
+			linkType = linkTypes[i]
+		}
+		cost += costs[linkType]
+	}
+	return cost
+}
+
+// FilterLinkTypes returns the paths whose inter-domain links all have one of
+// the types, like the LinkTypes of the lookup.LookupOptions
+func (pathSet *PathSet) FilterLinkTypes(types ...snet.LinkType) *PathSet {
+	opts := &lookup.LookupOptions{LinkTypes: types}
+	return pathSet.filter(opts.Match)
+}
+
+// GetPathLinkType Select the paths with the lowest DefaultLinkTypeCosts
+func (pathSet *PathSet) GetPathLinkType(number int) *PathSet {
+	sort.SliceStable(pathSet.Paths, func(i, j int) bool {
+		return LinkTypeCost(pathSet.Paths[i].SnetPath, nil) < LinkTypeCost(pathSet.Paths[j].SnetPath, nil)
+	})
+	return SelectPaths(number, pathSet)
+}
+
+// ASCostFunc returns the cost of traversing an AS, e.g. its carbon intensity
+type ASCostFunc func(addr.IA) float64
+
+// ASCostTable holds the costs of ASes. An AS without entry has the cost of its
+// ISD, i.e. the entry with AS 0, or the entry 0-0 as default. Its Cost method
+// can be passed as ASCostFunc
+type ASCostTable map[addr.IA]float64
+
+func (t ASCostTable) Cost(ia addr.IA) float64 {
+	if cost, ok := t[ia]; ok {
+		return cost
+	}
+	if cost, ok := t[addr.IA{I: ia.I}]; ok {
+		return cost
+	}
+	return t[addr.IA{}]
+}
+
+// Returns the ASes a path traverses, each once and in path order
+func asesOf(p snet.Path) []addr.IA {
+	interfaces := interfacesOf(p)
+	ases := make([]addr.IA, 0, len(interfaces)/2+1)
+	for _, i := range interfaces {
+		if len(ases) == 0 || ases[len(ases)-1] != i.IA {
+			ases = append(ases, i.IA)
+		}
+	}
+	return ases
+}
+
+// PathCost returns the sum of the costs of all ASes on p
+func PathCost(p snet.Path, cost ASCostFunc) float64 {
+	total := 0.0
+	for _, ia := range asesOf(p) {
+		total += cost(ia)
+	}
+	return total
+}
+
+// GetPathLowCost Select the paths with the lowest sum of AS costs
+func (pathSet *PathSet) GetPathLowCost(number int, cost ASCostFunc) *PathSet {
+	sort.SliceStable(pathSet.Paths, func(i, j int) bool {
+		return PathCost(pathSet.Paths[i].SnetPath, cost) < PathCost(pathSet.Paths[j].SnetPath, cost)
+	})
+	return SelectPaths(number, pathSet)
+}
+
+// MetadataSelection is a CustomPathSelection that filters and ranks paths by
+// their announced metadata only, so it does not depend on measurements.
+// Paths are ranked by the weighted sum of their distance in 1000 km, their
+// LinkTypeCost and their PathCost. Zero weights disable a criterion
+type MetadataSelection struct {
+	// Number of paths to select, 0 selects all remaining paths
+	NumPaths int
+	// Paths traversing one of the regions are dropped
+	AvoidRegions []GeoRegion
+	// Drops paths with unknown router positions
+	RequireGeo bool
+	// Drops paths with other link types, empty allows all
+	LinkTypes []snet.LinkType
+	// Per-AS costs, e.g. ASCostTable.Cost
+	ASCost ASCostFunc
+
+	DistanceWeight float64
+	LinkTypeWeight float64
+	CostWeight     float64
+	// nil uses DefaultLinkTypeCosts
+	LinkTypeCosts LinkTypeCosts
+}
+
+// Score returns the rank of p, lower is better. Paths with unknown distance
+// are ranked by their other criteria
+func (m *MetadataSelection) Score(p snet.Path) float64 {
+	score := 0.0
+	if m.DistanceWeight != 0 {
+		if distance, ok := PathDistance(p); ok {
+			score += m.DistanceWeight * distance / 1000
+		}
+	}
+	if m.LinkTypeWeight != 0 {
+		score += m.LinkTypeWeight * LinkTypeCost(p, m.LinkTypeCosts)
+	}
+	if m.CostWeight != 0 && m.ASCost != nil {
+		score += m.CostWeight * PathCost(p, m.ASCost)
+	}
+	return score
+}
+
+func (m *MetadataSelection) CustomPathSelectAlg(pathSet *PathSet) (*PathSet, error) {
+	selected := pathSet.AvoidRegions(m.AvoidRegions...)
+	if m.RequireGeo {
+		selected = selected.filter(GeoComplete)
+	}
+	if len(m.LinkTypes) > 0 {
+		selected = selected.FilterLinkTypes(m.LinkTypes...)
+	}
+	// Paths with unknown distance come last, otherwise they would win
+	// just because their ASes did not announce positions
+	sort.SliceStable(selected.Paths, func(i, j int) bool {
+		pi, pj := selected.Paths[i].SnetPath, selected.Paths[j].SnetPath
+		if m.DistanceWeight != 0 {
+			_, okI := PathDistance(pi)
+			_, okJ := PathDistance(pj)
+			if okI != okJ {
+				return okI
+			}
+		}
+		return m.Score(pi) < m.Score(pj)
+	})
+	numPaths := m.NumPaths
+	if numPaths <= 0 {
+		numPaths = len(selected.Paths)
+	}
+	result := SelectPaths(numPaths, selected)
+	result.Address = pathSet.Address
+	return result, nil
+}
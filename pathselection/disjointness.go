@@ -0,0 +1,221 @@
+package pathselection
+
+import (
+	"sort"
+
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// A link between two ASes, identified by the interfaces on both ends
+// in a canonical order, so that both directions are the same link
+type pathLink [2]snet.PathInterface
+
+func lessInterface(a, b snet.PathInterface) bool {
+	if a.IA != b.IA {
+		return a.IA.IAInt() < b.IA.IAInt()
+	}
+	return a.ID < b.ID
+}
+
+func interfacesOf(p snet.Path) []snet.PathInterface {
+	if p == nil || p.Metadata() == nil {
+		return nil
+	}
+	return p.Metadata().Interfaces
+}
+
+// Interfaces of a path come in pairs, one pair per traversed link
+func linksOf(p snet.Path) []pathLink {
+	interfaces := interfacesOf(p)
+	links := make([]pathLink, 0, len(interfaces)/2)
+	for i := 0; i+1 < len(interfaces); i += 2 {
+		a, b := interfaces[i], interfaces[i+1]
+		if lessInterface(b, a) {
+			a, b = b, a
+		}
+		links = append(links, pathLink{a, b})
+	}
+	return links
+}
+
+// InterfaceConflicts returns the number of interfaces (IA and interface ID)
+// that both paths traverse
+func InterfaceConflicts(a, b snet.Path) int {
+	interfaces := make(map[snet.PathInterface]struct{})
+	for _, i := range interfacesOf(a) {
+		interfaces[i] = struct{}{}
+	}
+	conflicts := 0
+	for _, i := range interfacesOf(b) {
+		if _, ok := interfaces[i]; ok {
+			conflicts++
+			delete(interfaces, i)
+		}
+	}
+	return conflicts
+}
+
+// LinkConflicts returns the number of inter-AS links that both paths traverse
+func LinkConflicts(a, b snet.Path) int {
+	links := make(map[pathLink]struct{})
+	for _, l := range linksOf(a) {
+		links[l] = struct{}{}
+	}
+	conflicts := 0
+	for _, l := range linksOf(b) {
+		if _, ok := links[l]; ok {
+			conflicts++
+			delete(links, l)
+		}
+	}
+	return conflicts
+}
+
+// Disjointness holds the pairwise conflicts between a list of paths.
+// Paths are referenced by their index in Paths
+type Disjointness struct {
+	Paths              []snet.Path
+	interfaceConflicts [][]int
+	linkConflicts      [][]int
+}
+
+func NewDisjointness(paths []snet.Path) *Disjointness {
+	d := &Disjointness{
+		Paths:              paths,
+		interfaceConflicts: make([][]int, len(paths)),
+		linkConflicts:      make([][]int, len(paths)),
+	}
+	for i := range paths {
+		d.interfaceConflicts[i] = make([]int, len(paths))
+		d.linkConflicts[i] = make([]int, len(paths))
+		for j := range paths[:i] {
+			d.interfaceConflicts[i][j] = InterfaceConflicts(paths[i], paths[j])
+			d.interfaceConflicts[j][i] = d.interfaceConflicts[i][j]
+			d.linkConflicts[i][j] = LinkConflicts(paths[i], paths[j])
+			d.linkConflicts[j][i] = d.linkConflicts[i][j]
+		}
+	}
+	return d
+}
+
+// Number of interfaces shared by path i and j, 0 if i == j
+func (d *Disjointness) InterfaceConflicts(i, j int) int {
+	return d.interfaceConflicts[i][j]
+}
+
+// Number of links shared by path i and j, 0 if i == j
+func (d *Disjointness) LinkConflicts(i, j int) int {
+	return d.linkConflicts[i][j]
+}
+
+// SetConflicts overrides the conflicts between path i and j, e.g. with
+// the results of a BottleneckDetector. Conflicts of a path with itself
+// are not counted and cannot be set
+func (d *Disjointness) SetConflicts(i, j, interfaces, links int) {
+	if i == j {
+		return
+	}
+	d.interfaceConflicts[i][j], d.interfaceConflicts[j][i] = interfaces, interfaces
+	d.linkConflicts[i][j], d.linkConflicts[j][i] = links, links
+}
+
+// Interface and link conflicts between each pair of the passed paths
+func (d *Disjointness) Conflicts(indices []int) (int, int) {
+	interfaces, links := 0, 0
+	for k, i := range indices {
+		a, b := d.conflictsWith(i, indices[k+1:])
+		interfaces += a
+		links += b
+	}
+	return interfaces, links
+}
+
+// Number of interfaces path i shares with all other paths
+func (d *Disjointness) NumConflicts(i int) int {
+	sum := 0
+	for _, c := range d.interfaceConflicts[i] {
+		sum += c
+	}
+	return sum
+}
+
+// Interface and link conflicts of path i with the paths in selected
+func (d *Disjointness) conflictsWith(i int, selected []int) (int, int) {
+	interfaces, links := 0, 0
+	for _, j := range selected {
+		interfaces += d.interfaceConflicts[i][j]
+		links += d.linkConflicts[i][j]
+	}
+	return interfaces, links
+}
+
+// SelectDisjoint greedily selects k paths with as few conflicts between
+// them as possible and returns their indices in the order of selection.
+// It starts with the path that conflicts least with all others and adds
+// the path with the fewest interface conflicts with the selected ones.
+// Ties are broken by link conflicts, conflicts with all paths, hop count
+// and index, so the result is deterministic
+func (d *Disjointness) SelectDisjoint(k int) []int {
+	if k > len(d.Paths) {
+		k = len(d.Paths)
+	}
+	if k < 0 {
+		k = 0
+	}
+	selected := make([]int, 0, k)
+	used := make([]bool, len(d.Paths))
+	for len(selected) < k {
+		best := -1
+		var bestKey [4]int
+		for i := range d.Paths {
+			if used[i] {
+				continue
+			}
+			interfaces, links := d.conflictsWith(i, selected)
+			key := [4]int{interfaces, links, d.NumConflicts(i), len(interfacesOf(d.Paths[i]))}
+			if best == -1 || lessKey(key, bestKey) {
+				best = i
+				bestKey = key
+			}
+		}
+		used[best] = true
+		selected = append(selected, best)
+	}
+	return selected
+}
+
+func lessKey(a, b [4]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// Returns the paths selected by SelectDisjoint
+func (d *Disjointness) SelectDisjointPaths(k int) []snet.Path {
+	indices := d.SelectDisjoint(k)
+	paths := make([]snet.Path, len(indices))
+	for i, j := range indices {
+		paths[i] = d.Paths[j]
+	}
+	return paths
+}
+
+// Returns the indices of all paths ordered by their conflicts with all
+// other paths, fewest first. Ties are broken by hop count and index
+func (d *Disjointness) Ranking() []int {
+	ranking := make([]int, len(d.Paths))
+	for i := range ranking {
+		ranking[i] = i
+	}
+	sort.SliceStable(ranking, func(a, b int) bool {
+		i, j := ranking[a], ranking[b]
+		if d.NumConflicts(i) != d.NumConflicts(j) {
+			return d.NumConflicts(i) < d.NumConflicts(j)
+		}
+		return len(interfacesOf(d.Paths[i])) < len(interfacesOf(d.Paths[j]))
+	})
+	return ranking
+}
@@ -0,0 +1,121 @@
+package pathselection
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+func Test_Disjointness(t *testing.T) {
+	via111 := testutil.Path("1-ff00:0:110", 1, "1-ff00:0:111", 1, "1-ff00:0:111", 2, "1-ff00:0:113", 1)
+	via112 := testutil.Path("1-ff00:0:110", 2, "1-ff00:0:112", 1, "1-ff00:0:112", 2, "1-ff00:0:113", 2)
+	// Shares the first link with via111
+	via111And114 := testutil.Path("1-ff00:0:110", 1, "1-ff00:0:111", 1, "1-ff00:0:111", 3, "1-ff00:0:114", 1,
+		"1-ff00:0:114", 2, "1-ff00:0:113", 3)
+	// Shares an interface of via111, but over a different link
+	via116 := testutil.Path("1-ff00:0:110", 3, "1-ff00:0:116", 1, "1-ff00:0:116", 2, "1-ff00:0:111", 2)
+	reversed112 := testutil.Path("1-ff00:0:113", 2, "1-ff00:0:112", 2, "1-ff00:0:112", 1, "1-ff00:0:110", 2)
+
+	t.Run("Pairwise Conflicts", func(t *testing.T) {
+		cases := []struct {
+			name       string
+			a, b       snet.Path
+			interfaces int
+			links      int
+		}{
+			{"Disjoint", via111, via112, 0, 0},
+			{"Shared Link", via111, via111And114, 2, 1},
+			{"Interface Without Link", via111, via116, 1, 0},
+			{"Reversed Path", via112, reversed112, 4, 2},
+			{"Same Path", via111, via111, 4, 2},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				if n := InterfaceConflicts(c.a, c.b); n != c.interfaces {
+					t.Errorf("Expected %d interface conflicts, got %d", c.interfaces, n)
+				}
+				if n := LinkConflicts(c.a, c.b); n != c.links {
+					t.Errorf("Expected %d link conflicts, got %d", c.links, n)
+				}
+				if InterfaceConflicts(c.b, c.a) != c.interfaces || LinkConflicts(c.b, c.a) != c.links {
+					t.Errorf("Expected the same conflicts in both directions")
+				}
+			})
+		}
+	})
+
+	paths := []snet.Path{via111And114, via111, via112, via116}
+	d := NewDisjointness(paths)
+
+	t.Run("Matrix Excludes Self Pairs", func(t *testing.T) {
+		for i := range paths {
+			if d.InterfaceConflicts(i, i) != 0 || d.LinkConflicts(i, i) != 0 {
+				t.Errorf("Expected no conflicts of path %d with itself", i)
+			}
+		}
+		expected := []int{2, 3, 0, 1}
+		for i, n := range expected {
+			if d.NumConflicts(i) != n {
+				t.Errorf("Expected %d conflicts of path %d with the others, got %d", n, i, d.NumConflicts(i))
+			}
+		}
+	})
+
+	t.Run("Matrix Is Symmetric", func(t *testing.T) {
+		for i := range paths {
+			for j := range paths {
+				if d.InterfaceConflicts(i, j) != d.InterfaceConflicts(j, i) || d.LinkConflicts(i, j) != d.LinkConflicts(j, i) {
+					t.Errorf("Expected the same conflicts for (%d, %d) and (%d, %d)", i, j, j, i)
+				}
+				if i != j && d.InterfaceConflicts(i, j) != InterfaceConflicts(paths[i], paths[j]) {
+					t.Errorf("Expected the conflicts of the paths for (%d, %d)", i, j)
+				}
+			}
+		}
+		if interfaces, links := d.Conflicts([]int{0, 1, 3}); interfaces != 3 || links != 1 {
+			t.Errorf("Expected 3 interface and 1 link conflicts in the set, got %d and %d", interfaces, links)
+		}
+	})
+
+	t.Run("Greedy Selection", func(t *testing.T) {
+		cases := []struct {
+			k        int
+			expected []int
+		}{
+			{-1, []int{}},
+			{0, []int{}},
+			{1, []int{2}},
+			// Ties are broken by the conflicts with all paths, then by hop count
+			{2, []int{2, 3}},
+			{3, []int{2, 3, 0}},
+			{4, []int{2, 3, 0, 1}},
+			{5, []int{2, 3, 0, 1}},
+		}
+		for _, c := range cases {
+			t.Run(fmt.Sprintf("k=%d", c.k), func(t *testing.T) {
+				selected := d.SelectDisjoint(c.k)
+				if fmt.Sprint(selected) != fmt.Sprint(c.expected) {
+					t.Errorf("Expected %v, got %v", c.expected, selected)
+				}
+			})
+		}
+		if ranking := d.Ranking(); fmt.Sprint(ranking) != fmt.Sprint([]int{2, 3, 0, 1}) {
+			t.Errorf("Expected the ranking [2 3 0 1], got %v", ranking)
+		}
+	})
+
+	t.Run("Overridden Conflicts", func(t *testing.T) {
+		d := NewDisjointness(paths)
+		d.SetConflicts(1, 1, 5, 5)
+		d.SetConflicts(0, 1, 0, 0)
+		d.SetConflicts(2, 3, 1, 0)
+		if d.InterfaceConflicts(1, 1) != 0 || d.InterfaceConflicts(1, 0) != 0 || d.LinkConflicts(1, 0) != 0 {
+			t.Errorf("Expected the override to apply to both directions, but not to self pairs")
+		}
+		if selected := d.SelectDisjoint(2); fmt.Sprint(selected) != fmt.Sprint([]int{0, 1}) {
+			t.Errorf("Expected the paths without conflicts after the override, got %v", selected)
+		}
+	})
+}
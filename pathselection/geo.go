@@ -0,0 +1,146 @@
+package pathselection
+
+import (
+	"math"
+	"sort"
+
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+const earthRadiusKm = 6371.0
+
+// GreatCircleDistance returns the distance between a and b on the surface
+// of the earth in km
+func GreatCircleDistance(a, b snet.GeoCoordinates) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(b.Longitude) - radians(a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func radians(deg float32) float64 {
+	return float64(deg) * math.Pi / 180
+}
+
+// ASes that do not announce the position of a router leave the zero value
+func knownPosition(c snet.GeoCoordinates) bool {
+	return c.Latitude != 0 || c.Longitude != 0
+}
+
+// Returns the announced positions of the routers of a path, in path order
+func positionsOf(p snet.Path) []snet.GeoCoordinates {
+	if p == nil || p.Metadata() == nil {
+		return nil
+	}
+	positions := make([]snet.GeoCoordinates, 0, len(p.Metadata().Geo))
+	for _, c := range p.Metadata().Geo {
+		if knownPosition(c) {
+			positions = append(positions, c)
+		}
+	}
+	return positions
+}
+
+// GeoComplete returns whether all routers of p announced their position
+func GeoComplete(p snet.Path) bool {
+	interfaces := interfacesOf(p)
+	return len(interfaces) > 0 && len(positionsOf(p)) == len(interfaces)
+}
+
+// PathDistance returns the great-circle distance in km along the announced
+// router positions of p. Skipping a router would underestimate the distance,
+// so false is returned unless all routers announced their position
+func PathDistance(p snet.Path) (float64, bool) {
+	if !GeoComplete(p) {
+		return 0, false
+	}
+	positions := positionsOf(p)
+	distance := 0.0
+	for i := 1; i < len(positions); i++ {
+		distance += GreatCircleDistance(positions[i-1], positions[i])
+	}
+	return distance, true
+}
+
+// GeoRegion is an area paths can be required to avoid
+type GeoRegion interface {
+	Contains(snet.GeoCoordinates) bool
+}
+
+// GeoBox is the region between two latitudes and two longitudes in degrees.
+// Boxes with MinLongitude > MaxLongitude cross the antimeridian
+type GeoBox struct {
+	MinLatitude, MaxLatitude   float32
+	MinLongitude, MaxLongitude float32
+}
+
+func (b GeoBox) Contains(c snet.GeoCoordinates) bool {
+	if c.Latitude < b.MinLatitude || c.Latitude > b.MaxLatitude {
+		return false
+	}
+	if b.MinLongitude <= b.MaxLongitude {
+		return c.Longitude >= b.MinLongitude && c.Longitude <= b.MaxLongitude
+	}
+	return c.Longitude >= b.MinLongitude || c.Longitude <= b.MaxLongitude
+}
+
+// GeoCircle is the region within RadiusKm of Center
+type GeoCircle struct {
+	Center   snet.GeoCoordinates
+	RadiusKm float64
+}
+
+func (c GeoCircle) Contains(pos snet.GeoCoordinates) bool {
+	return GreatCircleDistance(c.Center, pos) <= c.RadiusKm
+}
+
+// TraversesRegion returns whether a router of p announced a position in one
+// of the regions. Routers without position are not considered
+func TraversesRegion(p snet.Path, regions ...GeoRegion) bool {
+	for _, pos := range positionsOf(p) {
+		for _, region := range regions {
+			if region.Contains(pos) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AvoidRegions returns the paths that do not traverse any of the regions.
+// Paths with unknown router positions are kept, use GeoComplete to drop them
+func (pathSet *PathSet) AvoidRegions(regions ...GeoRegion) *PathSet {
+	return pathSet.filter(func(p snet.Path) bool {
+		return !TraversesRegion(p, regions...)
+	})
+}
+
+// GetPathShortDistance Select the paths with the shortest great-circle distance
+// along their routers. Paths with unknown router positions come last
+func (pathSet *PathSet) GetPathShortDistance(number int) *PathSet {
+	sort.SliceStable(pathSet.Paths, func(i, j int) bool {
+		di, okI := PathDistance(pathSet.Paths[i].SnetPath)
+		dj, okJ := PathDistance(pathSet.Paths[j].SnetPath)
+		if okI != okJ {
+			return okI
+		}
+		return di < dj
+	})
+	return SelectPaths(number, pathSet)
+}
+
+// Returns a pathset to the same address holding the paths that match
+func (pathSet *PathSet) filter(match func(snet.Path) bool) *PathSet {
+	filtered := &PathSet{
+		Address: pathSet.Address,
+		Paths:   make([]PathQuality, 0, len(pathSet.Paths)),
+	}
+	for _, pq := range pathSet.Paths {
+		if match(pq.SnetPath) {
+			filtered.Paths = append(filtered.Paths, pq)
+		}
+	}
+	return filtered
+}
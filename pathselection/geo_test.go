@@ -0,0 +1,162 @@
+package pathselection
+
+import (
+	"math"
+	"testing"
+
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+var (
+	zurich    = snet.GeoCoordinates{Latitude: 47.37, Longitude: 8.54}
+	frankfurt = snet.GeoCoordinates{Latitude: 50.11, Longitude: 8.68}
+	newYork   = snet.GeoCoordinates{Latitude: 40.71, Longitude: -74.01}
+)
+
+// Returns a path from 1-ff00:0:110 over via to 1-ff00:0:112 with the
+// positions of the routers of via, the hop bandwidths in Kbit/s and the
+// link types of both links
+func testPath(via string, pos snet.GeoCoordinates, bandwidth []uint64, linkTypes ...snet.LinkType) snet.Path {
+	p := testutil.Path("1-ff00:0:110", 1, via, 2, via, 3, "1-ff00:0:112", 4)
+	p.Meta.Geo = []snet.GeoCoordinates{zurich, pos, pos, zurich}
+	p.Meta.Bandwidth = bandwidth
+	p.Meta.LinkType = linkTypes
+	return p
+}
+
+func pathSetOf(paths ...snet.Path) *PathSet {
+	ps := &PathSet{}
+	for _, p := range paths {
+		ps.Paths = append(ps.Paths, PathQuality{SnetPath: p, Id: string(lookup.Fingerprint(p))})
+	}
+	return ps
+}
+
+func selectedVia(ps *PathSet) []addr.IA {
+	via := make([]addr.IA, len(ps.Paths))
+	for i, pq := range ps.Paths {
+		via[i] = pq.SnetPath.Metadata().Interfaces[1].IA
+	}
+	return via
+}
+
+func expectVia(t *testing.T, ps *PathSet, expected ...string) {
+	t.Helper()
+	via := selectedVia(ps)
+	if len(via) != len(expected) {
+		t.Fatalf("Expected paths via %v, got %v", expected, via)
+	}
+	for i := range expected {
+		if via[i] != testutil.MustIA(expected[i]) {
+			t.Fatalf("Expected paths via %v, got %v", expected, via)
+		}
+	}
+}
+
+func Test_GeoSelection(t *testing.T) {
+	t.Run("Great Circle Distance", func(t *testing.T) {
+		d := GreatCircleDistance(zurich, newYork)
+		if math.Abs(d-6320) > 30 {
+			t.Errorf("Expected about 6320 km from Zurich to New York, got %.0f", d)
+		}
+		if GreatCircleDistance(zurich, zurich) != 0 {
+			t.Errorf("Expected no distance to the same position")
+		}
+	})
+
+	viaFrankfurt := testPath("1-ff00:0:111", frankfurt, nil)
+	viaNewYork := testPath("1-ff00:0:113", newYork, nil)
+	unknown := testPath("1-ff00:0:114", snet.GeoCoordinates{}, nil)
+
+	t.Run("Path Distance", func(t *testing.T) {
+		d, ok := PathDistance(viaFrankfurt)
+		expected := 2 * GreatCircleDistance(zurich, frankfurt)
+		if !ok || math.Abs(d-expected) > 1 {
+			t.Errorf("Expected distance %.0f, got %.0f (%v)", expected, d, ok)
+		}
+		if !GeoComplete(viaFrankfurt) || GeoComplete(unknown) {
+			t.Errorf("Expected only the path with all positions to be complete")
+		}
+	})
+
+	t.Run("Shortest Distance", func(t *testing.T) {
+		ps := pathSetOf(viaNewYork, unknown, viaFrankfurt)
+		expectVia(t, ps.GetPathShortDistance(3), "1-ff00:0:111", "1-ff00:0:113", "1-ff00:0:114")
+	})
+
+	t.Run("Avoid Regions", func(t *testing.T) {
+		northAmerica := GeoBox{MinLatitude: 15, MaxLatitude: 72, MinLongitude: -170, MaxLongitude: -50}
+		ps := pathSetOf(viaNewYork, unknown, viaFrankfurt)
+		expectVia(t, ps.AvoidRegions(northAmerica), "1-ff00:0:114", "1-ff00:0:111")
+
+		aroundFrankfurt := GeoCircle{Center: frankfurt, RadiusKm: 100}
+		expectVia(t, ps.AvoidRegions(northAmerica, aroundFrankfurt), "1-ff00:0:114")
+	})
+
+	t.Run("Box Across Antimeridian", func(t *testing.T) {
+		pacific := GeoBox{MinLatitude: -60, MaxLatitude: 60, MinLongitude: 150, MaxLongitude: -120}
+		if !pacific.Contains(snet.GeoCoordinates{Latitude: 21.3, Longitude: -157.8}) || pacific.Contains(zurich) {
+			t.Errorf("Expected the box to contain Honolulu but not Zurich")
+		}
+	})
+}
+
+func Test_CostSelection(t *testing.T) {
+	direct := testPath("1-ff00:0:111", frankfurt, nil, snet.LinkTypeDirect, snet.LinkTypeDirect)
+	opennet := testPath("1-ff00:0:113", newYork, nil, snet.LinkTypeDirect, snet.LinkTypeOpennet)
+	unannounced := testPath("1-ff00:0:114", snet.GeoCoordinates{}, nil)
+
+	t.Run("Link Types", func(t *testing.T) {
+		if LinkTypeCost(direct, nil) != 0 || LinkTypeCost(opennet, nil) != 2 || LinkTypeCost(unannounced, nil) != 4 {
+			t.Errorf("Unexpected link type costs")
+		}
+		ps := pathSetOf(unannounced, opennet, direct)
+		expectVia(t, ps.GetPathLinkType(2), "1-ff00:0:111", "1-ff00:0:113")
+		expectVia(t, pathSetOf(unannounced, opennet, direct).FilterLinkTypes(snet.LinkTypeDirect), "1-ff00:0:111")
+	})
+
+	table := ASCostTable{
+		testutil.MustIA("1-ff00:0:113"): 50,
+		testutil.MustIA("1-0"):          200,
+		testutil.MustIA("0-0"):          500,
+	}
+
+	t.Run("AS Cost Table", func(t *testing.T) {
+		if table.Cost(testutil.MustIA("1-ff00:0:113")) != 50 || table.Cost(testutil.MustIA("1-ff00:0:111")) != 200 ||
+			table.Cost(testutil.MustIA("2-ff00:0:210")) != 500 {
+			t.Errorf("Expected the costs of the AS, the ISD and the default")
+		}
+		if PathCost(direct, table.Cost) != 600 {
+			t.Errorf("Expected each of the 3 ASes to be counted once, got %v", PathCost(direct, table.Cost))
+		}
+		ps := pathSetOf(direct, opennet)
+		expectVia(t, ps.GetPathLowCost(1, table.Cost), "1-ff00:0:113")
+	})
+
+	t.Run("Metadata Selection", func(t *testing.T) {
+		ps := pathSetOf(unannounced, opennet, direct)
+		cases := []struct {
+			name      string
+			selection MetadataSelection
+			expected  []string
+		}{
+			{"Distance", MetadataSelection{DistanceWeight: 1}, []string{"1-ff00:0:111", "1-ff00:0:113", "1-ff00:0:114"}},
+			{"Require Geo", MetadataSelection{RequireGeo: true, AvoidRegions: []GeoRegion{GeoCircle{Center: frankfurt, RadiusKm: 100}}}, []string{"1-ff00:0:113"}},
+			{"Carbon", MetadataSelection{NumPaths: 2, ASCost: table.Cost, CostWeight: 1}, []string{"1-ff00:0:113", "1-ff00:0:114"}},
+			{"Carbon And Link Types", MetadataSelection{ASCost: table.Cost, CostWeight: 1, LinkTypeWeight: 200}, []string{"1-ff00:0:111", "1-ff00:0:113", "1-ff00:0:114"}},
+			{"Only Direct", MetadataSelection{LinkTypes: []snet.LinkType{snet.LinkTypeDirect}}, []string{"1-ff00:0:111"}},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				selected, err := c.selection.CustomPathSelectAlg(ps)
+				if err != nil {
+					t.Fatal(err)
+				}
+				expectVia(t, selected, c.expected...)
+			})
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package pathselection
+
+import (
+	"encoding/json"
+	"time"
+
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// JSON form of a PathQuality. The path is stored as lookup.PathRecord
+// and its hop string is added for logging
+type jsonPathQuality struct {
+	Id           string            `json:"id,omitempty"`
+	Hops         string            `json:"hops"`
+	Path         lookup.PathRecord `json:"path"`
+	Timestamp    time.Time         `json:"timestamp"`
+	HopCount     int               `json:"hopCount,omitempty"`
+	MTU          uint16            `json:"mtu,omitempty"`
+	Latency      time.Duration     `json:"latency,omitempty"`
+	RTT          time.Duration     `json:"rtt,omitempty"`
+	Bytes        int               `json:"bytes,omitempty"`
+	Duration     time.Duration     `json:"duration,omitempty"`
+	MaxBandwidth int64             `json:"maxBandwidth,omitempty"`
+
+	// Number of metrics intervals with traffic over the path
+	BandwidthSamples int `json:"bandwidthSamples,omitempty"`
+}
+
+type jsonPathSet struct {
+	Address string        `json:"address,omitempty"`
+	Paths   []PathQuality `json:"paths"`
+}
+
+// MarshalJSON serializes the path and the exported qualities. The pan path and
+// the metrics are left out, the path can be sent over after it was resolved
+// against the current paths, e.g. via lookup.FindPath and its fingerprint
+func (pq PathQuality) MarshalJSON() ([]byte, error) {
+	j := jsonPathQuality{
+		Id:           pq.Id,
+		Timestamp:    pq.Timestamp,
+		HopCount:     pq.HopCount,
+		MTU:          pq.MTU,
+		Latency:      pq.Latency,
+		RTT:          pq.RTT,
+		Bytes:        pq.Bytes,
+		Duration:     pq.Duration,
+		MaxBandwidth: pq.MaxBandwidth,
+	}
+	j.BandwidthSamples = pq.BandwidthSamples
+	if pq.SnetPath != nil {
+		j.Hops = lookup.PathToString(pq.SnetPath)
+		j.Path = lookup.NewPathRecord(pq.SnetPath)
+	}
+	return json.Marshal(j)
+}
+
+func (pq *PathQuality) UnmarshalJSON(b []byte) error {
+	var j jsonPathQuality
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*pq = PathQuality{
+		Id:           j.Id,
+		Timestamp:    j.Timestamp,
+		HopCount:     j.HopCount,
+		MTU:          j.MTU,
+		Latency:      j.Latency,
+		RTT:          j.RTT,
+		Bytes:        j.Bytes,
+		Duration:     j.Duration,
+		MaxBandwidth: j.MaxBandwidth,
+		SnetPath:     j.Path.SnetPath(),
+	}
+	pq.BandwidthSamples = j.BandwidthSamples
+	return nil
+}
+
+func (ps PathSet) MarshalJSON() ([]byte, error) {
+	j := jsonPathSet{Paths: ps.Paths}
+	if ps.Address.Host != nil {
+		j.Address = ps.Address.String()
+	}
+	if j.Paths == nil {
+		j.Paths = make([]PathQuality, 0)
+	}
+	return json.Marshal(j)
+}
+
+func (ps *PathSet) UnmarshalJSON(b []byte) error {
+	var j jsonPathSet
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*ps = PathSet{Paths: j.Paths}
+	if j.Address != "" {
+		addr, err := snet.ParseUDPAddr(j.Address)
+		if err != nil {
+			return err
+		}
+		ps.Address = *addr
+	}
+	return nil
+}
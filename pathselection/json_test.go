@@ -0,0 +1,47 @@
+package pathselection
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/spath"
+)
+
+func Test_PathSetJSON(t *testing.T) {
+	remote, err := snet.ParseUDPAddr("1-ff00:0:112,[127.0.0.2]:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := testutil.Path("1-ff00:0:110", 1, "1-ff00:0:112", 2)
+	path.SPath = spath.Path{Raw: []byte{1, 2, 3}}
+	path.Meta.MTU = 1280
+	ps := PathSet{
+		Address: *remote,
+		Paths:   []PathQuality{{Id: "first", SnetPath: path, RTT: 20 * time.Millisecond, MaxBandwidth: 1000}},
+	}
+
+	b, err := json.Marshal(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored PathSet
+	if err := json.Unmarshal(b, &restored); err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Address.String() != remote.String() || len(restored.Paths) != 1 {
+		t.Fatalf("Expected the pathset to %s, got %s", remote, b)
+	}
+	pq := restored.Paths[0]
+	if pq.Id != "first" || pq.RTT != 20*time.Millisecond || pq.MaxBandwidth != 1000 {
+		t.Errorf("Expected the qualities of the path, got %+v", pq)
+	}
+	if lookup.Fingerprint(pq.SnetPath) != lookup.Fingerprint(path) || pq.SnetPath.Metadata().MTU != 1280 ||
+		string(pq.SnetPath.Path().Raw) != string(path.SPath.Raw) {
+		t.Errorf("Expected path %s, got %s", path, pq.SnetPath)
+	}
+}
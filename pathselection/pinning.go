@@ -0,0 +1,157 @@
+package pathselection
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/sirupsen/logrus"
+)
+
+// Returned by PathPinner.Apply with PinFail if a pinned path is not available
+var ErrPinnedPathMissing = errors.New("pinned path is not available")
+
+// PinPolicy determines what happens if a pinned path is not available
+type PinPolicy string
+
+const (
+	// Applying the pathset fails with ErrPinnedPathMissing, the default
+	PinFail PinPolicy = "fail"
+	// A warning is logged and the pathset is applied without the path
+	PinWarn PinPolicy = "warn"
+	// The available path closest to the pinned one is used instead,
+	// see lookup.PathPredicate.Similarity
+	PinSubstitute PinPolicy = "substitute"
+)
+
+// PathPinner keeps pinned paths in every pathset it is applied to. Pins are
+// fingerprints or hop strings as accepted by lookup.ParsePath and are resolved
+// again against each lookup, so that refreshed paths stay pinned
+type PathPinner struct {
+	Policy PinPolicy
+
+	mutex      sync.Mutex
+	pins       []string
+	predicates []lookup.PathPredicate
+	// Latest path each pin was resolved to, substitutes are chosen close to it
+	resolved []snet.Path
+}
+
+func NewPathPinner(pins []string, policy PinPolicy) (*PathPinner, error) {
+	switch policy {
+	case "":
+		policy = PinFail
+	case PinFail, PinWarn, PinSubstitute:
+	default:
+		return nil, fmt.Errorf("unknown pin policy %q", policy)
+	}
+	p := &PathPinner{
+		Policy:     policy,
+		pins:       pins,
+		predicates: make([]lookup.PathPredicate, len(pins)),
+		resolved:   make([]snet.Path, len(pins)),
+	}
+	for i, pin := range pins {
+		pp, err := lookup.ParsePath(pin)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pinned path %q: %w", pin, err)
+		}
+		p.predicates[i] = pp
+	}
+	return p, nil
+}
+
+func containsPath(paths []snet.Path, p snet.Path) bool {
+	fp := lookup.Fingerprint(p)
+	for _, path := range paths {
+		if lookup.Fingerprint(path) == fp {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the pinned paths out of the available ones, applying the policy
+// to missing ones. With PinFail, the error wraps ErrPinnedPathMissing
+func (p *PathPinner) Resolve(available []snet.Path) ([]snet.Path, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pinned := make([]snet.Path, 0, len(p.pins))
+	for i, pp := range p.predicates {
+		matching := pp.Filter(available)
+		if len(matching) > 0 {
+			p.resolved[i] = matching[0]
+			if !containsPath(pinned, matching[0]) {
+				pinned = append(pinned, matching[0])
+			}
+			continue
+		}
+
+		switch p.Policy {
+		case PinFail:
+			return nil, fmt.Errorf("%w: %s", ErrPinnedPathMissing, p.pins[i])
+		case PinWarn:
+			logrus.Warn("[PathPinner] Pinned path ", p.pins[i], " is not available, continuing without it")
+		case PinSubstitute:
+			substitute := p.closest(i, available, pinned)
+			if substitute == nil {
+				logrus.Warn("[PathPinner] Pinned path ", p.pins[i], " is not available and there is no substitute")
+				continue
+			}
+			logrus.Warn("[PathPinner] Pinned path ", p.pins[i], " is not available, substituting ", lookup.PathToString(substitute))
+			pinned = append(pinned, substitute)
+		}
+	}
+	return pinned, nil
+}
+
+// Returns the available path closest to pin i, preferring short paths on ties
+func (p *PathPinner) closest(i int, available, pinned []snet.Path) snet.Path {
+	pp := p.predicates[i]
+	if p.resolved[i] != nil {
+		if resolved, err := lookup.PredicateOf(p.resolved[i]); err == nil {
+			pp = resolved
+		}
+	}
+	var best snet.Path
+	bestSimilarity := -1
+	for _, path := range available {
+		if path.Metadata() == nil || containsPath(pinned, path) {
+			continue
+		}
+		similarity := pp.Similarity(path)
+		if similarity > bestSimilarity ||
+			(similarity == bestSimilarity && len(path.Metadata().Interfaces) < len(best.Metadata().Interfaces)) {
+			best = path
+			bestSimilarity = similarity
+		}
+	}
+	return best
+}
+
+// Apply returns selected with the pinned paths of available in front. Selected
+// paths are dropped from the end to make room for them, unless there are more
+// pinned paths than selected ones
+func (p *PathPinner) Apply(selected, available []snet.Path) ([]snet.Path, error) {
+	pinned, err := p.Resolve(available)
+	if err != nil {
+		return nil, err
+	}
+	size := len(selected)
+	if len(pinned) > size {
+		size = len(pinned)
+	}
+	paths := pinned
+	for _, s := range selected {
+		if len(paths) == size {
+			break
+		}
+		if !containsPath(paths, s) {
+			paths = append(paths, s)
+		}
+	}
+	return paths, nil
+}
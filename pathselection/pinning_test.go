@@ -0,0 +1,66 @@
+package pathselection
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+func Test_PathPinner(t *testing.T) {
+	via111 := testutil.Path("1-ff00:0:110", 1, "1-ff00:0:111", 1, "1-ff00:0:111", 2, "1-ff00:0:113", 1)
+	via112 := testutil.Path("1-ff00:0:110", 2, "1-ff00:0:112", 1, "1-ff00:0:112", 2, "1-ff00:0:113", 2)
+	via111Other := testutil.Path("1-ff00:0:110", 1, "1-ff00:0:111", 1, "1-ff00:0:111", 3, "1-ff00:0:113", 3)
+	via114 := testutil.Path("1-ff00:0:110", 3, "1-ff00:0:114", 1, "1-ff00:0:114", 2, "1-ff00:0:113", 4)
+	pin := lookup.PathToString(via111)
+
+	t.Run("PathPinner Keeps Pinned Path", func(t *testing.T) {
+		pinner, err := NewPathPinner([]string{pin}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths, err := pinner.Apply([]snet.Path{via112, via114}, []snet.Path{via112, via111, via114})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != 2 || lookup.Fingerprint(paths[0]) != lookup.Fingerprint(via111) ||
+			lookup.Fingerprint(paths[1]) != lookup.Fingerprint(via112) {
+			t.Errorf("Expected the pinned path in front of the first selected one, got %v", paths)
+		}
+		paths, _ = pinner.Apply([]snet.Path{via111, via112}, []snet.Path{via112, via111})
+		if len(paths) != 2 {
+			t.Errorf("Expected the pinned path not to be duplicated, got %v", paths)
+		}
+	})
+
+	t.Run("PathPinner Applies Policy", func(t *testing.T) {
+		available := []snet.Path{via112, via111Other, via114}
+		selected := []snet.Path{via112, via114}
+
+		pinner, _ := NewPathPinner([]string{pin}, PinFail)
+		if _, err := pinner.Apply(selected, available); !errors.Is(err, ErrPinnedPathMissing) {
+			t.Errorf("Expected ErrPinnedPathMissing, got %v", err)
+		}
+
+		pinner, _ = NewPathPinner([]string{pin}, PinWarn)
+		paths, err := pinner.Apply(selected, available)
+		if err != nil || len(paths) != 2 || lookup.Fingerprint(paths[0]) != lookup.Fingerprint(via112) {
+			t.Errorf("Expected the selected paths, got %v, %v", paths, err)
+		}
+
+		pinner, _ = NewPathPinner([]string{pin}, PinSubstitute)
+		paths, err = pinner.Apply(selected, available)
+		if err != nil || len(paths) != 2 || lookup.Fingerprint(paths[0]) != lookup.Fingerprint(via111Other) {
+			t.Errorf("Expected the other path via 1-ff00:0:111 as substitute, got %v, %v", paths, err)
+		}
+
+		if _, err := NewPathPinner([]string{pin}, "sometimes"); err == nil {
+			t.Error("Expected an error for an unknown policy")
+		}
+		if _, err := NewPathPinner([]string{"[1-ff00:0:110"}, PinWarn); err == nil {
+			t.Error("Expected an error for an invalid pin")
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package pathselection
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
+	"github.com/scionproto/scion/go/lib/snet"
+	"inet.af/netaddr"
+)
+
+var ErrPathNotFound = errors.New("path not found for remote")
+
+// FixedReplySelector is a ReplySelector for listening sockets. Replies are sent over
+// FixedPath if set, otherwise over the reverse of the latest incoming path
+type FixedReplySelector struct {
+	*pan.DefaultReplySelector
+	mutex     sync.Mutex
+	FixedPath *pan.Path
+}
+
+func NewFixedReplySelector() *FixedReplySelector {
+	return &FixedReplySelector{
+		DefaultReplySelector: pan.NewDefaultReplySelector(),
+	}
+}
+
+func (s *FixedReplySelector) Path(remote pan.UDPAddr) *pan.Path {
+	s.mutex.Lock()
+	fixed := s.FixedPath
+	s.mutex.Unlock()
+	if fixed != nil {
+		return fixed
+	}
+	return s.DefaultReplySelector.Path(remote)
+}
+
+func (s *FixedReplySelector) SetPath(p *pan.Path) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.FixedPath = p
+}
+
+// Resolves the pan path to remote matching the passed snet path.
+// pan does not expose its path pool, so the path is obtained
+// from a short-lived conn using a FixedSelector
+func LookupPanPath(remote pan.UDPAddr, p snet.Path) (*pan.Path, error) {
+	sel := &FixedSelector{}
+	sel.SetPathFromSnet(p)
+	if sel.FixedPath == nil {
+		return nil, ErrPathNotFound
+	}
+
+	conn, err := scionhost.DialUDP(context.Background(), netaddr.IPPort{}, remote, nil, sel)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	path := sel.Path()
+	if path == nil || lookup.PanFingerprint(path) != lookup.Fingerprint(p) {
+		return nil, ErrPathNotFound
+	}
+	return path.Copy(), nil
+}
+
+// SelectionFunc adapts a plain function to CustomPathSelection, e.g.
+// SelectionFunc(func(ps *PathSet) (*PathSet, error) { return ps.GetPathLowLatency(2), nil })
+type SelectionFunc func(*PathSet) (*PathSet, error)
+
+func (f SelectionFunc) CustomPathSelectAlg(ps *PathSet) (*PathSet, error) {
+	return f(ps)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
@@ -40,6 +41,9 @@ type PathQuality struct {
 	Path         pan.Path
 	SnetPath     snet.Path
 	Id           string
+
+	// Number of metrics intervals with traffic over the path
+	BandwidthSamples int
 }
 
 type SelecteablePathSet interface {
@@ -54,6 +58,7 @@ type PathQualityDatabase interface {
 	SetConnections([]packets.UDPConn)
 	UpdatePathQualities(addr *snet.UDPAddr, interval time.Duration) error
 	UpdateMetrics()
+	RemovePathSet(addr *snet.UDPAddr)
 
 	// TODO: Rethink those...
 	//GetPathFunc takes as second argument a function that is
@@ -70,23 +75,40 @@ type PathQualityDatabase interface {
 }
 
 type InMemoryPathQualityDatabase struct {
-	pathSetDB   []PathSet
+	// Flags and filters of the path lookups of UpdatePathQualities
+	LookupOptions *lookup.LookupOptions
+	pathSetDB     []PathSet
 	hashMap     map[string]int
 	connections []packets.UDPConn
+
+	// Guards all fields, since the metrics are updated while
+	// conns are added, removed and selected
+	mutex sync.Mutex
 }
 
 func (db *InMemoryPathQualityDatabase) SetConnections(conns []packets.UDPConn) {
-	db.connections = conns
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.connections = append([]packets.UDPConn(nil), conns...)
 }
 
 func (db *InMemoryPathQualityDatabase) UpdateMetrics() {
 	logrus.Debug("[PathDB] UpdateMetrics called")
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
 	// TODO: Do listen Cons have paths?
 	for _, v := range db.connections {
 
 		connMetrics := v.GetMetrics()
 		connMetrics.Tick()
 
+		// Outgoing direction of asymmetric conns is recorded separately
+		if ac, ok := v.(packets.AsymmetricConn); ok {
+			if replyMetrics := ac.GetReplyMetrics(); replyMetrics != connMetrics {
+				replyMetrics.Tick()
+			}
+		}
+
 		if v.GetRemote() == nil {
 			continue
 		}
@@ -113,21 +135,35 @@ func (db *InMemoryPathQualityDatabase) UpdateMetrics() {
 			}
 
 			pathQuality.MaxBandwidth = maxBw
+			pathQuality.BandwidthSamples = trafficSamples(&pathQuality.metrics)
 		}
 
 	}
 }
 
+// Number of metrics intervals in which data was read or written
+func trafficSamples(m *packets.PathMetrics) int {
+	samples := 0
+	for i := 0; i < len(m.ReadBandwidth) || i < len(m.WrittenBandwidth); i++ {
+		if (i < len(m.ReadBandwidth) && m.ReadBandwidth[i] > 0) ||
+			(i < len(m.WrittenBandwidth) && m.WrittenBandwidth[i] > 0) {
+			samples++
+		}
+	}
+	return samples
+}
+
 func (db *InMemoryPathQualityDatabase) getPathQuality(addr *snet.UDPAddr, path *snet.Path) (*PathQuality, error) {
 	var pathQuality *PathQuality
-	pathSet, err := db.GetPathSet(addr)
-	if err != nil {
-		return nil, err
+	index, contained := db.hashMap[calcAddrHash(addr)]
+	if !contained {
+		return nil, errors.New("404")
 	}
+	pathSet := db.pathSetDB[index]
 
-	for _, v := range pathSet.Paths {
-		if path != nil && bytes.Compare(v.SnetPath.Path().Raw, (*path).Path().Raw) == 0 {
-			pathQuality = &v
+	for i, v := range pathSet.Paths {
+		if path != nil && samePath(v.SnetPath, *path) {
+			pathQuality = &pathSet.Paths[i]
 		}
 	}
 
@@ -140,6 +176,16 @@ func (db *InMemoryPathQualityDatabase) getPathQuality(addr *snet.UDPAddr, path *
 
 }
 
+// Paths are the same if they have the same fingerprint, so that qualities stay
+// assigned after a path was refreshed. Paths without fingerprint are compared raw
+func samePath(a, b snet.Path) bool {
+	fpA, fpB := lookup.Fingerprint(a), lookup.Fingerprint(b)
+	if fpA != "" || fpB != "" {
+		return fpA == fpB
+	}
+	return bytes.Equal(a.Path().Raw, b.Path().Raw)
+}
+
 func asSha256(o interface{}) string {
 	h := sha256.New()
 	h.Write([]byte(fmt.Sprintf("%v", o)))
@@ -155,18 +201,41 @@ func calcAddrHash(addr *snet.UDPAddr) string {
 	return asSha256(partHash.String())
 }
 
+// Returns a copy of the entry of addr, which is not changed by later metrics updates
 func (db *InMemoryPathQualityDatabase) GetPathSet(addr *snet.UDPAddr) (PathSet, error) {
 	// logrus.Error("Get entry ", addr.String())
 	// logrus.Error(db.hashMap)
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
 	hash := calcAddrHash(addr)
 	index, contained := db.hashMap[hash]
 	if contained {
-		return db.pathSetDB[index], nil
+		pathSet := db.pathSetDB[index]
+		pathSet.Paths = append([]PathQuality(nil), pathSet.Paths...)
+		return pathSet, nil
 	} else {
 		return PathSet{}, errors.New("404")
 	}
 }
 
+// Removes the entry of addr, e.g. after the connection to it was closed
+func (db *InMemoryPathQualityDatabase) RemovePathSet(addr *snet.UDPAddr) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	hash := calcAddrHash(addr)
+	index, contained := db.hashMap[hash]
+	if !contained {
+		return
+	}
+	db.pathSetDB = append(db.pathSetDB[:index], db.pathSetDB[index+1:]...)
+	delete(db.hashMap, hash)
+	for k, i := range db.hashMap {
+		if i > index {
+			db.hashMap[k] = i - 1
+		}
+	}
+}
+
 /*
 type MeasuringReaderWriter interface {
 	io.Reader
@@ -213,22 +282,29 @@ func (db *InMemoryPathQualityDatabase) UpdatePathQualities(addr *snet.UDPAddr, m
 	// TODO: Fix with pan
 	// paths := make([]snet.Path, 0)
 	logrus.Debug("[PathDB] UpdatePathQualities called for ", addr.String())
-	paths, err := lookup.PathLookup(addr.String())
+	paths, err := lookup.PathLookupWithOptions(addr.String(), db.LookupOptions)
 	if err != nil {
 		return err
 	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
 	var pathQualities []PathQuality
 	for _, path := range paths {
 
 		cachedPathQuality, err := db.getPathQuality(addr, &path)
-		if err != nil && cachedPathQuality != nil {
-			pathQualities = append(pathQualities, *cachedPathQuality)
+		if err == nil && cachedPathQuality != nil {
+			// Keep the quality of the path, but use the refreshed one
+			pq := *cachedPathQuality
+			pq.SnetPath = path
+			pathQualities = append(pathQualities, pq)
 		} else {
-			// TODO: Add local addr in hashing to support multiple conns over the same path
-			h := sha256.New()
-			h.Write(path.Path().Raw)
-			bs := h.Sum(nil)
-			id := fmt.Sprintf("%x", bs)
+			// TODO: Add local addr in the id to support multiple conns over the same path
+			id := string(lookup.Fingerprint(path))
+			if id == "" {
+				h := sha256.New()
+				h.Write(path.Path().Raw)
+				id = fmt.Sprintf("%x", h.Sum(nil))
+			}
 			pathEntry := PathQuality{SnetPath: path, Id: id, metrics: *packets.NewPathMetrics(metricsInterval)}
 			pathQualities = append(pathQualities, pathEntry)
 		}
@@ -272,6 +348,18 @@ func WrapPathset(paths []snet.Path) PathSet {
 	return pathsSet
 }
 
+// Returns the index of the path with the fingerprint fp in pq, -1 if there is none
+func FindIndexByFingerprint(pq []PathQuality, fp lookup.PathFingerprint) int {
+	for i, v := range pq {
+		if fp == lookup.Fingerprint(v.SnetPath) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Deprecated: PathToString is meant for logging, use FindIndexByFingerprint
 func FindIndexByPathString(pq []PathQuality, s string) int {
 	for i, v := range pq {
 		if s == lookup.PathToString(v.SnetPath) {
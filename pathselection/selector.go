@@ -1,11 +1,10 @@
 package pathselection
 
 import (
-	"fmt"
-	"strings"
 	"sync"
 
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
 	"github.com/scionproto/scion/go/lib/snet"
 	"github.com/sirupsen/logrus"
 )
@@ -41,9 +40,9 @@ func (s *FixedSelector) Initialize(local, remote pan.UDPAddr, paths []*pan.Path)
 	s.paths = paths
 	s.current = 0
 
-	if s.FixedPath != nil {
+	if fixed := lookup.PanFingerprint(s.FixedPath); fixed != "" {
 		for i, p := range s.paths {
-			if p.Fingerprint == s.FixedPath.Fingerprint {
+			if lookup.PanFingerprint(p) == fixed {
 				s.current = i
 				break
 			}
@@ -58,9 +57,9 @@ func (s *FixedSelector) Refresh(paths []*pan.Path) {
 
 	newcurrent := 0
 	if len(s.paths) > 0 {
-		currentFingerprint := s.paths[s.current].Fingerprint
+		currentFingerprint := lookup.PanFingerprint(s.paths[s.current])
 		for i, p := range paths {
-			if p.Fingerprint == currentFingerprint {
+			if lookup.PanFingerprint(p) == currentFingerprint {
 				newcurrent = i
 				break
 			}
@@ -88,30 +87,53 @@ func (s *FixedSelector) PathDown(pf pan.PathFingerprint, pi pan.PathInterface) {
 }
 
 func (s *FixedSelector) SetPathFromSnet(p snet.Path) {
-	ifIDs := make([]pan.IfID, len(p.Metadata().Interfaces))
-	for i, iface := range p.Metadata().Interfaces {
-		ifIDs[i] = pan.IfID(iface.ID)
-	}
-	path := &pan.Path{}
-
-	if len(ifIDs) == 0 {
-		path.Fingerprint = ""
+	fingerprint := lookup.Fingerprint(p)
+	if fingerprint == "" {
 		return
 	}
-	b := &strings.Builder{}
-	fmt.Fprintf(b, "%d", ifIDs[0])
-	for _, ifID := range ifIDs[1:] {
-		fmt.Fprintf(b, " %d", ifID)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.FixedPath = lookup.PanPath(p)
+	for i, p := range s.paths {
+		if lookup.PanFingerprint(p) == fingerprint {
+			s.current = i
+			break
+		}
 	}
-	path.Fingerprint = pan.PathFingerprint(b.String())
-	s.FixedPath = path
+}
 
-	if s.FixedPath != nil {
-		for i, p := range s.paths {
-			if p.Fingerprint == s.FixedPath.Fingerprint {
-				s.current = i
-				break
+// Switches to the known path matching p and returns the previously used one.
+// In contrast to SetPathFromSnet, an unknown path is an error
+func (s *FixedSelector) SwitchPath(p snet.Path) (*pan.Path, error) {
+	fingerprint := lookup.Fingerprint(p)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, path := range s.paths {
+		if lookup.PanFingerprint(path) == fingerprint {
+			var previous *pan.Path
+			if len(s.paths) > 0 {
+				previous = s.paths[s.current]
 			}
+			s.current = i
+			s.FixedPath = path
+			return previous, nil
+		}
+	}
+	return nil, ErrPathNotFound
+}
+
+// Restores a path returned by SwitchPath
+func (s *FixedSelector) SetPath(p *pan.Path) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.FixedPath = p
+	fingerprint := lookup.PanFingerprint(p)
+	for i, path := range s.paths {
+		if lookup.PanFingerprint(path) == fingerprint {
+			s.current = i
+			break
 		}
 	}
 }
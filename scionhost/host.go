@@ -174,8 +174,12 @@ func defaultLocalAddr(local netaddr.IPPort) (netaddr.IPPort, error) {
 }
 
 func (h *hostContext) QueryPaths(ctx context.Context, dst pan.IA) ([]snet.Path, error) {
-	logrus.Debug("[HostContext] Query Paths to ", dst.String())
-	flags := daemon.PathReqFlags{Refresh: false, Hidden: false}
+	return h.QueryPathsWithOptions(ctx, dst, QueryOptions{})
+}
+
+func (h *hostContext) QueryPathsWithOptions(ctx context.Context, dst pan.IA, opts QueryOptions) ([]snet.Path, error) {
+	logrus.Debugf("[HostContext] Query Paths to %s with %+v", dst.String(), opts)
+	flags := daemon.PathReqFlags{Refresh: opts.Refresh, Hidden: opts.Hidden}
 	snetPaths, err := h.sciond.Paths(ctx, addr.IA(dst), addr.IA(h.ia), flags)
 	if err != nil {
 		return nil, err
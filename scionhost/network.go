@@ -0,0 +1,156 @@
+package scionhost
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/scionproto/scion/go/lib/snet"
+	"inet.af/netaddr"
+)
+
+// Network is the SCION network the library queries paths from and opens
+// conns in. By default, this is the network of the local SCION daemon and
+// dispatcher. Tests replace it via SetNetwork, e.g. with an emulated network
+type Network interface {
+	// QueryPaths returns the paths from the local AS to dst
+	QueryPaths(ctx context.Context, dst pan.IA) ([]snet.Path, error)
+	// ListenUDP behaves like pan.ListenUDP
+	ListenUDP(ctx context.Context, local netaddr.IPPort, selector pan.ReplySelector) (pan.ListenConn, error)
+	// DialUDP behaves like pan.DialUDP
+	DialUDP(ctx context.Context, local netaddr.IPPort, remote pan.UDPAddr, policy pan.Policy, selector pan.Selector) (pan.Conn, error)
+}
+
+// Flags of a path lookup, as supported by the SCION daemon
+type QueryOptions struct {
+	// Fetches fresh paths instead of cached ones
+	Refresh bool
+	// Includes the hidden paths of the hidden path groups of the local AS
+	Hidden bool
+}
+
+// Implemented by networks that support QueryOptions. Lookups in other
+// networks ignore the options
+type OptionsQuerier interface {
+	QueryPathsWithOptions(ctx context.Context, dst pan.IA, opts QueryOptions) ([]snet.Path, error)
+}
+
+var networkMutex sync.Mutex
+var network Network
+
+// SetNetwork replaces the network used by all sockets and path lookups
+// opened from now on. Passing nil restores the local SCION network
+func SetNetwork(n Network) {
+	networkMutex.Lock()
+	defer networkMutex.Unlock()
+	network = n
+}
+
+// Returns the network set by SetNetwork, nil for the local SCION network
+func getNetwork() Network {
+	networkMutex.Lock()
+	defer networkMutex.Unlock()
+	return network
+}
+
+func QueryPaths(ctx context.Context, dst pan.IA) ([]snet.Path, error) {
+	if n := getNetwork(); n != nil {
+		return n.QueryPaths(ctx, dst)
+	}
+	return Host().QueryPaths(ctx, dst)
+}
+
+// QueryPathsWithOptions behaves like QueryPaths, but passes the flags to the network
+func QueryPathsWithOptions(ctx context.Context, dst pan.IA, opts QueryOptions) ([]snet.Path, error) {
+	n := getNetwork()
+	if n == nil {
+		return Host().QueryPathsWithOptions(ctx, dst, opts)
+	}
+	if q, ok := n.(OptionsQuerier); ok {
+		return q.QueryPathsWithOptions(ctx, dst, opts)
+	}
+	return n.QueryPaths(ctx, dst)
+}
+
+func ListenUDP(ctx context.Context, local netaddr.IPPort, selector pan.ReplySelector) (pan.ListenConn, error) {
+	if n := getNetwork(); n != nil {
+		return n.ListenUDP(ctx, local, selector)
+	}
+	return pan.ListenUDP(ctx, local, selector)
+}
+
+func DialUDP(ctx context.Context, local netaddr.IPPort, remote pan.UDPAddr, policy pan.Policy, selector pan.Selector) (pan.Conn, error) {
+	if n := getNetwork(); n != nil {
+		return n.DialUDP(ctx, local, remote, policy, selector)
+	}
+	return pan.DialUDP(ctx, local, remote, policy, selector)
+}
+
+// ListenQUIC behaves like pan.ListenQUIC, but listens in the current network
+func ListenQUIC(ctx context.Context, local netaddr.IPPort, selector pan.ReplySelector,
+	tlsConf *tls.Config, quicConf *quic.Config) (quic.Listener, error) {
+	n := getNetwork()
+	if n == nil {
+		return pan.ListenQUIC(ctx, local, selector, tlsConf, quicConf)
+	}
+
+	conn, err := n.ListenUDP(ctx, local, selector)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := quic.Listen(conn, tlsConf, quicConf)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return closerListener{Listener: listener, conn: conn}, nil
+}
+
+// DialQUIC behaves like pan.DialQUIC, but dials in the current network
+func DialQUIC(ctx context.Context, local netaddr.IPPort, remote pan.UDPAddr, policy pan.Policy, selector pan.Selector,
+	host string, tlsConf *tls.Config, quicConf *quic.Config) (*pan.QUICSession, error) {
+	n := getNetwork()
+	if n == nil {
+		return pan.DialQUIC(ctx, local, remote, policy, selector, host, tlsConf, quicConf)
+	}
+
+	conn, err := n.DialUDP(ctx, local, remote, policy, selector)
+	if err != nil {
+		return nil, err
+	}
+	session, err := quic.DialContext(ctx, connectedPacketConn{conn}, remote, host, tlsConf, quicConf)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &pan.QUICSession{Session: session, Conn: conn}, nil
+}
+
+// Closes the underlying conn together with the listener, as pan does
+type closerListener struct {
+	quic.Listener
+	conn net.PacketConn
+}
+
+func (l closerListener) Close() error {
+	err := l.Listener.Close()
+	l.conn.Close()
+	return err
+}
+
+// Wraps a dialed conn into the PacketConn quic-go expects
+type connectedPacketConn struct {
+	net.Conn
+}
+
+func (c connectedPacketConn) WriteTo(b []byte, to net.Addr) (int, error) {
+	return c.Write(b)
+}
+
+func (c connectedPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.Read(b)
+	return n, c.RemoteAddr(), err
+}
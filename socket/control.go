@@ -0,0 +1,256 @@
+package socket
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	"github.com/sirupsen/logrus"
+)
+
+// Messages exchanged over the control channel, which is the connection
+// that carried the initial HandshakePacket between both sockets
+const (
+	ControlAddPath = iota + 1
+	ControlRemovePath
+	// Sent when a session is closed, the remote closes all conns of the session
+	ControlGoodbye
+	// Periodic report of the bandwidth received on each conn
+	ControlReadReport
+)
+
+const (
+	controlTimeout = 5 * time.Second
+	// Datagram channels retransmit unanswered requests after this interval,
+	// so that a request is given up after controlTimeout as well
+	controlRetransmitInterval = 1 * time.Second
+	controlRetransmissions    = 4
+	// Number of request IDs of the remote remembered to detect retransmissions
+	controlRecentRequests = 64
+)
+
+var ErrControlTimeout = errors.New("no response on control channel")
+
+type ControlPacket struct {
+	Type     int
+	Id       int
+	Response bool
+	// AddPath response: Port the remote waits for the new conn
+	// RemovePath: Port of the receiving side of the removed conn
+	Port int
+	// ReadReport: Bandwidth received per conn
+	Reports []ReadReport
+}
+
+type controlChannel struct {
+	mutex   sync.Mutex
+	send    func(p *ControlPacket) error
+	pending map[int]chan ControlPacket
+	nextId  int
+	handler func(p ControlPacket)
+	// Datagrams may be lost, requests are retransmitted every interval until
+	// the remote responds, 0 disables retransmissions. Responses sent to recent
+	// requests of the remote are kept, retransmitted requests are answered with
+	// them instead of being handled again. Nil while a request is handled or
+	// if it has no response
+	retransmitInterval time.Duration
+	responses          map[int]*ControlPacket
+	// Frees the transport of the channel, nil if it is shared with other sessions
+	closer func() error
+}
+
+func newControlChannel(send func(p *ControlPacket) error, handler func(p ControlPacket)) *controlChannel {
+	return &controlChannel{
+		send:    send,
+		pending: make(map[int]chan ControlPacket),
+		handler: handler,
+	}
+}
+
+// Control channel over a datagram conn, each packet is encoded separately
+func newDatagramControlChannel(write func([]byte) (int, error), handler func(p ControlPacket)) *controlChannel {
+	cc := newControlChannel(func(p *ControlPacket) error {
+		var network bytes.Buffer
+		enc := gob.NewEncoder(&network)
+		err := enc.Encode(p)
+		if err != nil {
+			return err
+		}
+		_, err = write(network.Bytes())
+		return err
+	}, handler)
+	cc.retransmitInterval = controlRetransmitInterval
+	cc.responses = make(map[int]*ControlPacket)
+	return cc
+}
+
+// Control channel over a reliable stream, packets share one encoder
+func newStreamControlChannel(w io.Writer, handler func(p ControlPacket)) *controlChannel {
+	enc := gob.NewEncoder(w)
+	return newControlChannel(func(p *ControlPacket) error {
+		return enc.Encode(p)
+	}, handler)
+}
+
+func (cc *controlChannel) Close() error {
+	if cc.closer == nil {
+		return nil
+	}
+	return cc.closer()
+}
+
+func (cc *controlChannel) Send(p *ControlPacket) error {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	return cc.send(p)
+}
+
+// Sends p and waits for the remote to respond to it. Datagram channels
+// retransmit p up to controlRetransmissions times, ErrControlTimeout is
+// returned if no response arrived after the last one
+func (cc *controlChannel) Request(p *ControlPacket) (ControlPacket, error) {
+	respChan := make(chan ControlPacket, 1)
+	cc.mutex.Lock()
+	cc.nextId++
+	p.Id = cc.nextId
+	cc.pending[p.Id] = respChan
+	err := cc.send(p)
+	cc.mutex.Unlock()
+
+	defer func() {
+		cc.mutex.Lock()
+		delete(cc.pending, p.Id)
+		cc.mutex.Unlock()
+	}()
+
+	if err != nil {
+		return ControlPacket{}, err
+	}
+
+	attempts, wait := 1, controlTimeout
+	if cc.retransmitInterval > 0 {
+		attempts, wait = 1+controlRetransmissions, cc.retransmitInterval
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for attempt := 1; ; attempt++ {
+		select {
+		case resp := <-respChan:
+			return resp, nil
+		case <-timer.C:
+		}
+		if attempt == attempts {
+			return ControlPacket{}, ErrControlTimeout
+		}
+
+		logrus.Debug("[ControlChannel] No response to request ", p.Id, ", retransmitting")
+		err := cc.Send(p)
+		if err != nil {
+			return ControlPacket{}, err
+		}
+		timer.Reset(wait)
+	}
+}
+
+func (cc *controlChannel) Respond(req ControlPacket, resp *ControlPacket) error {
+	resp.Type = req.Type
+	resp.Id = req.Id
+	resp.Response = true
+	cc.mutex.Lock()
+	if cc.responses != nil {
+		cc.responses[req.Id] = resp
+	}
+	cc.mutex.Unlock()
+	return cc.Send(resp)
+}
+
+// Returns true if p is a retransmission of a request that was handled
+// before, which is answered again with the response sent to it
+func (cc *controlChannel) retransmitted(p ControlPacket) bool {
+	if cc.responses == nil || p.Id == 0 {
+		return false
+	}
+	cc.mutex.Lock()
+	resp, handled := cc.responses[p.Id]
+	if !handled {
+		cc.responses[p.Id] = nil
+		for id := range cc.responses {
+			if id <= p.Id-controlRecentRequests {
+				delete(cc.responses, id)
+			}
+		}
+	}
+	cc.mutex.Unlock()
+
+	if handled && resp != nil {
+		logrus.Debug("[ControlChannel] Answering retransmitted request ", p.Id, " again")
+		err := cc.Send(resp)
+		if err != nil {
+			logrus.Debug("[ControlChannel] Failed to answer retransmitted request: ", err)
+		}
+	}
+	return handled
+}
+
+func (cc *controlChannel) handle(p ControlPacket) {
+	if p.Response {
+		cc.mutex.Lock()
+		respChan, ok := cc.pending[p.Id]
+		cc.mutex.Unlock()
+		// Retransmitted requests may be answered more than once
+		if ok {
+			select {
+			case respChan <- p:
+			default:
+			}
+		}
+		return
+	}
+	if cc.retransmitted(p) {
+		return
+	}
+	cc.handler(p)
+}
+
+// Decodes a single datagram received on the control channel
+func (cc *controlChannel) handleDatagram(bts []byte) {
+	p := ControlPacket{}
+	dec := gob.NewDecoder(bytes.NewBuffer(bts))
+	err := dec.Decode(&p)
+	if err != nil {
+		logrus.Trace("[ControlChannel] Ignoring invalid packet: ", err)
+		return
+	}
+	cc.handle(p)
+}
+
+// Reads datagrams until the conn fails
+func (cc *controlChannel) runDatagram(read func([]byte) (int, error)) {
+	bts := make([]byte, packets.PACKET_SIZE)
+	for {
+		n, err := read(bts)
+		if err != nil {
+			logrus.Debug("[ControlChannel] Stop reading: ", err)
+			return
+		}
+		cc.handleDatagram(bts[:n])
+	}
+}
+
+// Reads packets from the stream until it fails
+func (cc *controlChannel) runStream(r io.Reader) {
+	dec := gob.NewDecoder(r)
+	for {
+		p := ControlPacket{}
+		err := dec.Decode(&p)
+		if err != nil {
+			logrus.Debug("[ControlChannel] Stop reading: ", err)
+			return
+		}
+		cc.handle(p)
+	}
+}
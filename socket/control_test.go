@@ -0,0 +1,126 @@
+package socket
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Delivers the datagrams written by one control channel to
+// another, the first drop datagrams are lost
+type lossyLink struct {
+	mutex   sync.Mutex
+	to      *controlChannel
+	drop    int
+	written int
+}
+
+func (l *lossyLink) write(b []byte) (int, error) {
+	l.mutex.Lock()
+	l.written++
+	lost := l.drop > 0
+	if lost {
+		l.drop--
+	}
+	to := l.to
+	l.mutex.Unlock()
+
+	if !lost {
+		go to.handleDatagram(append([]byte{}, b...))
+	}
+	return len(b), nil
+}
+
+func (l *lossyLink) numWritten() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.written
+}
+
+// Client and server channel, the server answers each request
+// it handles with port 42 and counts them
+func controlPair(dropRequests, dropResponses int) (*controlChannel, *lossyLink, *int32) {
+	toServer := &lossyLink{drop: dropRequests}
+	toClient := &lossyLink{drop: dropResponses}
+	handled := new(int32)
+
+	var server *controlChannel
+	server = newDatagramControlChannel(toClient.write, func(p ControlPacket) {
+		atomic.AddInt32(handled, 1)
+		server.Respond(p, &ControlPacket{Port: 42})
+	})
+	client := newDatagramControlChannel(toServer.write, func(p ControlPacket) {})
+	server.retransmitInterval = 10 * time.Millisecond
+	client.retransmitInterval = 10 * time.Millisecond
+	toServer.to, toClient.to = server, client
+	return client, toServer, handled
+}
+
+func Test_ControlChannel(t *testing.T) {
+	t.Run("Lost Request Is Retransmitted", func(t *testing.T) {
+		client, toServer, handled := controlPair(2, 0)
+		resp, err := client.Request(&ControlPacket{Type: ControlAddPath})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Port != 42 {
+			t.Errorf("Expected port 42, got %d", resp.Port)
+		}
+		if n := toServer.numWritten(); n != 3 {
+			t.Errorf("Expected 3 transmissions, got %d", n)
+		}
+		if n := atomic.LoadInt32(handled); n != 1 {
+			t.Errorf("Expected the request to be handled once, got %d", n)
+		}
+	})
+
+	t.Run("Lost Response Is Answered Again", func(t *testing.T) {
+		client, toServer, handled := controlPair(0, 2)
+		resp, err := client.Request(&ControlPacket{Type: ControlAddPath})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Port != 42 {
+			t.Errorf("Expected port 42, got %d", resp.Port)
+		}
+		if n := toServer.numWritten(); n != 3 {
+			t.Errorf("Expected 3 transmissions, got %d", n)
+		}
+		if n := atomic.LoadInt32(handled); n != 1 {
+			t.Errorf("Expected retransmissions not to be handled again, got %d", n)
+		}
+	})
+
+	t.Run("Request Fails Without Response", func(t *testing.T) {
+		client, toServer, handled := controlPair(100, 0)
+		_, err := client.Request(&ControlPacket{Type: ControlRemovePath})
+		if !errors.Is(err, ErrControlTimeout) {
+			t.Fatalf("Expected ErrControlTimeout, got %v", err)
+		}
+		if n := toServer.numWritten(); n != 1+controlRetransmissions {
+			t.Errorf("Expected %d transmissions, got %d", 1+controlRetransmissions, n)
+		}
+		if n := atomic.LoadInt32(handled); n != 0 {
+			t.Errorf("Expected no handled request, got %d", n)
+		}
+	})
+
+	t.Run("Recent Requests Are Bounded", func(t *testing.T) {
+		cc := newDatagramControlChannel(func(b []byte) (int, error) { return len(b), nil }, func(p ControlPacket) {})
+		for id := 1; id <= 3*controlRecentRequests; id++ {
+			var network bytes.Buffer
+			err := gob.NewEncoder(&network).Encode(&ControlPacket{Type: ControlReadReport, Id: id})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cc.handleDatagram(network.Bytes())
+		}
+		if n := len(cc.responses); n > controlRecentRequests {
+			t.Errorf("Expected at most %d remembered requests, got %d", controlRecentRequests, n)
+		}
+	})
+}
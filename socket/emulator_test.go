@@ -0,0 +1,258 @@
+package socket
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/emulator"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/netsys-lab/scion-path-discovery/pathselection"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/common"
+	"github.com/scionproto/scion/go/lib/snet"
+	"inet.af/netaddr"
+)
+
+// Client in 1-ff00:0:110 and server in 1-ff00:0:113, connected
+// via 1-ff00:0:111 and 1-ff00:0:112 over two disjoint paths
+func newEmulatedNetwork(t *testing.T) *emulator.Network {
+	ias := make(map[string]addr.IA)
+	for _, s := range []string{"1-ff00:0:110", "1-ff00:0:111", "1-ff00:0:112", "1-ff00:0:113"} {
+		ia, err := addr.IAFromString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ias[s] = ia
+	}
+
+	n := emulator.NewNetwork(ias["1-ff00:0:110"], 1)
+	n.AddHost(ias["1-ff00:0:110"], netaddr.IPv4(127, 0, 0, 1))
+	n.AddHost(ias["1-ff00:0:113"], netaddr.IPv4(127, 0, 0, 2))
+	props := emulator.LinkProperties{Bandwidth: 100000000, Latency: 5 * time.Millisecond}
+	links := []struct {
+		a, b     string
+		aIf, bIf common.IFIDType
+	}{
+		{"1-ff00:0:110", "1-ff00:0:111", 1, 1},
+		{"1-ff00:0:110", "1-ff00:0:112", 2, 1},
+		{"1-ff00:0:111", "1-ff00:0:113", 2, 1},
+		{"1-ff00:0:112", "1-ff00:0:113", 2, 2},
+	}
+	for _, l := range links {
+		_, err := n.AddLink(ias[l.a], l.aIf, ias[l.b], l.bIf, props)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return n
+}
+
+func Test_EmulatedSCIONSocket(t *testing.T) {
+	network := newEmulatedNetwork(t)
+	scionhost.SetNetwork(network)
+	defer scionhost.SetNetwork(nil)
+	defer network.Close()
+
+	t.Run("SCIONSocket Dials Over Emulated Paths", func(t *testing.T) {
+		sock := NewSCIONSocket("1-ff00:0:113,[127.0.0.2]:31001")
+		err := sock.Listen()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer sock.CloseAll()
+
+		sock2 := NewSCIONSocket("1-ff00:0:110,[127.0.0.1]:11000")
+		err = sock2.Listen()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer sock2.CloseAll()
+
+		paths, err := lookup.PathLookup("1-ff00:0:113,[127.0.0.2]:31001")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(paths) != 2 {
+			t.Errorf("Expected 2 paths, got %d", len(paths))
+			return
+		}
+
+		go func() {
+			pathQualities := make([]pathselection.PathQuality, len(paths))
+			for i, p := range paths {
+				pathQualities[i] = pathselection.PathQuality{Id: fmt.Sprintf("Path%d", i), SnetPath: p}
+			}
+			sock2.DialAll(*sock.localAddr, pathQualities, DialOptions{SendAddrPacket: true})
+		}()
+
+		_, err = sock.WaitForDialIn()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		conns := sock.GetConnections()
+		if len(conns) != 2 {
+			t.Errorf("Expected 2 accepted conns, got %d", len(conns))
+			return
+		}
+		// DialAll returns once all conns were dialed
+		for i := 0; i < 100 && len(sock2.GetConnections()) < 2; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		dialed := sock2.GetConnections()
+		if len(dialed) != 2 {
+			t.Errorf("Expected 2 dialed conns, got %d", len(dialed))
+			return
+		}
+
+		for _, c := range dialed {
+			msg := lookup.PathToString(*c.GetPath())
+			_, err := c.Write([]byte(msg))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+
+		received := make(map[string]bool)
+		for _, c := range conns {
+			buf := make([]byte, 1000)
+			c.SetReadDeadline(time.Now().Add(time.Second))
+			n, err := c.Read(buf)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if string(buf[:n]) != lookup.PathToString(*c.GetPath()) {
+				t.Errorf("Expected message over %s, got %s", lookup.PathToString(*c.GetPath()), buf[:n])
+			}
+			received[string(buf[:n])] = true
+		}
+		if len(received) != 2 {
+			t.Errorf("Expected messages over 2 different paths, got %d", len(received))
+		}
+	})
+
+	t.Run("Accepted Sessions Use Ports Chosen By The OS", func(t *testing.T) {
+		sock := NewSCIONSocket("1-ff00:0:113,[127.0.0.2]:31010")
+		err := sock.Listen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sock.CloseAll()
+
+		paths, err := lookup.PathLookup("1-ff00:0:113,[127.0.0.2]:31010")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pathQualities := make([]pathselection.PathQuality, len(paths))
+		for i, p := range paths {
+			pathQualities[i] = pathselection.PathQuality{Id: fmt.Sprintf("Path%d", i), SnetPath: p}
+		}
+
+		clients := make([]*SCIONSocket, 2)
+		for i := range clients {
+			clients[i] = NewSCIONSocket(fmt.Sprintf("1-ff00:0:110,[127.0.0.1]:%d", 11010+i))
+			err := clients[i].Listen()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer clients[i].CloseAll()
+			go clients[i].DialAll(*sock.localAddr, pathQualities, DialOptions{})
+		}
+
+		ports := make(map[int]bool)
+		for range clients {
+			session, err := sock.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range session.GetConnections() {
+				port := c.LocalAddr().(*snet.UDPAddr).Host.Port
+				if port == 0 || port == sock.localAddr.Host.Port || ports[port] {
+					t.Errorf("Expected a distinct port chosen by the OS, got %d", port)
+				}
+				ports[port] = true
+			}
+		}
+		if len(ports) != 2*len(paths) {
+			t.Errorf("Expected %d accepted conns, got %d", 2*len(paths), len(ports))
+		}
+
+		for i := 0; i < 100 && len(clients[0].GetConnections()) < len(paths); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		for _, c := range clients[0].GetConnections() {
+			local := c.LocalAddr().(*snet.UDPAddr).Host.Port
+			if local == 0 || !ports[c.GetRemote().Host.Port] {
+				t.Errorf("Expected a bound local port and one of the accepted ports as remote, got %d and %d",
+					local, c.GetRemote().Host.Port)
+			}
+		}
+	})
+}
+
+func Test_EmulatedQUICSocket(t *testing.T) {
+	network := newEmulatedNetwork(t)
+	scionhost.SetNetwork(network)
+	defer scionhost.SetNetwork(nil)
+	defer network.Close()
+
+	t.Run("QUICSocket Dials Over Emulated Paths", func(t *testing.T) {
+		sock := NewQUICSocket("1-ff00:0:113,[127.0.0.2]:21100")
+		err := sock.Listen()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer sock.CloseAll()
+
+		sock2 := NewQUICSocket("1-ff00:0:110,[127.0.0.1]:11100")
+		err = sock2.Listen()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer sock2.CloseAll()
+
+		paths, err := lookup.PathLookup("1-ff00:0:113,[127.0.0.2]:21100")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		go func() {
+			pathQualities := make([]pathselection.PathQuality, len(paths))
+			for i, p := range paths {
+				pathQualities[i] = pathselection.PathQuality{Id: fmt.Sprintf("Path%d", i), SnetPath: p}
+			}
+			sock2.DialAll(*sock.localAddr, pathQualities, DialOptions{SendAddrPacket: true})
+		}()
+
+		_, err = sock.WaitForDialIn()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if n := len(sock.GetConnections()); n != len(paths) {
+			t.Errorf("Expected %d accepted conns, got %d", len(paths), n)
+		}
+	})
+
+	t.Run("QUICSocket Rejects Keepalives", func(t *testing.T) {
+		sock := NewQUICSocket("1-ff00:0:113,[127.0.0.2]:21300")
+		sock.SetKeepalive(KeepaliveOptions{Interval: time.Second})
+		err := sock.Listen()
+		if !errors.Is(err, ErrKeepaliveUnsupported) {
+			sock.CloseAll()
+			t.Errorf("Expected Listen to fail with ErrKeepaliveUnsupported, got %v", err)
+		}
+	})
+}
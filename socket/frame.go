@@ -0,0 +1,37 @@
+package socket
+
+import (
+	"bytes"
+)
+
+// In-band frames are sent on the data conns of the SCION transport, which
+// has no connection state of its own. A frame is a datagram consisting of
+// exactly frameMagic followed by the frame type, so they are consumed by
+// SCIONConn.Read and never passed to the application
+const (
+	frameClose = iota + 1
+	frameKeepalive
+)
+
+var frameMagic = []byte{0x53, 0x50, 0x44, 0xff, 0x46, 0x52, 0x4d, 0x00}
+
+func newFrame(frameType byte) []byte {
+	frame := make([]byte, len(frameMagic)+1)
+	copy(frame, frameMagic)
+	frame[len(frameMagic)] = frameType
+	return frame
+}
+
+// Returns the type of the frame in b, or 0 if b carries application data
+func parseFrame(b []byte) byte {
+	if len(b) != len(frameMagic)+1 || !bytes.HasPrefix(b, frameMagic) {
+		return 0
+	}
+	return b[len(frameMagic)]
+}
+
+// Implemented by conns that need to know if the remote closed them,
+// e.g. because it ended the session via the control channel
+type peerCloser interface {
+	markPeerClosed()
+}
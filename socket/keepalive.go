@@ -0,0 +1,128 @@
+package socket
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	"github.com/sirupsen/logrus"
+)
+
+// KeepaliveOptions enable liveness detection on each path conn.
+// Keepalives are sent every Interval, a conn that received nothing within
+// DeadInterval is marked as ConnectionStates.Down. A zero Interval disables
+// keepalives, a zero DeadInterval defaults to three times the Interval.
+// Only SCION/UDP conns support keepalives, QUIC streams cannot carry
+// keepalive frames, so the Listen of a QUICSocket rejects enabled options
+type KeepaliveOptions struct {
+	Interval     time.Duration
+	DeadInterval time.Duration
+}
+
+// Returned by the Listen of a QUICSocket if keepalives are enabled
+var ErrKeepaliveUnsupported = errors.New("keepalives are not supported by QUIC conns")
+
+func (o KeepaliveOptions) Enabled() bool {
+	return o.Interval > 0
+}
+
+func (o KeepaliveOptions) deadInterval() time.Duration {
+	if o.DeadInterval == 0 {
+		return 3 * o.Interval
+	}
+	return o.DeadInterval
+}
+
+// Implemented by conns that send keepalives themselves
+type keepaliveConn interface {
+	startKeepalive(opts KeepaliveOptions)
+}
+
+// keepalive receives the packets of a conn in the background, so
+// that liveness is detected even if the application does not read,
+// and periodically sends keepalive frames
+type keepalive struct {
+	opts         KeepaliveOptions
+	conn         *SCIONConn
+	lastReceived int64
+	*packetQueue
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Number of packets buffered for the application, further
+// packets are dropped until the application reads again
+const keepaliveQueueSize = 64
+
+func newKeepalive(conn *SCIONConn, opts KeepaliveOptions) *keepalive {
+	return &keepalive{
+		opts:         opts,
+		conn:         conn,
+		lastReceived: time.Now().UnixNano(),
+		packetQueue:  newPacketQueue(keepaliveQueueSize),
+		done:         make(chan struct{}),
+	}
+}
+
+func (k *keepalive) run() {
+	go k.receive()
+	go k.send()
+}
+
+func (k *keepalive) receive() {
+	for {
+		bts := make([]byte, packets.PACKET_SIZE)
+		n, err := k.conn.internalConn.Read(bts)
+		if err != nil {
+			k.fail(err)
+			return
+		}
+
+		atomic.StoreInt64(&k.lastReceived, time.Now().UnixNano())
+		if k.conn.CompareAndSetState(packets.ConnectionStates.Down, packets.ConnectionStates.Open) {
+			logrus.Info("[Keepalive] Conn to ", k.conn.remote.String(), " is up again")
+		}
+
+		switch parseFrame(bts[:n]) {
+		case 0:
+			if !k.push(bts[:n]) {
+				logrus.Trace("[Keepalive] Queue full, dropping packet from ", k.conn.remote.String())
+			}
+		case frameClose:
+			k.conn.markPeerClosed()
+			k.fail(packets.ErrPeerClosed)
+			return
+		}
+	}
+}
+
+func (k *keepalive) send() {
+	ticker := time.NewTicker(k.opts.Interval)
+	defer ticker.Stop()
+	frame := newFrame(frameKeepalive)
+	for {
+		select {
+		case <-k.done:
+			return
+		case <-ticker.C:
+			_, err := k.conn.internalConn.Write(frame)
+			if err != nil {
+				logrus.Debug("[Keepalive] Failed to send keepalive to ", k.conn.remote.String(), ": ", err)
+			}
+
+			last := time.Unix(0, atomic.LoadInt64(&k.lastReceived))
+			if time.Since(last) > k.opts.deadInterval() &&
+				k.conn.CompareAndSetState(packets.ConnectionStates.Open, packets.ConnectionStates.Down) {
+				logrus.Warn("[Keepalive] Conn to ", k.conn.remote.String(), " is down, nothing received since ", last)
+			}
+		}
+	}
+}
+
+func (k *keepalive) stop() {
+	k.closeOnce.Do(func() {
+		close(k.done)
+	})
+}
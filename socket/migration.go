@@ -0,0 +1,171 @@
+package socket
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/sirupsen/logrus"
+)
+
+// Streams opened on a QUIC path conn besides the data stream
+// start with one byte announcing their purpose
+const (
+	streamTypeMigrate = iota + 1
+	streamTypeData
+)
+
+const migrationTimeout = 3 * time.Second
+
+var ErrMigrationFailed = errors.New("path migration was not confirmed by the peer")
+
+// Sent by the dialing side of a QUIC conn on a new stream after it
+// switched to Path. Since the stream runs over the new path, the
+// response of the peer confirms that the path works
+type MigratePacket struct {
+	Path snet.Path
+	Ack  bool
+}
+
+// Switches the conn to path, verifies it with a probe and informs the peer.
+// If the peer does not respond, the previous path is restored
+func (qc *QUICReliableConn) migrate(path *snet.Path) error {
+	qc.migrationMutex.Lock()
+	defer qc.migrationMutex.Unlock()
+
+	current := qc.GetPath()
+	previous, err := qc.selector.SwitchPath(*path)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debug("[QuicSocket] Migrating conn to ", qc.remote.String(), " to path ", lookup.PathToString(*path))
+	err = qc.probe(path)
+	if err != nil {
+		logrus.Warn("[QuicSocket] Migration to ", lookup.PathToString(*path), " failed, rolling back: ", err)
+		if previous != nil {
+			qc.selector.SetPath(previous)
+		}
+		// The peer may have switched already, tell it about the rollback.
+		// A conn without path has nothing the peer could switch back to
+		if current != nil {
+			if err := qc.probe(current); err != nil {
+				logrus.Debug("[QuicSocket] Failed to notify peer about rollback: ", err)
+			}
+		}
+		return err
+	}
+
+	qc.setPath(path)
+	return nil
+}
+
+func (qc *QUICReliableConn) probe(path *snet.Path) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+	stream, err := qc.session.OpenStreamSync(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Resetting the stream stops quic-go from retransmitting an unanswered
+		// probe over the restored path, the peer would switch to path otherwise
+		if err != nil {
+			stream.CancelWrite(0)
+			stream.CancelRead(0)
+			return
+		}
+		stream.Close()
+	}()
+	stream.SetDeadline(time.Now().Add(migrationTimeout))
+
+	_, err = stream.Write([]byte{streamTypeMigrate})
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(stream).Encode(MigratePacket{Path: *path})
+	if err != nil {
+		return err
+	}
+
+	resp := MigratePacket{}
+	err = gob.NewDecoder(stream).Decode(&resp)
+	if err != nil {
+		var netErr interface{ Timeout() bool }
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return ErrMigrationFailed
+		}
+		return err
+	}
+	if !resp.Ack {
+		return ErrMigrationFailed
+	}
+	return nil
+}
+
+// Updates the path of the conn, the metrics of the new path are linked
+// to the ones of the previous path
+func (qc *QUICReliableConn) setPath(path *snet.Path) {
+	qc.mutex.Lock()
+	previous := qc.path
+	qc.path = path
+	qc.mutex.Unlock()
+	packets.GetMetricsDB().Migrate(qc.socketLocal, previous, path)
+}
+
+// Handles the streams opened by the peer after the first stream of the session
+func (qc *QUICReliableConn) acceptStreams() {
+	for {
+		stream, err := qc.session.AcceptStream(context.Background())
+		if err != nil {
+			logrus.Trace("[QuicSocket] Stop accepting streams: ", err)
+			return
+		}
+		go qc.handleStream(stream)
+	}
+}
+
+func (qc *QUICReliableConn) handleStream(stream quic.Stream) {
+	stream.SetReadDeadline(time.Now().Add(migrationTimeout))
+	streamType := make([]byte, 1)
+	_, err := io.ReadFull(stream, streamType)
+	if err != nil {
+		stream.Close()
+		return
+	}
+	stream.SetReadDeadline(time.Time{})
+
+	switch streamType[0] {
+	case streamTypeMigrate:
+		qc.handleMigration(stream)
+	case streamTypeData:
+		qc.queueStream(stream)
+	default:
+		logrus.Warn("[QuicSocket] Unknown stream type ", streamType[0])
+		stream.Close()
+	}
+}
+
+func (qc *QUICReliableConn) handleMigration(stream quic.Stream) {
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(migrationTimeout))
+
+	p := MigratePacket{}
+	err := gob.NewDecoder(stream).Decode(&p)
+	if err != nil {
+		logrus.Debug("[QuicSocket] Invalid migration from ", qc.remote.String(), ": ", err)
+		return
+	}
+	logrus.Debug("[QuicSocket] Peer ", qc.remote.String(), " migrated to path ", lookup.PathToString(p.Path))
+	qc.setPath(&p.Path)
+	err = gob.NewEncoder(stream).Encode(MigratePacket{Path: p.Path, Ack: true})
+	if err != nil {
+		logrus.Debug("[QuicSocket] Failed to confirm migration: ", err)
+	}
+}
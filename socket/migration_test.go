@@ -0,0 +1,157 @@
+package socket
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/netsys-lab/scion-path-discovery/pathselection"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// Dials a QUIC conn from 1-ff00:0:110 to 1-ff00:0:113 over the first of both
+// emulated paths and returns both sides of it and the paths to the server
+func dialEmulatedQUICConn(t *testing.T, server, client string) (*QUICReliableConn, *QUICReliableConn, []snet.Path) {
+	sock := NewQUICSocket(server)
+	err := sock.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sock.CloseAll() })
+
+	sock2 := NewQUICSocket(client)
+	err = sock2.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sock2.CloseAll() })
+
+	paths, err := lookup.PathLookup(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("Expected 2 paths, got %d", len(paths))
+	}
+
+	dialed := make(chan error, 1)
+	go func() {
+		pathQualities := []pathselection.PathQuality{{Id: "Path0", SnetPath: paths[0]}}
+		_, err := sock2.DialAll(*sock.localAddr, pathQualities, DialOptions{SendAddrPacket: true})
+		dialed <- err
+	}()
+	accepted := make(chan error, 1)
+	go func() {
+		_, err := sock.WaitForDialIn()
+		accepted <- err
+	}()
+	for _, ch := range []chan error{dialed, accepted} {
+		select {
+		case err := <-ch:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout while dialing the conn")
+		}
+	}
+	return sock2.GetConnections()[0].(*QUICReliableConn), sock.GetConnections()[0].(*QUICReliableConn), paths
+}
+
+// Waits until the recorded path of conn is path
+func waitForPath(t *testing.T, conn *QUICReliableConn, path snet.Path) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if p := conn.GetPath(); p != nil && lookup.Fingerprint(*p) == lookup.Fingerprint(path) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected path %s, got %s", lookup.PathToString(path), lookup.PathToString(*conn.GetPath()))
+}
+
+func Test_Migration(t *testing.T) {
+	network := newEmulatedNetwork(t)
+	scionhost.SetNetwork(network)
+	defer scionhost.SetNetwork(nil)
+	defer network.Close()
+
+	// First link of the path the conns are switched to
+	paths, err := lookup.PathLookup("1-ff00:0:113,[127.0.0.2]:21400")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := paths[1].Metadata().Interfaces[0]
+	link := network.Link(first.IA, first.ID)
+	props := network.LinkProperties(link)
+
+	t.Run("Path Switch Is Confirmed By The Peer", func(t *testing.T) {
+		dialed, accepted, paths := dialEmulatedQUICConn(t, "1-ff00:0:113,[127.0.0.2]:21400", "1-ff00:0:110,[127.0.0.1]:11400")
+		before := dialed.GetMetrics()
+
+		err := dialed.SetPath(&paths[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fp := lookup.PanFingerprint(dialed.selector.Path()); fp != lookup.Fingerprint(paths[1]) {
+			t.Errorf("Expected the selector to send over %s, got %s", lookup.Fingerprint(paths[1]), fp)
+		}
+		waitForPath(t, dialed, paths[1])
+		waitForPath(t, accepted, paths[1])
+		if m := dialed.GetMetrics(); m == before || m.Previous != before {
+			t.Errorf("Expected the metrics of the new path to be linked to the previous ones")
+		}
+	})
+
+	t.Run("Failed Switch Is Rolled Back", func(t *testing.T) {
+		dialed, accepted, paths := dialEmulatedQUICConn(t, "1-ff00:0:113,[127.0.0.2]:21500", "1-ff00:0:110,[127.0.0.1]:11500")
+		// As if the peer had switched, but its confirmation got lost
+		accepted.SetPath(&paths[1])
+
+		lossy := props
+		lossy.Loss = 1
+		network.SetLinkProperties(link, lossy)
+		defer network.SetLinkProperties(link, props)
+
+		err := dialed.SetPath(&paths[1])
+		if !errors.Is(err, ErrMigrationFailed) {
+			t.Fatalf("Expected ErrMigrationFailed, got %v", err)
+		}
+		if fp := lookup.PanFingerprint(dialed.selector.Path()); fp != lookup.Fingerprint(paths[0]) {
+			t.Errorf("Expected the selector to send over %s again, got %s", lookup.Fingerprint(paths[0]), fp)
+		}
+		waitForPath(t, dialed, paths[0])
+		waitForPath(t, accepted, paths[0])
+
+		_, err = dialed.Write([]byte("after rollback"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		accepted.SetReadDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 32)
+		n, err := accepted.Read(buf)
+		if err != nil || string(buf[:n]) != "after rollback" {
+			t.Errorf("Expected data over the restored path, got %q, %v", buf[:n], err)
+		}
+	})
+
+	t.Run("Unanswered Probe Times Out", func(t *testing.T) {
+		dialed, _, paths := dialEmulatedQUICConn(t, "1-ff00:0:113,[127.0.0.2]:21600", "1-ff00:0:110,[127.0.0.1]:11600")
+
+		slow := props
+		slow.Latency = 2 * migrationTimeout
+		network.SetLinkProperties(link, slow)
+		defer network.SetLinkProperties(link, props)
+
+		start := time.Now()
+		err := dialed.SetPath(&paths[1])
+		if !errors.Is(err, ErrMigrationFailed) {
+			t.Fatalf("Expected ErrMigrationFailed, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < migrationTimeout || elapsed > 2*migrationTimeout {
+			t.Errorf("Expected the probe to time out after %s, took %s", migrationTimeout, elapsed)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package socket
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// packetQueue buffers packets received in the background until the
+// application reads them, honouring the read deadline of the conn
+type packetQueue struct {
+	queue        chan []byte
+	failed       chan struct{}
+	failOnce     sync.Once
+	err          error
+	mutex        sync.Mutex
+	readDeadline time.Time
+}
+
+func newPacketQueue(size int) *packetQueue {
+	return &packetQueue{
+		queue:  make(chan []byte, size),
+		failed: make(chan struct{}),
+	}
+}
+
+// Adds a packet without blocking, returns false if the queue is full
+func (q *packetQueue) push(data []byte) bool {
+	select {
+	case q.queue <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns err on all reads once the queued packets are consumed
+func (q *packetQueue) fail(err error) {
+	q.failOnce.Do(func() {
+		q.err = err
+		close(q.failed)
+	})
+}
+
+func (q *packetQueue) read(b []byte) (int, error) {
+	q.mutex.Lock()
+	deadline := q.readDeadline
+	q.mutex.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case data := <-q.queue:
+		return copy(b, data), nil
+	case <-q.failed:
+		// Packets received before the failure are still returned
+		select {
+		case data := <-q.queue:
+			return copy(b, data), nil
+		default:
+			return 0, q.err
+		}
+	case <-timeout:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+func (q *packetQueue) setReadDeadline(t time.Time) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.readDeadline = t
+}
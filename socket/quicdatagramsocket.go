@@ -0,0 +1,98 @@
+package socket
+
+import (
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	"github.com/sirupsen/logrus"
+)
+
+// Number of received datagrams buffered for the application,
+// further datagrams are dropped until the application reads again
+const datagramQueueSize = 256
+
+var _ UnderlaySocket = (*QUICDatagramSocket)(nil)
+
+// QUICDatagramSocket sends over the unreliable datagram extension of QUIC.
+// Messages are encrypted and congestion controlled, but may be lost or
+// reordered, which suits media and probing traffic. Handshakes and the
+// control channel still use reliable QUIC streams
+type QUICDatagramSocket struct {
+	*QUICSocket
+}
+
+func NewQUICDatagramSocket(local string) *QUICDatagramSocket {
+	s := NewQUICSocket(local)
+	s.datagrams = true
+	return &QUICDatagramSocket{QUICSocket: s}
+}
+
+// QUICDatagramConn is a path conn whose Read and Write transfer one
+// QUIC datagram each. Datagrams that exceed the maximum size
+// of the path are rejected by Write
+type QUICDatagramConn struct {
+	*QUICReliableConn
+	received *packetQueue
+}
+
+func newQUICDatagramConn(qc *QUICReliableConn) *QUICDatagramConn {
+	dc := &QUICDatagramConn{
+		QUICReliableConn: qc,
+		received:         newPacketQueue(datagramQueueSize),
+	}
+	go dc.receive()
+	return dc
+}
+
+func (dc *QUICDatagramConn) receive() {
+	for {
+		msg, err := dc.session.ReceiveMessage()
+		if err != nil {
+			dc.received.fail(dc.peerError(err))
+			return
+		}
+		if !dc.received.push(msg) {
+			logrus.Trace("[QuicDatagramSocket] Queue full, dropping datagram from ", dc.remote.String())
+		}
+	}
+}
+
+func (dc *QUICDatagramConn) Read(b []byte) (int, error) {
+	n, err := dc.received.read(b)
+	if err != nil {
+		return n, err
+	}
+	m := dc.GetMetrics()
+	m.ReadBytes += int64(n)
+	m.ReadPackets++
+	return n, nil
+}
+
+func (dc *QUICDatagramConn) Write(b []byte) (int, error) {
+	err := dc.session.SendMessage(b)
+	if err != nil {
+		return 0, dc.peerError(err)
+	}
+	m := dc.GetReplyMetrics()
+	m.WrittenBytes += int64(len(b))
+	m.WrittenPackets++
+	return len(b), nil
+}
+
+func (dc *QUICDatagramConn) SetDeadline(t time.Time) error {
+	dc.received.setReadDeadline(t)
+	return nil
+}
+
+func (dc *QUICDatagramConn) SetReadDeadline(t time.Time) error {
+	dc.received.setReadDeadline(t)
+	return nil
+}
+
+// Write blocks until quic-go sends the datagram, which
+// it does not support deadlines for
+func (dc *QUICDatagramConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+var _ packets.AsymmetricConn = (*QUICDatagramConn)(nil)
@@ -0,0 +1,66 @@
+package socket
+
+import (
+	"testing"
+
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/netsys-lab/scion-path-discovery/pathselection"
+)
+
+func Test_QUICDatagramSocket(t *testing.T) {
+	t.Run("QUICDatagramSocket Listen And Dial", func(t *testing.T) {
+		sock := NewQUICDatagramSocket("1-ff00:0:110,[127.0.0.12]:21200")
+		err := sock.Listen()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer sock.CloseAll()
+
+		sock2 := NewQUICDatagramSocket("1-ff00:0:110,[127.0.0.12]:11200")
+		err = sock2.Listen()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer sock2.CloseAll()
+
+		go func() {
+			paths, err := lookup.PathLookup("1-ff00:0:110,[127.0.0.12]:21200")
+			if err != nil || len(paths) == 0 {
+				t.Error("No paths found for local AS, something is wrong here...")
+				return
+			}
+
+			pathQualities := []pathselection.PathQuality{{Id: "FirstPath", SnetPath: paths[0]}}
+			conns, err := sock2.DialAll(*sock.localAddr, pathQualities, DialOptions{SendAddrPacket: true})
+			if err != nil || len(conns) != 1 {
+				t.Error("Dial failed: ", err)
+				return
+			}
+			conns[0].Write([]byte("datagram"))
+		}()
+
+		_, err = sock.WaitForDialIn()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		conns := sock.GetConnections()
+		if len(conns) != 1 {
+			t.Errorf("Expected 1 conn, got %d", len(conns))
+			return
+		}
+		if _, ok := conns[0].(*QUICDatagramConn); !ok {
+			t.Errorf("Expected QUICDatagramConn, got %T", conns[0])
+			return
+		}
+
+		buf := make([]byte, 64)
+		n, err := conns[0].Read(buf)
+		if err != nil || string(buf[:n]) != "datagram" {
+			t.Errorf("Expected datagram, got %q, %v", buf[:n], err)
+		}
+	})
+}
@@ -3,19 +3,21 @@ package socket
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucas-clemente/quic-go"
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
-	"github.com/netsec-ethz/scion-apps/pkg/quicutil"
 	"github.com/netsys-lab/scion-path-discovery/packets"
 	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
 	"github.com/netsys-lab/scion-path-discovery/pathselection"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
 	"github.com/scionproto/scion/go/lib/snet"
 	"github.com/scionproto/scion/go/lib/snet/path"
 	"github.com/sirupsen/logrus"
@@ -34,17 +36,38 @@ type QUICReliableConn struct {
 	local        *snet.UDPAddr
 	socketLocal  *snet.UDPAddr
 	selector     *pathselection.FixedSelector
+	// Accepted conns only: path and selector for outgoing packets
+	replyPath     *snet.Path
+	replySelector *pathselection.FixedReplySelector
+	closed        int32
+	peerClosed    int32
+	// Guards path and replyPath, which change on migration
+	mutex          sync.Mutex
+	migrationMutex sync.Mutex
+	// Further streams opened by the peer, see AcceptStream
+	streams chan quic.Stream
+}
+
+// Maps the errors quic-go returns after the remote closed
+// its stream or session to packets.ErrPeerClosed
+func (qc *QUICReliableConn) peerError(err error) error {
+	var appErr *quic.ApplicationError
+	if err == io.EOF || (errors.As(err, &appErr) && appErr.Remote) {
+		atomic.StoreInt32(&qc.peerClosed, 1)
+	}
+	if atomic.LoadInt32(&qc.peerClosed) == 1 {
+		return packets.ErrPeerClosed
+	}
+	return err
 }
 
 // This simply wraps conn.Read and will later collect metrics
 func (qc *QUICReliableConn) Read(b []byte) (int, error) {
 	n, err := qc.internalConn.Read(b)
 	if err != nil {
-		return n, err
+		return n, qc.peerError(err)
 	}
-	m := qc.GetMetrics()
-	m.ReadBytes += int64(n)
-	m.ReadPackets++
+	qc.GetMetrics().AddRead(n)
 	return n, err
 }
 
@@ -52,17 +75,17 @@ func (qc *QUICReliableConn) Read(b []byte) (int, error) {
 func (qc *QUICReliableConn) Write(b []byte) (int, error) {
 	n, err := qc.internalConn.Write(b)
 
-	m := qc.GetMetrics()
-	m.WrittenBytes += int64(n)
-	m.WrittenPackets++
+	qc.GetReplyMetrics().AddWritten(n)
 	if err != nil {
-		return n, err
+		return n, qc.peerError(err)
 	}
 	return n, err
 }
 
+// Closing the stream and session lets quic-go notify the remote,
+// whose Read returns packets.ErrPeerClosed
 func (qc *QUICReliableConn) Close() error {
-	if qc.internalConn == nil {
+	if qc.internalConn == nil || !atomic.CompareAndSwapInt32(&qc.closed, 0, 1) {
 		return nil
 	}
 	err := qc.internalConn.Close()
@@ -88,25 +111,84 @@ func (qc *QUICReliableConn) Close() error {
 	return nil
 }
 
+// QUIC conns do not support keepalives and never report Down,
+// they are Closed once quic-go closed the session, e.g. after
+// the default idle timeout
+func (qc *QUICReliableConn) GetState() int {
+	if atomic.LoadInt32(&qc.closed) == 1 || atomic.LoadInt32(&qc.peerClosed) == 1 {
+		return packets.ConnectionStates.Closed
+	}
+	if qc.session != nil {
+		select {
+		case <-qc.session.Context().Done():
+			return packets.ConnectionStates.Closed
+		default:
+		}
+	}
+	return packets.ConnectionStates.Open
+}
+
+func (qc *QUICReliableConn) markPeerClosed() {
+	atomic.StoreInt32(&qc.peerClosed, 1)
+}
+
 func (qc *QUICReliableConn) GetMetrics() *packets.PathMetrics {
 	// return qc.metrics
-	return packets.GetMetricsDB().GetOrCreate(qc.socketLocal, qc.path)
+	return packets.GetMetricsDB().GetOrCreate(qc.socketLocal, qc.GetPath())
 }
 
 func (qc *QUICReliableConn) GetPath() *snet.Path {
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
 	return qc.path
 }
 
+// SetPath migrates a dialed conn to the passed path. The switch is only kept
+// if a probe over the new path is answered by the peer, which then updates the
+// path of its side of the conn. Otherwise the previous path is restored and an
+// error is returned. On accepted conns, only the recorded path is updated
 func (qc *QUICReliableConn) SetPath(path *snet.Path) error {
-	qc.path = path
-	if qc.selector != nil {
-		logrus.Error("SETPATHFROMSNET")
-		qc.selector.SetPathFromSnet(*path)
+	if qc.selector == nil {
+		qc.setPath(path)
+		return nil
+	}
+	return qc.migrate(path)
+}
+
+// Path used for outgoing packets, differs from GetPath if
+// the accepting socket selected its own paths
+func (qc *QUICReliableConn) GetReplyPath() *snet.Path {
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
+	if qc.replyPath != nil {
+		return qc.replyPath
 	}
-	// qc.metrics.Path = path
+	return qc.path
+}
+
+func (qc *QUICReliableConn) SetReplyPath(path *snet.Path) error {
+	if qc.replySelector == nil {
+		return errors.New("reply path can only be set on accepted conns")
+	}
+	remote, err := pan.ResolveUDPAddr(qc.remote.String())
+	if err != nil {
+		return err
+	}
+	panPath, err := pathselection.LookupPanPath(remote, *path)
+	if err != nil {
+		return err
+	}
+	qc.replySelector.SetPath(panPath)
+	qc.mutex.Lock()
+	qc.replyPath = path
+	qc.mutex.Unlock()
 	return nil
 }
 
+func (qc *QUICReliableConn) GetReplyMetrics() *packets.PathMetrics {
+	return packets.GetMetricsDB().GetOrCreate(qc.socketLocal, qc.GetReplyPath())
+}
+
 func (qc *QUICReliableConn) GetRemote() *snet.UDPAddr {
 	return qc.remote
 }
@@ -131,7 +213,7 @@ func (qc *QUICReliableConn) SetWriteDeadline(t time.Time) error {
 	return qc.internalConn.SetWriteDeadline(t)
 }
 
-var _ packets.UDPConn = (*QUICReliableConn)(nil)
+var _ packets.AsymmetricConn = (*QUICReliableConn)(nil)
 
 var _ UnderlaySocket = (*QUICSocket)(nil)
 
@@ -144,9 +226,17 @@ type QUICSocket struct {
 	listener       quic.Listener
 	local          string
 	localAddr      *snet.UDPAddr
-	conns          []*QUICReliableConn
+	session        *PeerSession
 	Stream         quic.Stream
 	ConnectedPeers []RemotePeer
+	acceptor       *sessionAcceptor
+	sessionMutex   sync.Mutex
+	sessions       []*PeerSession
+	keepalive      KeepaliveOptions
+	readReports    time.Duration
+	tls            *TLSOptions
+	// Path conns send datagrams instead of using a stream, see QUICDatagramSocket
+	datagrams bool
 }
 
 func (s *QUICSocket) GetMetrics() []*packets.PathMetrics {
@@ -204,9 +294,13 @@ func (s *QUICSocket) AggregateMetrics() *packets.PathMetrics {
 func NewQUICSocket(local string) *QUICSocket {
 	s := QUICSocket{
 		local:          local,
-		conns:          make([]*QUICReliableConn, 0),
+		session:        NewPeerSession(nil, nil),
 		ConnectedPeers: make([]RemotePeer, 0),
+		acceptor:       newSessionAcceptor(),
+		sessions:       make([]*PeerSession, 0),
+		tls:            &TLSOptions{},
 	}
+	s.session.transport = &s
 
 	gob.Register(path.Path{})
 
@@ -220,15 +314,20 @@ func (s *QUICSocket) Listen() error {
 	if err != nil {
 		return err
 	}
+	s.session.Local = lAddr
+	err = s.tls.validate()
+	if err != nil {
+		return err
+	}
+	if s.keepalive.Enabled() {
+		return ErrKeepaliveUnsupported
+	}
 
 	ipP := pan.IPPortValue{}
 	shortAddr := fmt.Sprintf("%s:%d", lAddr.Host.IP, lAddr.Host.Port)
 	ipP.Set(shortAddr)
-	tlsCfg := &tls.Config{
-		Certificates: quicutil.MustGenerateSelfSignedCert(),
-		NextProtos:   []string{"scion-filetransfer"},
-	}
-	listener, err := pan.ListenQUIC(context.Background(), ipP.Get(), nil, tlsCfg, nil)
+	tlsCfg := s.tls.serverConfig()
+	listener, err := scionhost.ListenQUIC(context.Background(), ipP.Get(), nil, tlsCfg, nil)
 	if err != nil {
 		return err
 	}
@@ -240,23 +339,71 @@ func (s *QUICSocket) Listen() error {
 
 // TODO: This needs to be done for each incoming conn
 func (s *QUICSocket) WaitForIncomingConn(lAddr snet.UDPAddr) (packets.UDPConn, error) {
+	l, err := s.listenForConn(lAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := l.accept(s.localAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	s.session.AddConn(conn)
+	logrus.Debug("[QuicSocket] Added new Conn: ", s.local, " to ", conn.GetRemote().String())
+	return conn, nil
+}
+
+// Listener of one conn, it stays open as long as the conn
+type quicIncomingConn struct {
+	s             *QUICSocket
+	listener      quic.Listener
+	replySelector *pathselection.FixedReplySelector
+	lAddr         snet.UDPAddr
+}
+
+func (s *QUICSocket) listenForConn(lAddr snet.UDPAddr) (incomingConn, error) {
 	ipP := pan.IPPortValue{}
 	shortAddr := fmt.Sprintf("%s:%d", lAddr.Host.IP, lAddr.Host.Port)
 	ipP.Set(shortAddr)
-	tlsCfg := &tls.Config{
-		Certificates: quicutil.MustGenerateSelfSignedCert(),
-		NextProtos:   []string{"scion-filetransfer"},
-	}
+	tlsCfg := s.tls.serverConfig()
 	logrus.Debug("[QuicSocket] Waiting for Incoming Conn, new Listener on ", lAddr.String())
-	listener, err := pan.ListenQUIC(context.Background(), ipP.Get(), nil, tlsCfg, nil)
+	replySelector := pathselection.NewFixedReplySelector()
+	listener, err := scionhost.ListenQUIC(context.Background(), ipP.Get(), replySelector, tlsCfg, s.quicConfig())
+	if err != nil {
+		return nil, err
+	}
+	lAddr.Host.Port = boundPort(listener.Addr())
+	return &quicIncomingConn{s: s, listener: listener, replySelector: replySelector, lAddr: lAddr}, nil
+}
+
+func (in *quicIncomingConn) local() *snet.UDPAddr {
+	return &in.lAddr
+}
+
+func (in *quicIncomingConn) close() error {
+	return in.listener.Close()
+}
+
+// The listener is closed if no conn could be established
+func (in *quicIncomingConn) accept(metricsLocal *snet.UDPAddr) (packets.UDPConn, error) {
+	conn, err := in.acceptConn(metricsLocal)
 	if err != nil {
+		in.listener.Close()
 		return nil, err
 	}
+	return conn, nil
+}
 
+func (in *quicIncomingConn) acceptConn(metricsLocal *snet.UDPAddr) (packets.UDPConn, error) {
+	s, listener, lAddr := in.s, in.listener, in.lAddr
 	session, err := listener.Accept(context.Background())
 	if err != nil {
 		return nil, err
 	}
+	err = s.tls.verifySession(session)
+	if err != nil {
+		return nil, err
+	}
 
 	logrus.Debug("[QuicSocket] New Session on ", lAddr.String())
 
@@ -297,20 +444,20 @@ func (s *QUICSocket) WaitForIncomingConn(lAddr snet.UDPAddr) (packets.UDPConn, e
 	logrus.Debug("[QuicSocket] Answer handshake to ", p.Addr.String())
 
 	quicConn := &QUICReliableConn{
-		internalConn: stream,
-		session:      session,
-		listener:     listener,
-		path:         &p.Path,
-		remote:       &p.Addr,
-		metrics:      packets.GetMetricsDB().GetOrCreate(s.localAddr, &p.Path),
-		local:        &lAddr,
-		socketLocal:  s.localAddr,
-	}
-
-	s.conns = append(s.conns, quicConn)
-	logrus.Debug("[QuicSocket] Added new Conn: ", s.local, " to ", p.Addr.String())
-
-	return quicConn, nil
+		internalConn:  stream,
+		session:       session,
+		listener:      listener,
+		path:          &p.Path,
+		remote:        &p.Addr,
+		metrics:       packets.GetMetricsDB().GetOrCreate(metricsLocal, &p.Path),
+		local:         &lAddr,
+		socketLocal:   metricsLocal,
+		replySelector: in.replySelector,
+		streams:       make(chan quic.Stream, streamQueueSize),
+	}
+	go quicConn.acceptStreams()
+
+	return s.pathConn(quicConn), nil
 }
 
 // TODO: This needs to be done for each incoming conn
@@ -325,7 +472,7 @@ func (s *QUICSocket) NextIncomingConn() (packets.UDPConn, error) {
 		Certificates: quicutil.MustGenerateSelfSignedCert(),
 		NextProtos:   []string{"scion-filetransfer"},
 	}
-	listener, err := pan.ListenQUIC(context.Background(), ipP.Get(), nil, tlsCfg, nil)
+	listener, err := scionhost.ListenQUIC(context.Background(), ipP.Get(), nil, tlsCfg, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -373,6 +520,10 @@ func (s *QUICSocket) WaitForDialIn() (*snet.UDPAddr, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = s.tls.verifySession(session)
+	if err != nil {
+		return nil, err
+	}
 
 	stream, err := session.AcceptStream(context.Background())
 	if err != nil {
@@ -390,57 +541,101 @@ func (s *QUICSocket) WaitForDialIn() (*snet.UDPAddr, error) {
 		return nil, err
 	}
 
-	p := HandshakePacket{}
-	network := bytes.NewBuffer(bts) // Stand-in for a network connection
-	dec := gob.NewDecoder(network)
-	err = dec.Decode(&p)
+	err = s.session.acceptHandshake(bts, stream.Write)
 	if err != nil {
 		return nil, err
 	}
+	s.ConnectedPeers = append(s.ConnectedPeers, RemotePeer{
+		Stream: stream,
+		Remote: s.session.Remote,
+	})
 
-	logrus.Debug("[QuicSocket] Got handshake from ", p.Addr.String(), " for ports=", len(p.Ports))
+	control := newStreamControlChannel(stream, s.session.handleControl)
+	control.closer = stream.Close
+	s.session.setControl(control)
+	go control.runStream(stream)
 
-	remotePeer := RemotePeer{
-		Stream: stream,
-		Remote: &p.Addr,
-	}
-	s.ConnectedPeers = append(s.ConnectedPeers, remotePeer)
+	addr := *s.session.Remote
+	return &addr, nil
+}
 
-	var wg sync.WaitGroup
-	ret := HandshakePacket{}
-	ret.Ports = make([]int, 0)
-	for i := 0; i < p.NumPorts; i++ {
-		wg.Add(1)
-		ret.Ports = append(ret.Ports, s.localAddr.Host.Port+11*(i+1)+52*len(s.ConnectedPeers))
-		go func(i int) {
-			l := s.localAddr.Copy()
-			l.Host.Port = l.Host.Port + 11*(i+1) + 52*len(s.ConnectedPeers)
-			_, err := s.WaitForIncomingConn(*l)
+// Accept waits for the next peer dialing into this socket and returns
+// a session containing all of its connections. In contrast to WaitForDialIn,
+// the listener stays open, so Accept can be called repeatedly to serve
+// many peers. Handshakes of different peers are processed concurrently.
+// Accept and WaitForDialIn must not be mixed on the same socket
+func (s *QUICSocket) Accept() (*PeerSession, error) {
+	return s.acceptor.next(s.acceptLoop)
+}
+
+func (s *QUICSocket) acceptLoop() {
+	logrus.Debug("[QuicSocket] Accepting peers on ", s.local)
+	for {
+		session, err := s.listener.Accept(context.Background())
+		if err != nil {
+			s.acceptor.deliver(nil, err)
+			return
+		}
+
+		go func() {
+			err := s.tls.verifySession(session)
 			if err != nil {
-				log.Error(err)
+				session.CloseWithError(0, "")
+				s.acceptor.deliver(nil, err)
 				return
 			}
-			logrus.Debugf("[QuicSocket] Dialed In %d of %d on %s from remote %s", i+1, p.NumPorts, l.String(), p.Addr.String())
-			wg.Done()
-		}(i)
+			peerSession, err := s.acceptSession(session)
+			if err != nil {
+				session.CloseWithError(0, "")
+			}
+			s.acceptor.deliver(peerSession, err)
+		}()
 	}
+}
 
-	// Send reply
+func (s *QUICSocket) acceptSession(session quic.Session) (*PeerSession, error) {
+	stream, err := session.AcceptStream(context.Background())
+	if err != nil {
+		return nil, err
+	}
 
-	ret.Addr = *s.localAddr
-	ret.NumPorts = p.NumPorts
-	// ret.Ports = p.Ports
+	bts := make([]byte, packets.PACKET_SIZE)
+	_, err = stream.Read(bts)
+	if err != nil {
+		return nil, err
+	}
 
-	var network2 bytes.Buffer
-	enc := gob.NewEncoder(&network2)
+	peerSession := NewPeerSession(s.localAddr, nil)
+	peerSession.transport = s
+	peerSession.metricsPerConn = true
+	peerSession.setReadReportInterval(s.readReports)
 
-	err = enc.Encode(ret)
-	stream.Write(network2.Bytes())
-	logrus.Debug("[QuicSocket] Sending handshake response to ", p.Addr.String())
+	err = peerSession.acceptHandshake(bts, stream.Write)
+	if err != nil {
+		return nil, err
+	}
 
-	wg.Wait()
-	addr := p.Addr
-	return &addr, nil
+	peerSession.release = func() {
+		s.sessionMutex.Lock()
+		defer s.sessionMutex.Unlock()
+		for i, ps := range s.sessions {
+			if ps == peerSession {
+				s.sessions = append(s.sessions[:i], s.sessions[i+1:]...)
+				break
+			}
+		}
+	}
+
+	control := newStreamControlChannel(stream, peerSession.handleControl)
+	control.closer = stream.Close
+	peerSession.setControl(control)
+
+	s.sessionMutex.Lock()
+	s.sessions = append(s.sessions, peerSession)
+	s.sessionMutex.Unlock()
+	go control.runStream(stream)
+
+	return peerSession, nil
 }
 
 func (s *QUICSocket) DialAll(remote snet.UDPAddr, path []pathselection.PathQuality, options DialOptions) ([]packets.UDPConn, error) {
@@ -452,15 +647,16 @@ func (s *QUICSocket) DialAll(remote snet.UDPAddr, path []pathselection.PathQuali
 	if err != nil {
 		return nil, err
 	}
-	tlsCfg := &tls.Config{
-		InsecureSkipVerify: true,
-		NextProtos:         []string{"scion-filetransfer"},
-	}
+	tlsCfg := s.tls.clientConfig()
 
 	logrus.Debug("[QuicSocket] Dialing all to ", remote.String())
 
 	selector := &pathselection.FixedSelector{}
-	session, err := pan.DialQUIC(context.Background(), netaddr.IPPort{}, panAddr, nil, selector, "", tlsCfg, nil)
+	session, err := scionhost.DialQUIC(context.Background(), netaddr.IPPort{}, panAddr, nil, selector, "", tlsCfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = s.tls.verifySession(session)
 	if err != nil {
 		return nil, err
 	}
@@ -478,17 +674,12 @@ func (s *QUICSocket) DialAll(remote snet.UDPAddr, path []pathselection.PathQuali
 		Remote: &remote,
 	}
 	s.ConnectedPeers = append(s.ConnectedPeers, remotePeer)
+	s.session.Remote = &remote
 
-	// Send handshake
+	// Send handshake, the remote responds with the ports to dial
 	ret := HandshakePacket{}
 	ret.Addr = *s.localAddr
 	ret.NumPorts = options.NumPaths
-	ret.Ports = make([]int, options.NumPaths)
-
-	for i := 0; i < options.NumPaths; i++ {
-		port := remote.Host.Port + (i+1)*11 + 52*len(s.ConnectedPeers) // TODO: Boundary check, better ranges
-		ret.Ports = append(ret.Ports, port)
-	}
 
 	var network2 bytes.Buffer
 	enc := gob.NewEncoder(&network2)
@@ -515,48 +706,60 @@ func (s *QUICSocket) DialAll(remote snet.UDPAddr, path []pathselection.PathQuali
 		log.Error("From decode")
 		return nil, err
 	}
-	logrus.Debug("[QuicSocket] Completed handshake to ", remote.String(), " with ports=", len(ret.Ports))
+	logrus.Debug("[QuicSocket] Completed handshake to ", remote.String(), " with ports=", len(ps.Ports))
+	if len(ps.Ports) < len(path) {
+		return nil, fmt.Errorf("remote accepts %d conns, %d paths requested", len(ps.Ports), len(path))
+	}
 
-	// TODO: Ports may change here...
 	var wg sync.WaitGroup
 
 	for i, p := range path {
 		wg.Add(1)
 		go func(i int, p snet.Path) {
+			defer wg.Done()
 			l := remote.Copy()
 
 			l.Host.Port = ps.Ports[i]
 
-			local := s.localAddr.Copy()
-			local.Host.Port = local.Host.Port + (i+1)*11 + 52*len(s.ConnectedPeers)
-			// Waitgroup here before sending back response
+			local := s.session.nextLocal()
 			_, err := s.Dial(*local, *l, p)
 			if err != nil {
 				log.Error(err)
 				return
 			}
 			logrus.Debugf("[QuicSocket] Dialed %d of %d on %s to remote %s", i, options.NumPaths, s.local, l.String())
-			wg.Done()
 		}(i, p.SnetPath)
 	}
 	wg.Wait()
 
+	control := newStreamControlChannel(stream, s.session.handleControl)
+	control.closer = stream.Close
+	s.session.setControl(control)
+	go control.runStream(stream)
+
 	log.Warn("DIAL ALL Done")
 
 	return s.GetConnections(), nil
 }
 
 func (s *QUICSocket) Dial(local, remote snet.UDPAddr, path snet.Path) (packets.UDPConn, error) {
-	panAddr, err := pan.ResolveUDPAddr(remote.String())
+	conn, err := s.dial(local, remote, path)
 	if err != nil {
 		return nil, err
 	}
 
-	tlsCfg := &tls.Config{
-		InsecureSkipVerify: true,
-		NextProtos:         []string{"scion-filetransfer"},
+	s.session.AddConn(conn)
+	return conn, nil
+}
+
+func (s *QUICSocket) dial(local, remote snet.UDPAddr, path snet.Path) (packets.UDPConn, error) {
+	panAddr, err := pan.ResolveUDPAddr(remote.String())
+	if err != nil {
+		return nil, err
 	}
 
+	tlsCfg := s.tls.clientConfig()
+
 	ipP := pan.IPPortValue{}
 	shortAddr := fmt.Sprintf("%s:%d", local.Host.IP, local.Host.Port)
 	ipP.Set(shortAddr)
@@ -566,7 +769,13 @@ func (s *QUICSocket) Dial(local, remote snet.UDPAddr, path snet.Path) (packets.U
 	selector.SetPathFromSnet(path)
 
 	logrus.Debug("[QuicSocket] Dial new conn from ", local.String(), " to ", remote.String())
-	session, err := pan.DialQUIC(context.Background(), ipP.Get(), panAddr, nil, selector, "", tlsCfg, nil)
+	session, err := scionhost.DialQUIC(context.Background(), ipP.Get(), panAddr, nil, selector, "", tlsCfg, s.quicConfig())
+	if err != nil {
+		return nil, err
+	}
+	// The remote learns the port chosen by the OS from the handshake
+	local.Host.Port = boundPort(session.LocalAddr())
+	err = s.tls.verifySession(session)
 	if err != nil {
 		return nil, err
 	}
@@ -599,7 +808,8 @@ func (s *QUICSocket) Dial(local, remote snet.UDPAddr, path snet.Path) (packets.U
 		metrics:      packets.GetMetricsDB().GetOrCreate(s.localAddr, &path),
 		socketLocal:  s.localAddr,
 		selector:     selector,
-		// local:        session.LocalAddr(), // TODO: Local Addr
+		local:        &local,
+		streams:      make(chan quic.Stream, streamQueueSize),
 	}
 
 	// For loop, deadline, write packet, read response
@@ -625,30 +835,76 @@ func (s *QUICSocket) Dial(local, remote snet.UDPAddr, path snet.Path) (packets.U
 		break
 	}
 
+	// Reset the handshake deadline, later reads must not time out
+	quicConn.SetReadDeadline(time.Time{})
+	go quicConn.acceptStreams()
 	logrus.Debug("[QuicSocket] Dial complete from ", local.String(), " to ", remote.String())
 
-	s.conns = append(s.conns, quicConn)
-	return quicConn, nil
+	return s.pathConn(quicConn), nil
 }
 
-func (s *QUICSocket) GetConnections() []packets.UDPConn {
-	conns := make([]packets.UDPConn, 0)
-	for _, c := range s.conns {
-		conns = append(conns, c)
+// Sets the TLS identity of the socket and how peers are authenticated,
+// must be called before Listen. Returns ErrNoTrustRoots if peers have to
+// be verified by their IA without trust roots, Listen fails in this case
+func (s *QUICSocket) SetTLSOptions(opts *TLSOptions) error {
+	s.tls = opts
+	return opts.validate()
+}
+
+// QUIC conns do not support keepalives, Listen
+// returns ErrKeepaliveUnsupported if opts are enabled
+func (s *QUICSocket) SetKeepalive(opts KeepaliveOptions) {
+	s.keepalive = opts
+}
+
+// Lets all sessions report the bandwidth received per conn to the remote
+// every interval, starting with the next connection. 0 disables the reports
+func (s *QUICSocket) SetReadReportInterval(interval time.Duration) {
+	s.readReports = interval
+	s.session.setReadReportInterval(interval)
+}
+
+// Config of the path conns, nil uses the defaults of quic-go
+func (s *QUICSocket) quicConfig() *quic.Config {
+	if !s.datagrams {
+		return nil
+	}
+	return &quic.Config{
+		EnableDatagrams: s.datagrams,
 	}
-	return conns
 }
 
-func (s *QUICSocket) CloseAll() []error {
-	errors := make([]error, 0)
-	for _, con := range s.conns {
-		err := con.Close()
-		if err != nil {
-			errors = append(errors, err)
-		}
+// Path conns of datagram sockets use the stream only for the handshake
+func (s *QUICSocket) pathConn(qc *QUICReliableConn) packets.UDPConn {
+	if s.datagrams {
+		return newQUICDatagramConn(qc)
 	}
+	return qc
+}
+
+func (s *QUICSocket) GetConnections() []packets.UDPConn {
+	return s.session.GetConnections()
+}
+
+// Session of the peer connected via DialAll or WaitForDialIn
+func (s *QUICSocket) GetSession() *PeerSession {
+	return s.session
+}
 
-	s.conns = make([]*QUICReliableConn, 0)
+// Closes the session of the connected peer and all accepted sessions,
+// each remote peer is notified
+func (s *QUICSocket) CloseAll() []error {
+	errors := s.session.CloseAll()
 	s.ConnectedPeers = make([]RemotePeer, 0)
+
+	// Sessions remove themselves from the list when closed
+	s.sessionMutex.Lock()
+	sessions := make([]*PeerSession, len(s.sessions))
+	copy(sessions, s.sessions)
+	s.sessionMutex.Unlock()
+
+	for _, session := range sessions {
+		errors = append(errors, session.CloseAll()...)
+	}
 	return errors
 }
@@ -0,0 +1,90 @@
+package socket
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/netsys-lab/scion-path-discovery/packets"
+)
+
+// Number of streams opened by the peer that wait for AcceptStream
+const streamQueueSize = 16
+
+// QUICStream is an additional stream on the session of a QUICReliableConn.
+// Streams share the path of their conn, but are delivered independently, so
+// a lost packet only blocks the stream it belongs to. Their traffic is
+// counted in the metrics of the conn's path, failed calls are not counted
+type QUICStream struct {
+	quic.Stream
+	conn *QUICReliableConn
+}
+
+func (qs *QUICStream) Read(b []byte) (int, error) {
+	n, err := qs.Stream.Read(b)
+	if n > 0 || err == nil {
+		qs.conn.GetMetrics().AddRead(n)
+	}
+	return n, err
+}
+
+func (qs *QUICStream) Write(b []byte) (int, error) {
+	n, err := qs.Stream.Write(b)
+	if n > 0 || err == nil {
+		qs.conn.GetReplyMetrics().AddWritten(n)
+	}
+	return n, err
+}
+
+func (qs *QUICStream) LocalAddr() net.Addr {
+	return qs.conn.LocalAddr()
+}
+
+func (qs *QUICStream) RemoteAddr() net.Addr {
+	return qs.conn.RemoteAddr()
+}
+
+var _ net.Conn = (*QUICStream)(nil)
+
+// OpenStream opens an additional stream to the peer over the path of this conn,
+// the peer receives it via AcceptStream. Read and Write of the conn itself keep
+// using the first stream of the session
+func (qc *QUICReliableConn) OpenStream() (*QUICStream, error) {
+	stream, err := qc.session.OpenStreamSync(context.Background())
+	if err != nil {
+		return nil, qc.peerError(err)
+	}
+
+	// The type is sent right away, so the peer learns about the stream
+	_, err = stream.Write([]byte{streamTypeData})
+	if err != nil {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, qc.peerError(err)
+	}
+	return &QUICStream{Stream: stream, conn: qc}, nil
+}
+
+// AcceptStream waits for the next stream opened by the peer via OpenStream
+func (qc *QUICReliableConn) AcceptStream() (*QUICStream, error) {
+	select {
+	case stream := <-qc.streams:
+		return &QUICStream{Stream: stream, conn: qc}, nil
+	case <-qc.session.Context().Done():
+		if atomic.LoadInt32(&qc.closed) == 1 {
+			return nil, net.ErrClosed
+		}
+		return nil, packets.ErrPeerClosed
+	}
+}
+
+// Passes a stream of the peer to AcceptStream, blocks
+// until it is accepted or the session ends
+func (qc *QUICReliableConn) queueStream(stream quic.Stream) {
+	select {
+	case qc.streams <- stream:
+	case <-qc.session.Context().Done():
+		stream.Close()
+	}
+}
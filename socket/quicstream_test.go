@@ -0,0 +1,153 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
+)
+
+// Accepts the next stream of conn within a second
+func acceptStream(t *testing.T, conn *QUICReliableConn) *QUICStream {
+	t.Helper()
+	accepted := make(chan *QUICStream, 1)
+	go func() {
+		stream, err := conn.AcceptStream()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- stream
+	}()
+	select {
+	case stream := <-accepted:
+		if stream == nil {
+			t.FailNow()
+		}
+		return stream
+	case <-time.After(time.Second):
+		t.Fatal("Timeout while accepting a stream")
+	}
+	return nil
+}
+
+func Test_QUICStream(t *testing.T) {
+	network := newEmulatedNetwork(t)
+	scionhost.SetNetwork(network)
+	defer scionhost.SetNetwork(nil)
+	defer network.Close()
+
+	t.Run("Streams Are Delivered Independently", func(t *testing.T) {
+		dialed, accepted, _ := dialEmulatedQUICConn(t, "1-ff00:0:113,[127.0.0.2]:21700", "1-ff00:0:110,[127.0.0.1]:11700")
+		read := atomic.LoadInt64(&accepted.GetMetrics().ReadBytes)
+		written := atomic.LoadInt64(&dialed.GetReplyMetrics().WrittenBytes)
+
+		streams := make([]*QUICStream, 3)
+		for i := range streams {
+			stream, err := dialed.OpenStream()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stream.Close()
+			streams[i] = stream
+		}
+		// Written in reverse order, each stream is read on its own
+		for i := len(streams) - 1; i >= 0; i-- {
+			_, err := streams[i].Write([]byte(fmt.Sprintf("stream %d", i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		received := make(map[string]bool)
+		for range streams {
+			stream := acceptStream(t, accepted)
+			defer stream.Close()
+			stream.SetReadDeadline(time.Now().Add(time.Second))
+			buf := make([]byte, 8)
+			_, err := io.ReadFull(stream, buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			received[string(buf)] = true
+		}
+		for i := range streams {
+			if expected := fmt.Sprintf("stream %d", i); !received[expected] {
+				t.Errorf("Expected %q to be received, got %v", expected, received)
+			}
+		}
+
+		// Only the data of the streams is counted, not their type
+		if n := atomic.LoadInt64(&dialed.GetReplyMetrics().WrittenBytes) - written; n != 24 {
+			t.Errorf("Expected 24 written bytes, got %d", n)
+		}
+		if n := atomic.LoadInt64(&accepted.GetMetrics().ReadBytes) - read; n != 24 {
+			t.Errorf("Expected 24 read bytes, got %d", n)
+		}
+	})
+
+	t.Run("Unknown Stream Type Is Closed", func(t *testing.T) {
+		dialed, accepted, _ := dialEmulatedQUICConn(t, "1-ff00:0:113,[127.0.0.2]:21800", "1-ff00:0:110,[127.0.0.1]:11800")
+
+		raw, err := dialed.session.OpenStreamSync(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = raw.Write([]byte{0xff})
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = raw.Read(make([]byte, 1))
+		if err != io.EOF {
+			t.Errorf("Expected the peer to close the stream, got %v", err)
+		}
+
+		// The unknown stream is not passed to AcceptStream
+		stream, err := dialed.OpenStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stream.Close()
+		_, err = stream.Write([]byte("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := acceptStream(t, accepted)
+		if s.StreamID() != stream.StreamID() {
+			t.Errorf("Expected stream %d, got %d", stream.StreamID(), s.StreamID())
+		}
+	})
+
+	t.Run("AcceptStream Fails After Close", func(t *testing.T) {
+		dialed, accepted, _ := dialEmulatedQUICConn(t, "1-ff00:0:113,[127.0.0.2]:21900", "1-ff00:0:110,[127.0.0.1]:11900")
+
+		err := accepted.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = accepted.AcceptStream()
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Expected net.ErrClosed after the local close, got %v", err)
+		}
+
+		errs := make(chan error, 1)
+		go func() {
+			_, err := dialed.AcceptStream()
+			errs <- err
+		}()
+		select {
+		case err := <-errs:
+			if !errors.Is(err, packets.ErrPeerClosed) {
+				t.Errorf("Expected packets.ErrPeerClosed after the peer closed, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected AcceptStream to return after the peer closed")
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package socket
+
+import (
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/sirupsen/logrus"
+)
+
+// ReadReport tells the remote how many bytes per second arrived on one conn
+type ReadReport struct {
+	// Local port of the reporting side, i.e. the remote port of the conn at the receiver of the report
+	Port          int
+	ReadBandwidth int64
+	Interval      time.Duration
+}
+
+func (ps *PeerSession) setReadReportInterval(interval time.Duration) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.readReportInterval = interval
+}
+
+// Sends ReadReports over cc until the control channel of the session changes,
+// which happens when the session is closed
+func (ps *PeerSession) runReadReports(cc *controlChannel, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastBytes := make(map[packets.UDPConn]int64)
+	lastReport := time.Now()
+	for range ticker.C {
+		if ps.getControl() != cc {
+			return
+		}
+
+		now := time.Now()
+		elapsed := now.Sub(lastReport)
+		lastReport = now
+		reports := make([]ReadReport, 0)
+		current := make(map[packets.UDPConn]int64)
+		for _, c := range ps.GetConnections() {
+			local, ok := c.LocalAddr().(*snet.UDPAddr)
+			if !ok || local == nil {
+				continue
+			}
+			readBytes := c.GetMetrics().ReadBytes
+			current[c] = readBytes
+			last, ok := lastBytes[c]
+			if !ok {
+				continue
+			}
+			reports = append(reports, ReadReport{
+				Port:          local.Host.Port,
+				ReadBandwidth: int64(float64(readBytes-last) / elapsed.Seconds()),
+				Interval:      elapsed,
+			})
+		}
+		lastBytes = current
+
+		if len(reports) == 0 {
+			continue
+		}
+		err := cc.Send(&ControlPacket{Type: ControlReadReport, Reports: reports})
+		if err != nil {
+			logrus.Debug("[PeerSession] Failed to send read report to ", ps.Remote, ": ", err)
+		}
+	}
+}
+
+// Stores the reported bandwidth in the metrics of the path each conn sends over
+func (ps *PeerSession) handleReadReports(reports []ReadReport) {
+	conns := ps.GetConnections()
+	for _, r := range reports {
+		for _, c := range conns {
+			remote := c.GetRemote()
+			if remote == nil || remote.Host.Port != r.Port {
+				continue
+			}
+			m := c.GetMetrics()
+			if ac, ok := c.(packets.AsymmetricConn); ok {
+				m = ac.GetReplyMetrics()
+			}
+			m.AddPeerReadBandwidth(r.ReadBandwidth, r.Interval)
+		}
+	}
+}
@@ -0,0 +1,658 @@
+package socket
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/congestion"
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/sirupsen/logrus"
+)
+
+// Packet types of the reliable layer
+const (
+	reliableData = iota + 1
+	reliableAck
+)
+
+const (
+	// Type and sequence number
+	reliableHeaderSize = 5
+	// Type, cumulative ack, receive window and number of SACK blocks
+	reliableAckHeaderSize = 8
+	maxSackBlocks         = 16
+	// Packets are lost once this many later packets were acknowledged
+	dupThreshold = 3
+
+	initialRTO           = 1 * time.Second
+	minRTO               = 200 * time.Millisecond
+	maxRTO               = 60 * time.Second
+	reliableTick         = 10 * time.Millisecond
+	reliableCloseTimeout = 5 * time.Second
+	defaultReceiveWindow = 1024
+	// Consecutive retransmission timeouts without an ack until the conn fails
+	defaultMaxRetransmissions = 8
+)
+
+// Maximum size of a message written to a ReliableConn
+const ReliablePayloadSize = packets.PACKET_SIZE - reliableHeaderSize
+
+var ErrMessageTooLarge = errors.New("message exceeds ReliablePayloadSize")
+var ErrRetransmissionLimit = errors.New("no ack received within the retransmission limit")
+var ErrPathDown = errors.New("path is down, no keepalives received")
+
+// ReliableOptions enable the reliable message layer on raw SCION conns.
+// Both peers have to use it
+type ReliableOptions struct {
+	// Creates the congestion controller of each conn, congestion.NewCubic if nil
+	Congestion congestion.Constructor
+	// Number of received messages buffered for the application,
+	// advertised to the sender as receive window
+	ReceiveWindow int
+	// Number of consecutive retransmission timeouts without an ack, after
+	// which the conn fails with ErrRetransmissionLimit. Defaults to 8
+	MaxRetransmissions int
+}
+
+type sentPacket struct {
+	data          []byte
+	sentAt        time.Time
+	retransmitted bool
+	lost          bool
+}
+
+// ReliableConn adds sequencing, acknowledgements with selective acks,
+// retransmissions and congestion control to an unreliable path conn.
+// Each Write is delivered as one message by Read, in order and without
+// loss. RTT and losses are reported into the metrics of the conn's path.
+// Sequence numbers do not wrap, which limits a conn to 2^32 messages
+type ReliableConn struct {
+	packets.UDPConn
+	cc   congestion.Controller
+	opts ReliableOptions
+
+	mutex    sync.Mutex
+	sendCond *sync.Cond
+	// Sender state
+	nextSeq       uint32
+	inflight      map[uint32]*sentPacket
+	highestAcked  int64
+	peerWindow    int
+	srtt          time.Duration
+	rttvar        time.Duration
+	rto           time.Duration
+	recoveryEnd   uint32
+	lastTimeout   time.Time
+	timeouts      int
+	writeDeadline time.Time
+	// Receiver state
+	expected     uint32
+	outOfOrder   map[uint32][]byte
+	delivered    [][]byte
+	readable     chan struct{}
+	readDeadline time.Time
+
+	err    error
+	closed bool
+	done   chan struct{}
+}
+
+func NewReliableConn(conn packets.UDPConn, opts ReliableOptions) *ReliableConn {
+	if opts.Congestion == nil {
+		opts.Congestion = congestion.NewCubic
+	}
+	if opts.ReceiveWindow <= 0 {
+		opts.ReceiveWindow = defaultReceiveWindow
+	}
+	if opts.MaxRetransmissions <= 0 {
+		opts.MaxRetransmissions = defaultMaxRetransmissions
+	}
+
+	rc := &ReliableConn{
+		UDPConn:      conn,
+		cc:           opts.Congestion(),
+		opts:         opts,
+		inflight:     make(map[uint32]*sentPacket),
+		highestAcked: -1,
+		peerWindow:   opts.ReceiveWindow,
+		rto:          initialRTO,
+		outOfOrder:   make(map[uint32][]byte),
+		readable:     make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	rc.sendCond = sync.NewCond(&rc.mutex)
+	go rc.receive()
+	go rc.retransmitTimer()
+	return rc
+}
+
+// Packets in flight are limited by the congestion window and the
+// receive window of the peer. At least one packet is always allowed,
+// it probes the receive window of the peer once it is full
+func (rc *ReliableConn) sendWindow() int {
+	w := rc.cc.Window()
+	if rc.peerWindow < w {
+		w = rc.peerWindow
+	}
+	if w < 1 {
+		return 1
+	}
+	return w
+}
+
+// Metrics of the path packets are sent over
+func (rc *ReliableConn) sendMetrics() *packets.PathMetrics {
+	if ac, ok := rc.UDPConn.(packets.AsymmetricConn); ok {
+		return ac.GetReplyMetrics()
+	}
+	return rc.UDPConn.GetMetrics()
+}
+
+// Write blocks until the congestion and receive window allow to send b
+// or the write deadline passed
+func (rc *ReliableConn) Write(b []byte) (int, error) {
+	if len(b) > ReliablePayloadSize {
+		return 0, ErrMessageTooLarge
+	}
+
+	rc.mutex.Lock()
+	var timer *time.Timer
+	var armed time.Time
+	for rc.err == nil && !rc.closed && len(rc.inflight) >= rc.sendWindow() {
+		if !rc.writeDeadline.IsZero() && !time.Now().Before(rc.writeDeadline) {
+			rc.mutex.Unlock()
+			stopTimer(timer)
+			return 0, os.ErrDeadlineExceeded
+		}
+		// Wakes the wait once the deadline passed, deadlines set
+		// while waiting broadcast and are armed in the next iteration
+		if !rc.writeDeadline.Equal(armed) {
+			stopTimer(timer)
+			timer, armed = nil, rc.writeDeadline
+			if !armed.IsZero() {
+				timer = time.AfterFunc(time.Until(armed), rc.wakeWriters)
+			}
+		}
+		rc.sendCond.Wait()
+	}
+	stopTimer(timer)
+	if rc.err != nil {
+		err := rc.err
+		rc.mutex.Unlock()
+		return 0, err
+	}
+	if rc.closed {
+		rc.mutex.Unlock()
+		return 0, net.ErrClosed
+	}
+
+	seq := rc.nextSeq
+	rc.nextSeq++
+	pkt := make([]byte, reliableHeaderSize+len(b))
+	pkt[0] = reliableData
+	binary.BigEndian.PutUint32(pkt[1:], seq)
+	copy(pkt[reliableHeaderSize:], b)
+	rc.inflight[seq] = &sentPacket{data: pkt, sentAt: time.Now()}
+	rc.mutex.Unlock()
+
+	err := rc.send(pkt)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Sends pkt over the underlying conn. Errors that do not end the conn
+// are only logged, lost packets are recovered by retransmissions
+func (rc *ReliableConn) send(pkt []byte) error {
+	_, err := rc.UDPConn.Write(pkt)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, packets.ErrPeerClosed) || errors.Is(err, net.ErrClosed) {
+		rc.fail(err)
+		return err
+	}
+	logrus.Debug("[ReliableConn] Failed to send to ", rc.GetRemote(), ": ", err)
+	return nil
+}
+
+// Read returns the next message in order
+func (rc *ReliableConn) Read(b []byte) (int, error) {
+	for {
+		rc.mutex.Lock()
+		if len(rc.delivered) > 0 {
+			msg := rc.delivered[0]
+			wasFull := len(rc.delivered) >= rc.opts.ReceiveWindow
+			rc.delivered = rc.delivered[1:]
+			var ack []byte
+			if wasFull {
+				// Announce the reopened receive window
+				ack = rc.buildAck()
+			}
+			rc.mutex.Unlock()
+			if ack != nil {
+				rc.send(ack)
+			}
+			return copy(b, msg), nil
+		}
+		err, closed, deadline := rc.err, rc.closed, rc.readDeadline
+		rc.mutex.Unlock()
+
+		if err != nil {
+			return 0, err
+		}
+		if closed {
+			return 0, net.ErrClosed
+		}
+
+		if deadline.IsZero() {
+			select {
+			case <-rc.readable:
+			case <-rc.done:
+			}
+			continue
+		}
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-rc.readable:
+			timer.Stop()
+		case <-rc.done:
+			timer.Stop()
+		case <-timer.C:
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (rc *ReliableConn) receive() {
+	buf := make([]byte, packets.PACKET_SIZE)
+	for {
+		n, err := rc.UDPConn.Read(buf)
+		if err != nil {
+			rc.fail(err)
+			return
+		}
+		if n == 0 {
+			continue
+		}
+
+		switch buf[0] {
+		case reliableData:
+			if n < reliableHeaderSize {
+				continue
+			}
+			payload := make([]byte, n-reliableHeaderSize)
+			copy(payload, buf[reliableHeaderSize:n])
+			rc.handleData(binary.BigEndian.Uint32(buf[1:]), payload)
+		case reliableAck:
+			rc.handleAck(buf[:n])
+		default:
+			logrus.Trace("[ReliableConn] Ignoring unknown packet type ", buf[0])
+		}
+	}
+}
+
+func (rc *ReliableConn) handleData(seq uint32, payload []byte) {
+	rc.mutex.Lock()
+	window := rc.opts.ReceiveWindow - len(rc.delivered)
+	if seq >= rc.expected && int64(seq)-int64(rc.expected) < int64(window) {
+		if seq == rc.expected {
+			rc.delivered = append(rc.delivered, payload)
+			rc.expected++
+			for {
+				next, ok := rc.outOfOrder[rc.expected]
+				if !ok {
+					break
+				}
+				delete(rc.outOfOrder, rc.expected)
+				rc.delivered = append(rc.delivered, next)
+				rc.expected++
+			}
+		} else if _, ok := rc.outOfOrder[seq]; !ok {
+			rc.outOfOrder[seq] = payload
+		}
+	}
+	// Duplicates and packets beyond the window are acked as well,
+	// which tells the sender the current state of the receiver
+	ack := rc.buildAck()
+	rc.mutex.Unlock()
+
+	select {
+	case rc.readable <- struct{}{}:
+	default:
+	}
+	rc.send(ack)
+}
+
+// Ack consists of the next expected sequence number, the receive window
+// and up to maxSackBlocks ranges [start, end) of out of order packets
+func (rc *ReliableConn) buildAck() []byte {
+	window := rc.opts.ReceiveWindow - len(rc.delivered)
+	if window < 0 {
+		window = 0
+	}
+	if window > 0xffff {
+		window = 0xffff
+	}
+
+	seqs := make([]uint32, 0, len(rc.outOfOrder))
+	for seq := range rc.outOfOrder {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	blocks := make([][2]uint32, 0)
+	for _, seq := range seqs {
+		if len(blocks) > 0 && blocks[len(blocks)-1][1] == seq {
+			blocks[len(blocks)-1][1]++
+			continue
+		}
+		if len(blocks) == maxSackBlocks {
+			break
+		}
+		blocks = append(blocks, [2]uint32{seq, seq + 1})
+	}
+
+	ack := make([]byte, reliableAckHeaderSize+8*len(blocks))
+	ack[0] = reliableAck
+	binary.BigEndian.PutUint32(ack[1:], rc.expected)
+	binary.BigEndian.PutUint16(ack[5:], uint16(window))
+	ack[7] = byte(len(blocks))
+	for i, block := range blocks {
+		binary.BigEndian.PutUint32(ack[reliableAckHeaderSize+8*i:], block[0])
+		binary.BigEndian.PutUint32(ack[reliableAckHeaderSize+8*i+4:], block[1])
+	}
+	return ack
+}
+
+func (rc *ReliableConn) handleAck(ack []byte) {
+	if len(ack) < reliableAckHeaderSize {
+		return
+	}
+	cumulative := binary.BigEndian.Uint32(ack[1:])
+	window := int(binary.BigEndian.Uint16(ack[5:]))
+	numBlocks := int(ack[7])
+	if len(ack) < reliableAckHeaderSize+8*numBlocks {
+		return
+	}
+	blocks := make([][2]uint32, numBlocks)
+	for i := range blocks {
+		blocks[i][0] = binary.BigEndian.Uint32(ack[reliableAckHeaderSize+8*i:])
+		blocks[i][1] = binary.BigEndian.Uint32(ack[reliableAckHeaderSize+8*i+4:])
+	}
+	isAcked := func(seq uint32) bool {
+		if seq < cumulative {
+			return true
+		}
+		for _, block := range blocks {
+			if seq >= block[0] && seq < block[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	now := time.Now()
+	rc.mutex.Lock()
+	rc.peerWindow = window
+
+	acked := 0
+	var rtt time.Duration
+	var rttSentAt time.Time
+	for seq, sp := range rc.inflight {
+		if !isAcked(seq) {
+			continue
+		}
+		// Karn's algorithm, retransmitted packets give ambiguous samples
+		if !sp.retransmitted && sp.sentAt.After(rttSentAt) {
+			rtt = now.Sub(sp.sentAt)
+			rttSentAt = sp.sentAt
+		}
+		if int64(seq) > rc.highestAcked {
+			rc.highestAcked = int64(seq)
+		}
+		delete(rc.inflight, seq)
+		acked++
+	}
+	if rtt > 0 {
+		rc.updateRTT(rtt)
+	}
+
+	retransmit := make([][]byte, 0)
+	lossInWindow := false
+	for seq, sp := range rc.inflight {
+		if sp.lost || int64(seq)+dupThreshold > rc.highestAcked {
+			continue
+		}
+		sp.lost = true
+		sp.retransmitted = true
+		sp.sentAt = now
+		retransmit = append(retransmit, sp.data)
+		if seq >= rc.recoveryEnd {
+			lossInWindow = true
+		}
+	}
+
+	if acked > 0 {
+		rc.cc.OnAck(acked, rtt)
+		rc.timeouts = 0
+	}
+	if lossInWindow {
+		rc.cc.OnLoss()
+		rc.recoveryEnd = rc.nextSeq
+	}
+	if len(retransmit) > 0 {
+		m := rc.sendMetrics()
+		m.LostPackets += int64(len(retransmit))
+		m.RetransmittedPackets += int64(len(retransmit))
+	}
+	rc.sendCond.Broadcast()
+	rc.mutex.Unlock()
+
+	for _, pkt := range retransmit {
+		rc.send(pkt)
+	}
+}
+
+// RTO estimation of RFC 6298
+func (rc *ReliableConn) updateRTT(rtt time.Duration) {
+	if rc.srtt == 0 {
+		rc.srtt = rtt
+		rc.rttvar = rtt / 2
+	} else {
+		diff := rc.srtt - rtt
+		if diff < 0 {
+			diff = -diff
+		}
+		rc.rttvar = (3*rc.rttvar + diff) / 4
+		rc.srtt = (7*rc.srtt + rtt) / 8
+	}
+	rc.rto = rc.srtt + 4*rc.rttvar
+	if rc.rto < minRTO {
+		rc.rto = minRTO
+	}
+	if rc.rto > maxRTO {
+		rc.rto = maxRTO
+	}
+
+	m := rc.sendMetrics()
+	m.RTT = rc.srtt
+	if m.MinRTT == 0 || rtt < m.MinRTT {
+		m.MinRTT = rtt
+	}
+}
+
+// Retransmits packets that were not acked within the RTO
+func (rc *ReliableConn) retransmitTimer() {
+	ticker := time.NewTicker(reliableTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rc.done:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		rc.mutex.Lock()
+		if len(rc.inflight) > 0 && rc.err == nil && rc.UDPConn.GetState() == packets.ConnectionStates.Down {
+			rc.mutex.Unlock()
+			logrus.Warn("[ReliableConn] Path to ", rc.GetRemote(), " is down, failing conn with unacked packets")
+			rc.fail(ErrPathDown)
+			return
+		}
+		retransmit := make([][]byte, 0)
+		for _, sp := range rc.inflight {
+			if now.Sub(sp.sentAt) < rc.rto {
+				continue
+			}
+			sp.retransmitted = true
+			sp.sentAt = now
+			retransmit = append(retransmit, sp.data)
+		}
+		if len(retransmit) > 0 {
+			// Back off once per RTO, not for each expired packet
+			if now.Sub(rc.lastTimeout) >= rc.rto {
+				if rc.timeouts >= rc.opts.MaxRetransmissions {
+					rc.mutex.Unlock()
+					logrus.Warn("[ReliableConn] No ack from ", rc.GetRemote(), " after ", rc.timeouts, " retransmissions, failing conn")
+					rc.fail(ErrRetransmissionLimit)
+					return
+				}
+				rc.timeouts++
+				rc.cc.OnTimeout()
+				rc.recoveryEnd = rc.nextSeq
+				rc.lastTimeout = now
+				rc.rto *= 2
+				if rc.rto > maxRTO {
+					rc.rto = maxRTO
+				}
+			}
+			m := rc.sendMetrics()
+			m.LostPackets += int64(len(retransmit))
+			m.RetransmittedPackets += int64(len(retransmit))
+		}
+		rc.mutex.Unlock()
+
+		for _, pkt := range retransmit {
+			rc.send(pkt)
+		}
+	}
+}
+
+func (rc *ReliableConn) wakeWriters() {
+	rc.mutex.Lock()
+	rc.sendCond.Broadcast()
+	rc.mutex.Unlock()
+}
+
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+func (rc *ReliableConn) fail(err error) {
+	rc.mutex.Lock()
+	if rc.err == nil {
+		rc.err = err
+	}
+	rc.sendCond.Broadcast()
+	rc.mutex.Unlock()
+
+	select {
+	case rc.readable <- struct{}{}:
+	default:
+	}
+}
+
+// Close waits until the messages written so far are acked or
+// reliableCloseTimeout elapsed, then closes the underlying conn
+func (rc *ReliableConn) Close() error {
+	rc.mutex.Lock()
+	if rc.closed {
+		rc.mutex.Unlock()
+		return nil
+	}
+	rc.closed = true
+	rc.sendCond.Broadcast()
+	deadline := time.Now().Add(reliableCloseTimeout)
+	for len(rc.inflight) > 0 && rc.err == nil && time.Now().Before(deadline) &&
+		rc.UDPConn.GetState() != packets.ConnectionStates.Closed {
+		rc.mutex.Unlock()
+		time.Sleep(reliableTick)
+		rc.mutex.Lock()
+	}
+	rc.mutex.Unlock()
+
+	close(rc.done)
+	if r, ok := rc.cc.(congestion.Releaser); ok {
+		r.Release()
+	}
+	return rc.UDPConn.Close()
+}
+
+// Congestion returns the controller of the conn
+func (rc *ReliableConn) Congestion() congestion.Controller {
+	return rc.cc
+}
+
+func (rc *ReliableConn) SetDeadline(t time.Time) error {
+	rc.SetReadDeadline(t)
+	return rc.SetWriteDeadline(t)
+}
+
+func (rc *ReliableConn) SetReadDeadline(t time.Time) error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	rc.readDeadline = t
+	return nil
+}
+
+// Limits the time Write blocks on the windows
+func (rc *ReliableConn) SetWriteDeadline(t time.Time) error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	rc.writeDeadline = t
+	rc.sendCond.Broadcast()
+	return nil
+}
+
+func (rc *ReliableConn) GetReplyPath() *snet.Path {
+	if ac, ok := rc.UDPConn.(packets.AsymmetricConn); ok {
+		return ac.GetReplyPath()
+	}
+	return rc.GetPath()
+}
+
+func (rc *ReliableConn) SetReplyPath(path *snet.Path) error {
+	if ac, ok := rc.UDPConn.(packets.AsymmetricConn); ok {
+		return ac.SetReplyPath(path)
+	}
+	return errors.New("reply path can only be set on accepted conns")
+}
+
+func (rc *ReliableConn) GetReplyMetrics() *packets.PathMetrics {
+	return rc.sendMetrics()
+}
+
+func (rc *ReliableConn) markPeerClosed() {
+	if pc, ok := rc.UDPConn.(peerCloser); ok {
+		pc.markPeerClosed()
+	}
+}
+
+func (rc *ReliableConn) startKeepalive(opts KeepaliveOptions) {
+	if kc, ok := rc.UDPConn.(keepaliveConn); ok {
+		kc.startKeepalive(opts)
+	}
+}
+
+var _ packets.AsymmetricConn = (*ReliableConn)(nil)
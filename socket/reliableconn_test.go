@@ -0,0 +1,99 @@
+package socket
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// Path conn whose peer never answers, all packets written
+// to it are dropped and Read blocks until it is closed
+type blackholeConn struct {
+	packets.BasicConn
+	metrics *packets.PathMetrics
+	closed  chan struct{}
+}
+
+func newBlackholeConn() *blackholeConn {
+	c := &blackholeConn{metrics: packets.NewPathMetrics(time.Second), closed: make(chan struct{})}
+	c.SetState(packets.ConnectionStates.Open)
+	return c
+}
+
+func (c *blackholeConn) Read(b []byte) (int, error) {
+	<-c.closed
+	return 0, net.ErrClosed
+}
+
+func (c *blackholeConn) Write(b []byte) (int, error) { return len(b), nil }
+
+func (c *blackholeConn) Close() error {
+	if c.GetState() != packets.ConnectionStates.Closed {
+		c.SetState(packets.ConnectionStates.Closed)
+		close(c.closed)
+	}
+	return nil
+}
+
+func (c *blackholeConn) LocalAddr() net.Addr                { return nil }
+func (c *blackholeConn) RemoteAddr() net.Addr               { return nil }
+func (c *blackholeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *blackholeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *blackholeConn) SetWriteDeadline(t time.Time) error { return nil }
+func (c *blackholeConn) GetMetrics() *packets.PathMetrics   { return c.metrics }
+func (c *blackholeConn) GetPath() *snet.Path                { return nil }
+func (c *blackholeConn) SetPath(*snet.Path) error           { return nil }
+func (c *blackholeConn) GetRemote() *snet.UDPAddr           { return nil }
+
+func Test_ReliableConn(t *testing.T) {
+	t.Run("Write Deadline", func(t *testing.T) {
+		rc := NewReliableConn(newBlackholeConn(), ReliableOptions{ReceiveWindow: 1})
+		defer rc.Close()
+		if _, err := rc.Write([]byte("first")); err != nil {
+			t.Fatal(err)
+		}
+		rc.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+		start := time.Now()
+		if _, err := rc.Write([]byte("second")); !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("Expected the deadline to be exceeded on the full window, got %v", err)
+		}
+		if time.Since(start) > time.Second {
+			t.Errorf("Expected Write to return at the deadline, took %s", time.Since(start))
+		}
+	})
+
+	t.Run("Retransmission Limit Without Acks", func(t *testing.T) {
+		rc := NewReliableConn(newBlackholeConn(), ReliableOptions{ReceiveWindow: 1, MaxRetransmissions: 1})
+		defer rc.Close()
+		if _, err := rc.Write([]byte("first")); err != nil {
+			t.Fatal(err)
+		}
+		// Retransmitted after 1s, fails after the backed off RTO of 2s
+		rc.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if _, err := rc.Write([]byte("second")); !errors.Is(err, ErrRetransmissionLimit) {
+			t.Errorf("Expected ErrRetransmissionLimit, got %v", err)
+		}
+		if m := rc.GetMetrics(); m.RetransmittedPackets != 1 {
+			t.Errorf("Expected 1 retransmission, got %d", m.RetransmittedPackets)
+		}
+	})
+
+	t.Run("Path Down", func(t *testing.T) {
+		conn := newBlackholeConn()
+		rc := NewReliableConn(conn, ReliableOptions{ReceiveWindow: 1})
+		defer rc.Close()
+		if _, err := rc.Write([]byte("first")); err != nil {
+			t.Fatal(err)
+		}
+		conn.CompareAndSetState(packets.ConnectionStates.Open, packets.ConnectionStates.Down)
+		rc.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := rc.Write([]byte("second")); !errors.Is(err, ErrPathDown) {
+			t.Errorf("Expected ErrPathDown, got %v", err)
+		}
+	})
+}
@@ -4,15 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
 	"github.com/netsys-lab/scion-path-discovery/packets"
 	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
 	"github.com/netsys-lab/scion-path-discovery/pathselection"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
 	"github.com/scionproto/scion/go/lib/snet"
 	"github.com/scionproto/scion/go/lib/snet/path"
 	"github.com/sirupsen/logrus"
@@ -21,6 +24,7 @@ import (
 )
 
 type SCIONConn struct {
+	packets.BasicConn
 	internalConn pan.Conn
 	peer         string
 	remote       *snet.UDPAddr
@@ -29,25 +33,63 @@ type SCIONConn struct {
 	local        *snet.UDPAddr
 	socketLocal  *snet.UDPAddr
 	selector     *pathselection.FixedSelector
+	// Accepted conns only: path and selector for outgoing packets
+	replyPath     *snet.Path
+	replySelector *pathselection.FixedSelector
+	closed        int32
+	peerClosed    int32
+	mutex         sync.Mutex
+	keepalive     *keepalive
 }
 
 // This simply wraps conn.Read and will later collect metrics
+// In-band frames of the remote are handled here and not returned
 func (qc *SCIONConn) Read(b []byte) (int, error) {
-	n, err := qc.internalConn.Read(b)
-	if err != nil {
-		return n, err
+	if k := qc.getKeepalive(); k != nil {
+		n, err := k.read(b)
+		if err != nil {
+			if atomic.LoadInt32(&qc.peerClosed) == 1 {
+				return 0, packets.ErrPeerClosed
+			}
+			return n, err
+		}
+		m := qc.GetMetrics()
+		m.ReadBytes += int64(n)
+		m.ReadPackets++
+		return n, nil
+	}
+
+	for {
+		n, err := qc.internalConn.Read(b)
+		if err != nil {
+			if atomic.LoadInt32(&qc.peerClosed) == 1 {
+				return 0, packets.ErrPeerClosed
+			}
+			return n, err
+		}
+
+		switch parseFrame(b[:n]) {
+		case 0:
+			m := qc.GetMetrics()
+			m.ReadBytes += int64(n)
+			m.ReadPackets++
+			return n, err
+		case frameClose:
+			logrus.Debug("[SCIONConn] Remote ", qc.remote.String(), " closed conn")
+			qc.markPeerClosed()
+			return 0, packets.ErrPeerClosed
+		}
 	}
-	m := qc.GetMetrics()
-	m.ReadBytes += int64(n)
-	m.ReadPackets++
-	return n, err
 }
 
 // This simply wraps conn.Write and will later collect metrics
 func (qc *SCIONConn) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(&qc.peerClosed) == 1 {
+		return 0, packets.ErrPeerClosed
+	}
 	n, err := qc.internalConn.Write(b)
 
-	m := qc.GetMetrics()
+	m := qc.GetReplyMetrics()
 	m.WrittenBytes += int64(n)
 	m.WrittenPackets++
 	if err != nil {
@@ -56,10 +98,22 @@ func (qc *SCIONConn) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Close notifies the remote with a close frame, unless
+// the remote closed the conn first, and closes the pan conn
 func (qc *SCIONConn) Close() error {
-	if qc.internalConn == nil {
+	if qc.internalConn == nil || !atomic.CompareAndSwapInt32(&qc.closed, 0, 1) {
 		return nil
 	}
+	qc.SetState(packets.ConnectionStates.Closed)
+	if k := qc.getKeepalive(); k != nil {
+		k.stop()
+	}
+	if atomic.LoadInt32(&qc.peerClosed) == 0 {
+		_, err := qc.internalConn.Write(newFrame(frameClose))
+		if err != nil {
+			logrus.Debug("[SCIONConn] Failed to send close frame to ", qc.remote.String(), ": ", err)
+		}
+	}
 	err := qc.internalConn.Close()
 	if err != nil {
 		return err
@@ -68,6 +122,29 @@ func (qc *SCIONConn) Close() error {
 	return nil
 }
 
+func (qc *SCIONConn) markPeerClosed() {
+	atomic.StoreInt32(&qc.peerClosed, 1)
+	qc.SetState(packets.ConnectionStates.Closed)
+}
+
+// Sends keepalives and reads in the background from now on,
+// GetState reports Down if the remote stays silent
+func (qc *SCIONConn) startKeepalive(opts KeepaliveOptions) {
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
+	if qc.keepalive != nil || !opts.Enabled() {
+		return
+	}
+	qc.keepalive = newKeepalive(qc, opts)
+	qc.keepalive.run()
+}
+
+func (qc *SCIONConn) getKeepalive() *keepalive {
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
+	return qc.keepalive
+}
+
 func (qc *SCIONConn) GetMetrics() *packets.PathMetrics {
 	// return qc.metrics
 	return packets.GetMetricsDB().GetOrCreate(qc.socketLocal, qc.path)
@@ -87,6 +164,33 @@ func (qc *SCIONConn) SetPath(path *snet.Path) error {
 	return nil
 }
 
+// Path used for outgoing packets, differs from GetPath if
+// the accepting socket selected its own paths
+func (qc *SCIONConn) GetReplyPath() *snet.Path {
+	if qc.replyPath != nil {
+		return qc.replyPath
+	}
+	return qc.path
+}
+
+// Sends further packets over path, which has to be one of the paths
+// to the remote, returns pathselection.ErrPathNotFound otherwise
+func (qc *SCIONConn) SetReplyPath(path *snet.Path) error {
+	if qc.replySelector == nil {
+		return errors.New("reply path can only be set on accepted conns")
+	}
+	_, err := qc.replySelector.SwitchPath(*path)
+	if err != nil {
+		return err
+	}
+	qc.replyPath = path
+	return nil
+}
+
+func (qc *SCIONConn) GetReplyMetrics() *packets.PathMetrics {
+	return packets.GetMetricsDB().GetOrCreate(qc.socketLocal, qc.GetReplyPath())
+}
+
 func (qc *SCIONConn) GetRemote() *snet.UDPAddr {
 	return qc.remote
 }
@@ -99,11 +203,21 @@ func (qc *SCIONConn) RemoteAddr() net.Addr {
 	return qc.remote
 }
 
+// With keepalives, the read deadline applies to the packets
+// received in the background instead of the pan conn
 func (qc *SCIONConn) SetDeadline(t time.Time) error {
+	if k := qc.getKeepalive(); k != nil {
+		k.setReadDeadline(t)
+		return qc.internalConn.SetWriteDeadline(t)
+	}
 	return qc.internalConn.SetDeadline(t)
 }
 
 func (qc *SCIONConn) SetReadDeadline(t time.Time) error {
+	if k := qc.getKeepalive(); k != nil {
+		k.setReadDeadline(t)
+		return nil
+	}
 	return qc.internalConn.SetReadDeadline(t)
 }
 
@@ -111,17 +225,23 @@ func (qc *SCIONConn) SetWriteDeadline(t time.Time) error {
 	return qc.internalConn.SetWriteDeadline(t)
 }
 
-var _ packets.UDPConn = (*SCIONConn)(nil)
+var _ packets.AsymmetricConn = (*SCIONConn)(nil)
 
 var _ UnderlaySocket = (*SCIONSocket)(nil)
 
 type SCIONSocket struct {
 	local          string
 	localAddr      *snet.UDPAddr
-	conns          []*SCIONConn
+	session        *PeerSession
 	Conn           pan.Conn
 	ConnectedPeers []RemotePeer
 	listenConn     pan.ListenConn
+	acceptor       *sessionAcceptor
+	sessionMutex   sync.Mutex
+	sessions       map[string]*PeerSession
+	keepalive      KeepaliveOptions
+	reliable       *ReliableOptions
+	readReports    time.Duration
 }
 
 func (s *SCIONSocket) GetMetrics() []*packets.PathMetrics {
@@ -179,9 +299,12 @@ func (s *SCIONSocket) AggregateMetrics() *packets.PathMetrics {
 func NewSCIONSocket(local string) *SCIONSocket {
 	s := SCIONSocket{
 		local:          local,
-		conns:          make([]*SCIONConn, 0),
+		session:        NewPeerSession(nil, nil),
 		ConnectedPeers: make([]RemotePeer, 0),
+		acceptor:       newSessionAcceptor(),
+		sessions:       make(map[string]*PeerSession),
 	}
+	s.session.transport = &s
 
 	gob.Register(path.Path{})
 
@@ -195,11 +318,12 @@ func (s *SCIONSocket) Listen() error {
 	if err != nil {
 		return err
 	}
+	s.session.Local = lAddr
 
 	ipP := pan.IPPortValue{}
 	shortAddr := fmt.Sprintf("%s:%d", lAddr.Host.IP, lAddr.Host.Port)
 	ipP.Set(shortAddr)
-	listener, err := pan.ListenUDP(context.Background(), ipP.Get(), nil)
+	listener, err := scionhost.ListenUDP(context.Background(), ipP.Get(), nil)
 	if err != nil {
 		return err
 	}
@@ -211,30 +335,61 @@ func (s *SCIONSocket) Listen() error {
 
 // TODO: This needs to be done for each incoming conn
 func (s *SCIONSocket) WaitForIncomingConn(lAddr snet.UDPAddr) (packets.UDPConn, error) {
+	l, err := s.listenForConn(lAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := l.accept(s.localAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	s.session.AddConn(conn)
+	logrus.Debug("[SCIONSocket] Added new Conn: ", s.local, " to ", conn.GetRemote().String())
+	return conn, nil
+}
+
+// Listener of one conn, which is replaced by a conn dialed
+// back to the remote once its handshake arrived
+type scionIncomingConn struct {
+	s        *SCIONSocket
+	listener pan.ListenConn
+	lAddr    snet.UDPAddr
+}
+
+func (s *SCIONSocket) listenForConn(lAddr snet.UDPAddr) (incomingConn, error) {
 	ipP := pan.IPPortValue{}
 	shortAddr := fmt.Sprintf("%s:%d", lAddr.Host.IP, lAddr.Host.Port)
 	ipP.Set(shortAddr)
 
 	logrus.Debug("[SCIONSocket] Waiting for Incoming Conn, new Listener on ", lAddr.String())
-	listener, err := pan.ListenUDP(context.Background(), ipP.Get(), nil)
+	listener, err := scionhost.ListenUDP(context.Background(), ipP.Get(), nil)
 	if err != nil {
 		return nil, err
 	}
+	lAddr.Host.Port = boundPort(listener.LocalAddr())
+	return &scionIncomingConn{s: s, listener: listener, lAddr: lAddr}, nil
+}
 
+func (in *scionIncomingConn) local() *snet.UDPAddr {
+	return &in.lAddr
+}
+
+func (in *scionIncomingConn) close() error {
+	return in.listener.Close()
+}
+
+func (in *scionIncomingConn) accept(metricsLocal *snet.UDPAddr) (packets.UDPConn, error) {
+	lAddr := in.lAddr
 	logrus.Debug("[SCIONSocket] Reading handshake on ", lAddr.String())
 
 	bts := make([]byte, packets.PACKET_SIZE)
-	_, panRemote, panPath, err := listener.ReadFromVia(bts)
+	_, panRemote, panPath, err := in.listener.ReadFromVia(bts)
+	in.listener.Close()
 	if err != nil {
 		return nil, err
 	}
 
-	sel := pathselection.FixedSelector{
-		FixedPath: panPath,
-	}
-	err = listener.Close()
-	conn, err := pan.DialUDP(context.Background(), ipP.Get(), panRemote, nil, &sel)
-
 	p := DialPacket{}
 	network := bytes.NewBuffer(bts) // Stand-in for a network connection
 	dec := gob.NewDecoder(network)
@@ -243,6 +398,17 @@ func (s *SCIONSocket) WaitForIncomingConn(lAddr snet.UDPAddr) (packets.UDPConn,
 		return nil, err
 	}
 
+	sel := pathselection.FixedSelector{
+		FixedPath: panPath,
+	}
+	ipP := pan.IPPortValue{}
+	shortAddr := fmt.Sprintf("%s:%d", lAddr.Host.IP, lAddr.Host.Port)
+	ipP.Set(shortAddr)
+	conn, err := scionhost.DialUDP(context.Background(), ipP.Get(), panRemote, nil, &sel)
+	if err != nil {
+		return nil, err
+	}
+
 	logrus.Debug("[SCIONSocket] Got handshake from remote ", p.Addr.String(), " over path ", lookup.PathToString(p.Path))
 
 	// Send reply
@@ -258,18 +424,17 @@ func (s *SCIONSocket) WaitForIncomingConn(lAddr snet.UDPAddr) (packets.UDPConn,
 	logrus.Debug("[SCIONSocket] Answer handshake to ", p.Addr.String())
 
 	quicConn := &SCIONConn{
-		internalConn: conn,
-		path:         &p.Path,
-		remote:       &p.Addr,
-		metrics:      packets.GetMetricsDB().GetOrCreate(s.localAddr, &p.Path),
-		local:        &lAddr,
-		socketLocal:  s.localAddr,
+		internalConn:  conn,
+		path:          &p.Path,
+		remote:        &p.Addr,
+		metrics:       packets.GetMetricsDB().GetOrCreate(metricsLocal, &p.Path),
+		local:         &lAddr,
+		socketLocal:   metricsLocal,
+		replySelector: &sel,
 	}
+	quicConn.SetState(packets.ConnectionStates.Open)
 
-	s.conns = append(s.conns, quicConn)
-	logrus.Debug("[SCIONSocket] Added new Conn: ", s.local, " to ", p.Addr.String())
-
-	return quicConn, nil
+	return in.s.pathConn(quicConn), nil
 }
 
 func (s *SCIONSocket) WaitForDialIn() (*snet.UDPAddr, error) {
@@ -288,55 +453,101 @@ func (s *SCIONSocket) WaitForDialIn() (*snet.UDPAddr, error) {
 	ipP := pan.IPPortValue{}
 	shortAddr := fmt.Sprintf("%s:%d", s.localAddr.Host.IP, s.localAddr.Host.Port)
 	ipP.Set(shortAddr)
-	conn, err := pan.DialUDP(context.Background(), ipP.Get(), panRemote, nil, &sel)
+	conn, err := scionhost.DialUDP(context.Background(), ipP.Get(), panRemote, nil, &sel)
 	s.Conn = conn
 
-	p := HandshakePacket{}
-	network := bytes.NewBuffer(bts) // Stand-in for a network connection
-	dec := gob.NewDecoder(network)
-	err = dec.Decode(&p)
+	err = s.session.acceptHandshake(bts, conn.Write)
 	if err != nil {
 		return nil, err
 	}
 
-	logrus.Debug("[SCIONSocket] Got handshake from ", p.Addr.String(), " for ports=", len(p.Ports))
+	control := newDatagramControlChannel(conn.Write, s.session.handleControl)
+	control.closer = conn.Close
+	s.session.setControl(control)
+	go control.runDatagram(conn.Read)
 
-	var wg sync.WaitGroup
-	ret := HandshakePacket{}
-	ret.Ports = make([]int, 0)
-	for i := 0; i < p.NumPorts; i++ {
-		wg.Add(1)
-		ret.Ports = append(ret.Ports, s.localAddr.Host.Port+11*(i+1)+52*len(s.ConnectedPeers))
-		go func(i int) {
-			l := s.localAddr.Copy()
-			l.Host.Port = l.Host.Port + 11*(i+1) + 52*len(s.ConnectedPeers)
-			_, err := s.WaitForIncomingConn(*l)
+	addr := *s.session.Remote
+	return &addr, nil
+}
+
+// Accept waits for the next peer dialing into this socket and returns
+// a session containing all of its connections. In contrast to WaitForDialIn,
+// the listener stays open, so Accept can be called repeatedly to serve
+// many peers. Handshakes of different peers are processed concurrently.
+// Accept and WaitForDialIn must not be mixed on the same socket
+func (s *SCIONSocket) Accept() (*PeerSession, error) {
+	return s.acceptor.next(s.acceptLoop)
+}
+
+func (s *SCIONSocket) acceptLoop() {
+	logrus.Debug("[SCIONSocket] Accepting peers on ", s.local)
+	for {
+		bts := make([]byte, packets.PACKET_SIZE)
+		n, panRemote, panPath, err := s.listenConn.ReadFromVia(bts)
+		if err != nil {
+			s.acceptor.deliver(nil, err)
+			return
+		}
+
+		s.sessionMutex.Lock()
+		session, known := s.sessions[panRemote.String()]
+		if !known {
+			// Reserve the entry, so that duplicated handshakes are ignored
+			s.sessions[panRemote.String()] = nil
+		}
+		s.sessionMutex.Unlock()
+		if known {
+			// Established peers use the listener as control channel
+			if session != nil && session.getControl() != nil {
+				session.getControl().handleDatagram(bts[:n])
+			} else {
+				logrus.Trace("[SCIONSocket] Ignoring packet from pending peer ", panRemote.String())
+			}
+			continue
+		}
+
+		go func() {
+			session, err := s.acceptSession(bts, panRemote, panPath)
 			if err != nil {
-				log.Error(err)
-				return
+				s.sessionMutex.Lock()
+				delete(s.sessions, panRemote.String())
+				s.sessionMutex.Unlock()
 			}
-			logrus.Debugf("[SCIONSocket] Dialed In %d of %d on %s from remote %s", i+1, p.NumPorts, l.String(), p.Addr.String())
-			wg.Done()
-		}(i)
+			s.acceptor.deliver(session, err)
+		}()
 	}
+}
 
-	// Send reply
+func (s *SCIONSocket) acceptSession(bts []byte, panRemote pan.UDPAddr, panPath *pan.Path) (*PeerSession, error) {
+	session := NewPeerSession(s.localAddr, nil)
+	session.transport = s
+	session.metricsPerConn = true
+	session.setKeepalive(s.keepalive)
+	session.setReadReportInterval(s.readReports)
 
-	ret.Addr = *s.localAddr
-	ret.NumPorts = p.NumPorts
-	// ret.Ports = p.Ports
+	err := session.acceptHandshake(bts, func(b []byte) (int, error) {
+		return s.listenConn.WriteToVia(b, panRemote, panPath)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	var network2 bytes.Buffer
-	enc := gob.NewEncoder(&network2)
+	session.setControl(newDatagramControlChannel(func(b []byte) (int, error) {
+		return s.listenConn.WriteToVia(b, panRemote, panPath)
+	}, session.handleControl))
+	session.release = func() {
+		s.sessionMutex.Lock()
+		defer s.sessionMutex.Unlock()
+		if s.sessions[panRemote.String()] == session {
+			delete(s.sessions, panRemote.String())
+		}
+	}
 
-	// TODO: Reliable
-	err = enc.Encode(ret)
-	conn.Write(network2.Bytes())
-	logrus.Debug("[SCIONSocket] Sending handshake response to ", p.Addr.String())
+	s.sessionMutex.Lock()
+	s.sessions[panRemote.String()] = session
+	s.sessionMutex.Unlock()
 
-	wg.Wait()
-	addr := p.Addr
-	return &addr, nil
+	return session, nil
 }
 
 func (s *SCIONSocket) DialAll(remote snet.UDPAddr, path []pathselection.PathQuality, options DialOptions) ([]packets.UDPConn, error) {
@@ -352,23 +563,18 @@ func (s *SCIONSocket) DialAll(remote snet.UDPAddr, path []pathselection.PathQual
 	logrus.Debug("[SCIONSocket] Dialing all to ", remote.String())
 
 	selector := &pathselection.FixedSelector{}
-	conn, err := pan.DialUDP(context.Background(), netaddr.IPPort{}, panAddr, nil, selector)
+	conn, err := scionhost.DialUDP(context.Background(), netaddr.IPPort{}, panAddr, nil, selector)
 	if err != nil {
 		return nil, err
 	}
 
 	logrus.Debug("[SCIONSocket] Opened base conn to ", remote.String())
 	s.Conn = conn
-	// Send handshake
+	s.session.Remote = &remote
+	// Send handshake, the remote responds with the ports to dial
 	ret := HandshakePacket{}
 	ret.Addr = *s.localAddr
 	ret.NumPorts = options.NumPaths
-	ret.Ports = make([]int, options.NumPaths)
-
-	for i := 0; i < options.NumPaths; i++ {
-		port := remote.Host.Port + (i+1)*11 + 52*len(s.ConnectedPeers) // TODO: Boundary check, better ranges
-		ret.Ports = append(ret.Ports, port)
-	}
 
 	var network2 bytes.Buffer
 	enc := gob.NewEncoder(&network2)
@@ -396,38 +602,53 @@ func (s *SCIONSocket) DialAll(remote snet.UDPAddr, path []pathselection.PathQual
 		log.Error("From decode")
 		return nil, err
 	}
-	logrus.Debug("[SCIONSocket] Completed handshake to ", remote.String(), " with ports=", len(ret.Ports))
+	logrus.Debug("[SCIONSocket] Completed handshake to ", remote.String(), " with ports=", len(ps.Ports))
+	if len(ps.Ports) < len(path) {
+		return nil, fmt.Errorf("remote accepts %d conns, %d paths requested", len(ps.Ports), len(path))
+	}
 
-	// TODO: Ports may change here...
 	var wg sync.WaitGroup
 
 	for i, p := range path {
 		wg.Add(1)
 		go func(i int, p snet.Path) {
+			defer wg.Done()
 			l := remote.Copy()
 
 			l.Host.Port = ps.Ports[i]
 
-			local := s.localAddr.Copy()
-			local.Host.Port = local.Host.Port + (i+1)*11 + 52*len(s.ConnectedPeers)
-			// Waitgroup here before sending back response
+			local := s.session.nextLocal()
 			_, err := s.Dial(*local, *l, p)
 			if err != nil {
 				log.Error(err)
 				return
 			}
 			logrus.Debugf("[SCIONSocket] Dialed %d of %d on %s to remote %s", i, options.NumPaths, s.local, l.String())
-			wg.Done()
 		}(i, p.SnetPath)
 	}
 	wg.Wait()
 
+	control := newDatagramControlChannel(conn.Write, s.session.handleControl)
+	control.closer = conn.Close
+	s.session.setControl(control)
+	go control.runDatagram(conn.Read)
+
 	log.Warn("DIAL ALL Done")
 
 	return s.GetConnections(), nil
 }
 
 func (s *SCIONSocket) Dial(local, remote snet.UDPAddr, path snet.Path) (packets.UDPConn, error) {
+	conn, err := s.dial(local, remote, path)
+	if err != nil {
+		return nil, err
+	}
+
+	s.session.AddConn(conn)
+	return conn, nil
+}
+
+func (s *SCIONSocket) dial(local, remote snet.UDPAddr, path snet.Path) (packets.UDPConn, error) {
 	panAddr, err := pan.ResolveUDPAddr(remote.String())
 	if err != nil {
 		return nil, err
@@ -442,10 +663,12 @@ func (s *SCIONSocket) Dial(local, remote snet.UDPAddr, path snet.Path) (packets.
 	selector.SetPathFromSnet(path)
 
 	logrus.Debug("[SCIONSocket] Dial new conn from ", local.String(), " to ", remote.String())
-	session, err := pan.DialUDP(context.Background(), ipP.Get(), panAddr, nil, selector)
+	session, err := scionhost.DialUDP(context.Background(), ipP.Get(), panAddr, nil, selector)
 	if err != nil {
 		return nil, err
 	}
+	// The remote learns the port chosen by the OS from the handshake
+	local.Host.Port = boundPort(session.LocalAddr())
 
 	logrus.Debug("[SCIONSocket] Dialed new conn from ", local.String(), " to ", remote.String(), " over path ", lookup.PathToString(path))
 
@@ -469,7 +692,7 @@ func (s *SCIONSocket) Dial(local, remote snet.UDPAddr, path snet.Path) (packets.
 		metrics:      packets.GetMetricsDB().GetOrCreate(s.localAddr, &path),
 		socketLocal:  s.localAddr,
 		selector:     selector,
-		// local:        session.LocalAddr(), // TODO: Local Addr
+		local:        &local,
 	}
 
 	// For loop, deadline, write packet, read response
@@ -495,30 +718,71 @@ func (s *SCIONSocket) Dial(local, remote snet.UDPAddr, path snet.Path) (packets.
 		break
 	}
 
+	// Reset the handshake deadline, later reads must not time out
+	quicConn.SetReadDeadline(time.Time{})
 	logrus.Debug("[SCIONSocket] Dial complete from ", local.String(), " to ", remote.String())
+	quicConn.SetState(packets.ConnectionStates.Open)
 
-	s.conns = append(s.conns, quicConn)
-	return quicConn, nil
+	return s.pathConn(quicConn), nil
 }
 
-func (s *SCIONSocket) GetConnections() []packets.UDPConn {
-	conns := make([]packets.UDPConn, 0)
-	for _, c := range s.conns {
-		conns = append(conns, c)
+// Enables keepalives for all conns opened from now on
+func (s *SCIONSocket) SetKeepalive(opts KeepaliveOptions) {
+	s.keepalive = opts
+	s.session.setKeepalive(opts)
+}
+
+// Lets all sessions report the bandwidth received per conn to the remote
+// every interval, starting with the next connection. 0 disables the reports
+func (s *SCIONSocket) SetReadReportInterval(interval time.Duration) {
+	s.readReports = interval
+	s.session.setReadReportInterval(interval)
+}
+
+// Enables the reliable message layer for all conns opened from now on,
+// nil disables it. The remote has to use the same setting
+func (s *SCIONSocket) SetReliability(opts *ReliableOptions) {
+	s.reliable = opts
+}
+
+// Wraps conn into a ReliableConn if reliability is enabled. Keepalives
+// start before, so that the background reader of the ReliableConn
+// does not compete with the one of the keepalives
+func (s *SCIONSocket) pathConn(conn *SCIONConn) packets.UDPConn {
+	if s.reliable == nil {
+		return conn
 	}
-	return conns
+	conn.startKeepalive(s.keepalive)
+	return NewReliableConn(conn, *s.reliable)
 }
 
+func (s *SCIONSocket) GetConnections() []packets.UDPConn {
+	return s.session.GetConnections()
+}
+
+// Session of the peer connected via DialAll or WaitForDialIn
+func (s *SCIONSocket) GetSession() *PeerSession {
+	return s.session
+}
+
+// Closes the session of the connected peer and all accepted sessions,
+// each remote peer is notified
 func (s *SCIONSocket) CloseAll() []error {
-	errors := make([]error, 0)
-	for _, con := range s.conns {
-		err := con.Close()
-		if err != nil {
-			errors = append(errors, err)
+	errors := s.session.CloseAll()
+	s.ConnectedPeers = make([]RemotePeer, 0)
+
+	// Sessions remove themselves from the map when closed
+	s.sessionMutex.Lock()
+	sessions := make([]*PeerSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		if session != nil {
+			sessions = append(sessions, session)
 		}
 	}
+	s.sessionMutex.Unlock()
 
-	s.conns = make([]*SCIONConn, 0)
-	s.ConnectedPeers = make([]RemotePeer, 0)
+	for _, session := range sessions {
+		errors = append(errors, session.CloseAll()...)
+	}
 	return errors
 }
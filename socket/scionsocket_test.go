@@ -1,10 +1,16 @@
 package socket
 
 import (
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	"github.com/netsys-lab/scion-path-discovery/packets"
 	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
 	"github.com/netsys-lab/scion-path-discovery/pathselection"
+	"github.com/scionproto/scion/go/lib/snet"
 )
 
 func Test_SCIONSocket(t *testing.T) {
@@ -64,4 +70,163 @@ func Test_SCIONSocket(t *testing.T) {
 		sock2.CloseAll()
 	})
 
+	t.Run("SCIONSocket Close Notifies Peer", func(t *testing.T) {
+		sock := NewSCIONSocket("1-ff00:0:110,[127.0.0.12]:32001")
+		err := sock.Listen()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer sock.CloseAll()
+
+		sock2 := NewSCIONSocket("1-ff00:0:110,[127.0.0.12]:12000")
+		err = sock2.Listen()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		go func() {
+			paths, err := lookup.PathLookup("1-ff00:0:110,[127.0.0.12]:32001")
+			if err != nil || len(paths) == 0 {
+				t.Error("No paths found for local AS, something is wrong here...")
+				return
+			}
+
+			pathQualities := []pathselection.PathQuality{{Id: "FirstPath", SnetPath: paths[0]}}
+			sock2.DialAll(*sock.localAddr, pathQualities, DialOptions{SendAddrPacket: true})
+		}()
+
+		_, err = sock.WaitForDialIn()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		conns := sock.GetConnections()
+		if len(conns) != 1 {
+			t.Errorf("Expected 1 conn, got %d", len(conns))
+			return
+		}
+
+		sock2.CloseAll()
+		buf := make([]byte, packets.PACKET_SIZE)
+		_, err = conns[0].Read(buf)
+		if err != packets.ErrPeerClosed {
+			t.Errorf("Expected ErrPeerClosed, got %v", err)
+		}
+	})
+
+	t.Run("SCIONSocket Reports Read Bandwidth", func(t *testing.T) {
+		sock := NewSCIONSocket("1-ff00:0:110,[127.0.0.12]:32101")
+		sock.SetReadReportInterval(100 * time.Millisecond)
+		err := sock.Listen()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer sock.CloseAll()
+
+		sock2 := NewSCIONSocket("1-ff00:0:110,[127.0.0.12]:12100")
+		err = sock2.Listen()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer sock2.CloseAll()
+
+		go func() {
+			paths, err := lookup.PathLookup("1-ff00:0:110,[127.0.0.12]:32101")
+			if err != nil || len(paths) == 0 {
+				t.Error("No paths found for local AS, something is wrong here...")
+				return
+			}
+
+			pathQualities := []pathselection.PathQuality{{Id: "FirstPath", SnetPath: paths[0]}}
+			sock2.DialAll(*sock.localAddr, pathQualities, DialOptions{SendAddrPacket: true})
+		}()
+
+		_, err = sock.WaitForDialIn()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		go func() {
+			buf := make([]byte, packets.PACKET_SIZE)
+			for {
+				_, err := sock.GetConnections()[0].Read(buf)
+				if err != nil {
+					return
+				}
+			}
+		}()
+
+		conns := sock2.GetConnections()
+		if len(conns) != 1 {
+			t.Errorf("Expected 1 conn, got %d", len(conns))
+			return
+		}
+		buf := make([]byte, 1000)
+		for i := 0; i < 50; i++ {
+			conns[0].Write(buf)
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if _, ok := conns[0].GetMetrics().PeerGoodput(); !ok {
+			t.Error("Expected read reports of the remote")
+		}
+	})
+}
+
+func Test_SCIONConn(t *testing.T) {
+	via111 := testutil.Path("1-ff00:0:110", 1, "1-ff00:0:111", 1, "1-ff00:0:111", 2, "1-ff00:0:113", 1)
+	via112 := testutil.Path("1-ff00:0:110", 2, "1-ff00:0:112", 1, "1-ff00:0:112", 2, "1-ff00:0:113", 2)
+	via114 := testutil.Path("1-ff00:0:110", 3, "1-ff00:0:114", 1, "1-ff00:0:114", 2, "1-ff00:0:113", 3)
+
+	// Accepted conn whose remote is reachable via 111 and 112
+	acceptedConn := func() *SCIONConn {
+		sel := &pathselection.FixedSelector{}
+		sel.Initialize(pan.UDPAddr{}, pan.UDPAddr{}, []*pan.Path{lookup.PanPath(via111), lookup.PanPath(via112)})
+		var path snet.Path = via111
+		return &SCIONConn{path: &path, replySelector: sel}
+	}
+
+	t.Run("Reply Path Is Switched", func(t *testing.T) {
+		conn := acceptedConn()
+		var path snet.Path = via112
+		err := conn.SetReplyPath(&path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := lookup.PanFingerprint(conn.replySelector.Path()); got != lookup.Fingerprint(via112) {
+			t.Errorf("Expected replies over %s, got %s", lookup.Fingerprint(via112), got)
+		}
+		if conn.GetReplyPath() != &path {
+			t.Error("Expected the reply path to be reported")
+		}
+	})
+
+	t.Run("Unknown Reply Path Is Rejected", func(t *testing.T) {
+		conn := acceptedConn()
+		var path snet.Path = via114
+		err := conn.SetReplyPath(&path)
+		if !errors.Is(err, pathselection.ErrPathNotFound) {
+			t.Fatalf("Expected ErrPathNotFound, got %v", err)
+		}
+		if got := lookup.PanFingerprint(conn.replySelector.Path()); got != lookup.Fingerprint(via111) {
+			t.Errorf("Expected replies over %s, got %s", lookup.Fingerprint(via111), got)
+		}
+		if conn.GetReplyPath() != conn.GetPath() {
+			t.Error("Expected the reply path to stay the path of the conn")
+		}
+	})
+
+	t.Run("Reply Path Requires Accepted Conn", func(t *testing.T) {
+		var path snet.Path = via111
+		conn := &SCIONConn{path: &path}
+		if err := conn.SetReplyPath(&path); err == nil {
+			t.Error("Expected an error for a dialed conn")
+		}
+	})
 }
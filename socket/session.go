@@ -0,0 +1,524 @@
+package socket
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrNoControlChannel = errors.New("session has no control channel, connect first")
+
+// Implemented by the UnderlaySockets to open further connections of a session
+type sessionTransport interface {
+	// Opens a listener for one conn on lAddr, port 0 lets the OS choose the port
+	listenForConn(lAddr snet.UDPAddr) (incomingConn, error)
+	dial(local, remote snet.UDPAddr, path snet.Path) (packets.UDPConn, error)
+}
+
+// Listener of a single conn the remote dials in. accept waits for the conn,
+// metricsLocal determines under which local address its metrics are stored.
+// close releases the listener, which makes a pending accept return an error
+type incomingConn interface {
+	local() *snet.UDPAddr
+	accept(metricsLocal *snet.UDPAddr) (packets.UDPConn, error)
+	close() error
+}
+
+// PeerSession holds all connections between a socket and
+// one particular remote peer. Listening sockets return one PeerSession per
+// peer from Accept, so the same socket can serve multiple peers at once.
+// Dialing sockets and sockets using WaitForDialIn have a single session,
+// available via GetSession
+type PeerSession struct {
+	Remote *snet.UDPAddr
+	Local  *snet.UDPAddr
+
+	mutex         sync.Mutex
+	onConnAdded   func(packets.UDPConn)
+	onConnRemoved func(packets.UDPConn)
+	onClosed      func()
+	// Set by the socket to forget accepted sessions once they are closed
+	release   func()
+	conns     []packets.UDPConn
+	transport sessionTransport
+	control   *controlChannel
+	// Accepted sessions store metrics per conn, since sessions
+	// of different peers may use the same paths
+	metricsPerConn bool
+	keepalive      KeepaliveOptions
+	// Interval of ReadReports to the remote, 0 disables them
+	readReportInterval time.Duration
+}
+
+type acceptResult struct {
+	session *PeerSession
+	err     error
+}
+
+// Passes the sessions accepted by the accept loop of a listening socket
+// to Accept. The transport-specific loop is started by the first Accept
+type sessionAcceptor struct {
+	once    sync.Once
+	results chan acceptResult
+}
+
+func newSessionAcceptor() *sessionAcceptor {
+	return &sessionAcceptor{
+		results: make(chan acceptResult),
+	}
+}
+
+// Starts loop on the first call and waits for the next accepted session
+func (a *sessionAcceptor) next(loop func()) (*PeerSession, error) {
+	a.once.Do(func() {
+		go loop()
+	})
+	res := <-a.results
+	return res.session, res.err
+}
+
+// Returns session or err from the next call to next
+func (a *sessionAcceptor) deliver(session *PeerSession, err error) {
+	a.results <- acceptResult{session: session, err: err}
+}
+
+func NewPeerSession(local, remote *snet.UDPAddr) *PeerSession {
+	return &PeerSession{
+		Local:  local,
+		Remote: remote,
+		conns:  make([]packets.UDPConn, 0),
+	}
+}
+
+// Registers callbacks for connections added or removed by the remote peer
+func (ps *PeerSession) SetConnCallbacks(added, removed func(packets.UDPConn)) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.onConnAdded = added
+	ps.onConnRemoved = removed
+}
+
+// Registers a callback that is invoked after the session was closed,
+// either locally or by a goodbye of the remote peer
+func (ps *PeerSession) SetClosedCallback(closed func()) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.onClosed = closed
+}
+
+func (ps *PeerSession) AddConn(conn packets.UDPConn) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.conns = append(ps.conns, conn)
+	if kc, ok := conn.(keepaliveConn); ok && ps.keepalive.Enabled() {
+		kc.startKeepalive(ps.keepalive)
+	}
+}
+
+func (ps *PeerSession) setKeepalive(opts KeepaliveOptions) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.keepalive = opts
+}
+
+func (ps *PeerSession) GetConnections() []packets.UDPConn {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	conns := make([]packets.UDPConn, len(ps.conns))
+	copy(conns, ps.conns)
+	return conns
+}
+
+// Metrics of all connections of this session
+func (ps *PeerSession) GetMetrics() []*packets.PathMetrics {
+	metrics := make([]*packets.PathMetrics, 0)
+	for _, c := range ps.GetConnections() {
+		metrics = append(metrics, c.GetMetrics())
+		if ac, ok := c.(packets.AsymmetricConn); ok && ac.GetReplyMetrics() != c.GetMetrics() {
+			metrics = append(metrics, ac.GetReplyMetrics())
+		}
+	}
+	return metrics
+}
+
+func (ps *PeerSession) AggregateMetrics() *packets.PathMetrics {
+	return AggregateMetrics(ps.GetMetrics())
+}
+
+// Closes the session gracefully: The remote is told via the control channel to
+// close its side, each conn sends its own close notification and the control
+// channel is closed afterwards
+func (ps *PeerSession) CloseAll() []error {
+	errors := make([]error, 0)
+	control := ps.getControl()
+	if control != nil {
+		_, err := control.Request(&ControlPacket{Type: ControlGoodbye})
+		if err != nil {
+			logrus.Debug("[PeerSession] Failed to send goodbye to ", ps.Remote, ": ", err)
+		}
+	}
+
+	errors = append(errors, ps.close(false)...)
+	if control != nil {
+		err := control.Close()
+		if err != nil {
+			errors = append(errors, err)
+		}
+	}
+	return errors
+}
+
+// Closes all conns and resets the session. If the remote closed the
+// session, conns are closed without notifying it again
+func (ps *PeerSession) close(byPeer bool) []error {
+	ps.mutex.Lock()
+	conns := ps.conns
+	ps.conns = make([]packets.UDPConn, 0)
+	ps.control = nil
+	onClosed := ps.onClosed
+	release := ps.release
+	ps.mutex.Unlock()
+
+	metrics := make([]*packets.PathMetrics, 0)
+	errors := make([]error, 0)
+	for _, con := range conns {
+		metrics = append(metrics, con.GetMetrics())
+		if ac, ok := con.(packets.AsymmetricConn); ok {
+			metrics = append(metrics, ac.GetReplyMetrics())
+		}
+		if pc, ok := con.(peerCloser); ok && byPeer {
+			pc.markPeerClosed()
+		}
+		err := con.Close()
+		if err != nil {
+			errors = append(errors, err)
+		}
+	}
+
+	if release != nil {
+		release()
+	}
+	if onClosed != nil {
+		onClosed()
+	}
+	// Removed after onClosed, which stops the collection of metrics
+	packets.GetMetricsDB().Remove(metrics...)
+	return errors
+}
+
+// Local address for a further connection of the session. The port is
+// chosen by the OS and sent to the remote in the handshake or control packet
+func (ps *PeerSession) nextLocal() *snet.UDPAddr {
+	l := ps.Local.Copy()
+	l.Host.Port = 0
+	return l
+}
+
+// Opens n listeners for conns of the session. If one of them
+// fails, the ones opened before are closed again
+func (ps *PeerSession) listenForConns(n int) ([]incomingConn, error) {
+	listeners := make([]incomingConn, 0, n)
+	for i := 0; i < n; i++ {
+		l, err := ps.transport.listenForConn(*ps.nextLocal())
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func closeListeners(listeners []incomingConn) {
+	for _, l := range listeners {
+		l.close()
+	}
+}
+
+func listenerPorts(listeners []incomingConn) []int {
+	ports := make([]int, len(listeners))
+	for i, l := range listeners {
+		ports[i] = l.local().Host.Port
+	}
+	return ports
+}
+
+// Accepted sessions store the metrics of each conn under its own local
+// address, since sessions of different peers may use the same paths
+func (ps *PeerSession) metricsLocal(l incomingConn) *snet.UDPAddr {
+	if ps.metricsPerConn {
+		return l.local()
+	}
+	return ps.Local
+}
+
+// Accepts one conn on each of the listeners and adds it to the session.
+// Once an accept fails, the remaining listeners are closed, so that no
+// accept stays blocked, and the first error is returned after all returned
+func (ps *PeerSession) acceptConns(listeners []incomingConn) error {
+	errs := make(chan error, len(listeners))
+	for i, l := range listeners {
+		go func(i int, l incomingConn) {
+			conn, err := l.accept(ps.metricsLocal(l))
+			if err != nil {
+				errs <- err
+				return
+			}
+			ps.AddConn(conn)
+			logrus.Debugf("[PeerSession] Dialed In %d of %d on %s from remote %s", i+1, len(listeners), l.local(), ps.Remote)
+			errs <- nil
+		}(i, l)
+	}
+
+	var firstErr error
+	for range listeners {
+		err := <-errs
+		if err != nil && firstErr == nil {
+			firstErr = err
+			closeListeners(listeners)
+		}
+	}
+	return firstErr
+}
+
+// Answers the handshake bts of a peer dialing in with the ports of one
+// listener per requested conn and accepts the conns on them. reply sends
+// the answer to the peer. The remote of the session is taken from the
+// handshake, its control channel has to be set up by the socket afterwards
+func (ps *PeerSession) acceptHandshake(bts []byte, reply func([]byte) (int, error)) error {
+	p := HandshakePacket{}
+	network := bytes.NewBuffer(bts) // Stand-in for a network connection
+	dec := gob.NewDecoder(network)
+	err := dec.Decode(&p)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debug("[PeerSession] Got handshake from ", p.Addr.String(), " for ports=", p.NumPorts)
+	ps.Remote = &p.Addr
+
+	listeners, err := ps.listenForConns(p.NumPorts)
+	if err != nil {
+		return err
+	}
+
+	ret := HandshakePacket{}
+	ret.Addr = *ps.Local
+	ret.NumPorts = p.NumPorts
+	ret.Ports = listenerPorts(listeners)
+
+	var network2 bytes.Buffer
+	enc := gob.NewEncoder(&network2)
+	err = enc.Encode(ret)
+	if err != nil {
+		closeListeners(listeners)
+		return err
+	}
+
+	// TODO: Reliable
+	_, err = reply(network2.Bytes())
+	if err != nil {
+		closeListeners(listeners)
+		return err
+	}
+	logrus.Debug("[PeerSession] Sending handshake response to ", p.Addr.String())
+
+	err = ps.acceptConns(listeners)
+	if err != nil {
+		// The control channel is not set up yet, so the remote is not told
+		ps.close(false)
+		return err
+	}
+	return nil
+}
+
+func (ps *PeerSession) setControl(cc *controlChannel) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.control = cc
+	if cc != nil && ps.readReportInterval > 0 {
+		go ps.runReadReports(cc, ps.readReportInterval)
+	}
+}
+
+func (ps *PeerSession) getControl() *controlChannel {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	return ps.control
+}
+
+// Opens a new connection over the passed path to the remote, without
+// affecting the other connections of the session. The remote is asked via the
+// control channel to wait for the new connection
+func (ps *PeerSession) AddPath(path snet.Path) (packets.UDPConn, error) {
+	control := ps.getControl()
+	if control == nil {
+		return nil, ErrNoControlChannel
+	}
+
+	resp, err := control.Request(&ControlPacket{Type: ControlAddPath})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Port == 0 {
+		return nil, errors.New("remote failed to listen for the added path")
+	}
+	remote := ps.Remote.Copy()
+	remote.Host.Port = resp.Port
+	local := ps.nextLocal()
+	conn, err := ps.transport.dial(*local, *remote, path)
+	if err != nil {
+		return nil, err
+	}
+
+	ps.AddConn(conn)
+	logrus.Debug("[PeerSession] Added path to ", remote.String(), " from ", local.String())
+	return conn, nil
+}
+
+// Closes the passed connection and lets the remote close its side,
+// the other connections of the session stay untouched
+func (ps *PeerSession) RemovePath(conn packets.UDPConn) error {
+	control := ps.getControl()
+	if control == nil {
+		return ErrNoControlChannel
+	}
+
+	if !ps.removeConn(conn) {
+		return errors.New("conn is not part of this session")
+	}
+
+	// The conn is closed even if the remote did not confirm the removal
+	_, err := control.Request(&ControlPacket{Type: ControlRemovePath, Port: conn.GetRemote().Host.Port})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	logrus.Debug("[PeerSession] Removed path to ", conn.GetRemote().String())
+	return conn.Close()
+}
+
+func (ps *PeerSession) removeConn(conn packets.UDPConn) bool {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	for i, c := range ps.conns {
+		if c == conn {
+			ps.conns = append(ps.conns[:i], ps.conns[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (ps *PeerSession) handleControl(p ControlPacket) {
+	switch p.Type {
+	case ControlAddPath:
+		// Port 0 tells the remote that no listener could be opened
+		resp := &ControlPacket{}
+		l, err := ps.transport.listenForConn(*ps.nextLocal())
+		if err != nil {
+			logrus.Error("[PeerSession] Failed to listen for added path: ", err)
+		} else {
+			resp.Port = l.local().Host.Port
+			go ps.acceptAddedPath(l)
+		}
+		err = ps.getControl().Respond(p, resp)
+		if err != nil {
+			logrus.Error("[PeerSession] Failed to respond to added path: ", err)
+			if l != nil {
+				l.close()
+			}
+		}
+	case ControlRemovePath:
+		for _, c := range ps.GetConnections() {
+			local, ok := c.LocalAddr().(*snet.UDPAddr)
+			if !ok || local == nil || local.Host.Port != p.Port {
+				continue
+			}
+			ps.removeConn(c)
+			if pc, ok := c.(peerCloser); ok {
+				pc.markPeerClosed()
+			}
+			c.Close()
+			ps.mutex.Lock()
+			onConnRemoved := ps.onConnRemoved
+			ps.mutex.Unlock()
+			if onConnRemoved != nil {
+				onConnRemoved(c)
+			}
+			logrus.Debug("[PeerSession] Remote removed path on port ", p.Port)
+		}
+		err := ps.getControl().Respond(p, &ControlPacket{})
+		if err != nil {
+			logrus.Error("[PeerSession] Failed to confirm removed path: ", err)
+		}
+	case ControlGoodbye:
+		logrus.Debug("[PeerSession] Remote ", ps.Remote, " closed the session")
+		control := ps.getControl()
+		if control != nil {
+			err := control.Respond(p, &ControlPacket{})
+			if err != nil {
+				logrus.Debug("[PeerSession] Failed to confirm goodbye: ", err)
+			}
+		}
+		ps.close(true)
+		if control != nil {
+			control.Close()
+		}
+	case ControlReadReport:
+		ps.handleReadReports(p.Reports)
+	default:
+		logrus.Warn("[PeerSession] Unknown control packet type ", p.Type)
+	}
+}
+
+func (ps *PeerSession) acceptAddedPath(l incomingConn) {
+	conn, err := l.accept(ps.metricsLocal(l))
+	if err != nil {
+		logrus.Error("[PeerSession] Failed to accept added path: ", err)
+		return
+	}
+	ps.AddConn(conn)
+	ps.mutex.Lock()
+	onConnAdded := ps.onConnAdded
+	ps.mutex.Unlock()
+	if onConnAdded != nil {
+		onConnAdded(conn)
+	}
+}
+
+// Sums up the bandwidth of the passed metrics in Mbit/s
+func AggregateMetrics(ms []*packets.PathMetrics) *packets.PathMetrics {
+	sumBwMbitsRead := make([]int64, 0)
+	sumBwMbitsWrite := make([]int64, 0)
+	for i, m := range ms {
+		for j, b := range m.ReadBandwidth {
+			val := int64(float64(b*8) / 1024 / 1024)
+			if i == 0 {
+				sumBwMbitsRead = append(sumBwMbitsRead, val)
+			} else if j < len(sumBwMbitsRead) {
+				sumBwMbitsRead[j] += val
+			}
+		}
+		for j, b := range m.WrittenBandwidth {
+			val := int64(float64(b*8) / 1024 / 1024)
+			if i == 0 {
+				sumBwMbitsWrite = append(sumBwMbitsWrite, val)
+			} else if j < len(sumBwMbitsWrite) {
+				sumBwMbitsWrite[j] += val
+			}
+		}
+	}
+	return &packets.PathMetrics{
+		ReadBandwidth:    sumBwMbitsRead,
+		WrittenBandwidth: sumBwMbitsWrite,
+	}
+}
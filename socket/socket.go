@@ -1,6 +1,10 @@
 package socket
 
 import (
+	"net"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
 	"github.com/netsys-lab/scion-path-discovery/packets"
 	"github.com/netsys-lab/scion-path-discovery/pathselection"
 	"github.com/scionproto/scion/go/lib/snet"
@@ -9,6 +13,11 @@ import (
 type ConnectOptions struct {
 	SendAddrPacket      bool
 	NoMetricsCollection bool
+	// Paths that are always part of the active set, as fingerprints or hop
+	// strings. Replaces the pinned paths of the socket options if set
+	PinnedPaths []string
+	// What happens if a pinned path is not available, defaults to PinFail
+	PinPolicy pathselection.PinPolicy
 }
 
 type DialOptions struct {
@@ -21,19 +30,36 @@ type DialPacket struct {
 	Path snet.Path
 }
 
+// Sent by the dialing peer with the number of conns, the response
+// contains the ports the conns are accepted on
 type HandshakePacket struct {
 	Addr     snet.UDPAddr
 	NumPorts int
 	Ports    []int
 }
 
+// Port a conn is bound to, which the OS chooses if port 0 was requested
+func boundPort(a net.Addr) int {
+	switch a := a.(type) {
+	case pan.UDPAddr:
+		return int(a.Port)
+	case *net.UDPAddr:
+		return a.Port
+	}
+	return 0
+}
+
 type UnderlaySocket interface {
 	Listen() error
 	Local() *snet.UDPAddr
 	AggregateMetrics() *packets.PathMetrics
 	WaitForDialIn() (*snet.UDPAddr, error)
+	Accept() (*PeerSession, error)
 	WaitForIncomingConn(snet.UDPAddr) (packets.UDPConn, error)
 	DialAll(remote snet.UDPAddr, path []pathselection.PathQuality, options DialOptions) ([]packets.UDPConn, error)
 	CloseAll() []error
 	GetConnections() []packets.UDPConn
+	GetSession() *PeerSession
+	SetKeepalive(KeepaliveOptions)
+	SetReadReportInterval(time.Duration)
 }
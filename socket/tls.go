@@ -0,0 +1,254 @@
+package socket
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsec-ethz/scion-apps/pkg/quicutil"
+	"github.com/scionproto/scion/go/lib/addr"
+)
+
+// ALPN used if TLSOptions do not set one
+const DefaultALPN = "scion-filetransfer"
+
+var ErrPeerNotAuthenticated = errors.New("peer certificate does not match its SCION address")
+
+// Returned if peers have to be verified by their IA without trust roots or
+// with InsecureSkipVerify, any self-signed certificate could claim an IA otherwise
+var ErrNoTrustRoots = errors.New("verifying the IA of peers requires trust roots")
+
+// TLSOptions configure the identity of a QUICSocket and how it authenticates
+// its peers. Without trust roots, peers are not verified, which is only suitable
+// for testing since any on-path host can impersonate a peer
+type TLSOptions struct {
+	// Used as base for all QUIC conns if set. NextProtos is overwritten by ALPN,
+	// its RootCAs and ClientCAs are used as trust roots if RootCAs is not set.
+	// Its VerifyPeerCertificate runs after the chain was verified against the
+	// trust roots, InsecureSkipVerify disables that verification. Its ClientAuth
+	// is raised to require a certificate if clients are verified
+	Config *tls.Config
+	// Own certificate chain, a self-signed certificate is generated if empty
+	Certificates []tls.Certificate
+	// Trust roots for the certificates of peers, enables mutual authentication
+	RootCAs *x509.CertPool
+	// Requires the certificate of each peer to be tied to the IA of its SCION
+	// address, see NewIACertificate. Requires trust roots
+	VerifyPeerIA bool
+	// Application protocol negotiated for all QUIC conns, DefaultALPN if empty
+	ALPN string
+
+	once         sync.Once
+	certificates []tls.Certificate
+}
+
+// Checks that the options authenticate peers if they are required to
+func (o *TLSOptions) validate() error {
+	if o.VerifyPeerIA && (o.serverRoots() == nil || o.clientRoots() == nil || o.skipVerify()) {
+		return ErrNoTrustRoots
+	}
+	return nil
+}
+
+// True if the Config disables the verification of peer chains
+func (o *TLSOptions) skipVerify() bool {
+	return o.Config != nil && o.Config.InsecureSkipVerify
+}
+
+// Trust roots for the certificates of servers, RootCAs of the options or
+// the Config. Falls back to the ClientCAs, so one pool serves both sides
+func (o *TLSOptions) serverRoots() *x509.CertPool {
+	switch {
+	case o.RootCAs != nil:
+		return o.RootCAs
+	case o.Config == nil:
+		return nil
+	case o.Config.RootCAs != nil:
+		return o.Config.RootCAs
+	}
+	return o.Config.ClientCAs
+}
+
+// Trust roots for the certificates of clients, RootCAs of the options or
+// ClientCAs of the Config. Falls back to the RootCAs of the Config
+func (o *TLSOptions) clientRoots() *x509.CertPool {
+	switch {
+	case o.RootCAs != nil:
+		return o.RootCAs
+	case o.Config == nil:
+		return nil
+	case o.Config.ClientCAs != nil:
+		return o.Config.ClientCAs
+	}
+	return o.Config.RootCAs
+}
+
+func (o *TLSOptions) alpn() []string {
+	if o.ALPN == "" {
+		return []string{DefaultALPN}
+	}
+	return []string{o.ALPN}
+}
+
+func (o *TLSOptions) getCertificates() []tls.Certificate {
+	o.once.Do(func() {
+		switch {
+		case len(o.Certificates) > 0:
+			o.certificates = o.Certificates
+		case o.Config != nil && len(o.Config.Certificates) > 0:
+			o.certificates = o.Config.Certificates
+		default:
+			o.certificates = quicutil.MustGenerateSelfSignedCert()
+		}
+	})
+	return o.certificates
+}
+
+func (o *TLSOptions) baseConfig(roots *x509.CertPool, usage x509.ExtKeyUsage) *tls.Config {
+	cfg := &tls.Config{}
+	if o.Config != nil {
+		cfg = o.Config.Clone()
+	}
+	cfg.Certificates = o.getCertificates()
+	cfg.NextProtos = o.alpn()
+	if o.skipVerify() {
+		roots = nil
+	}
+	// Peers are identified by their SCION address instead of a hostname,
+	// so the chain is verified in verifyChain
+	cfg.InsecureSkipVerify = true
+	verify := cfg.VerifyPeerCertificate
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		chains, err := verifyChain(roots, usage, rawCerts)
+		if err != nil || verify == nil {
+			return err
+		}
+		return verify(rawCerts, chains)
+	}
+	return cfg
+}
+
+// Config for accepting QUIC conns, clients have to present
+// a certificate if they are verified
+func (o *TLSOptions) serverConfig() *tls.Config {
+	roots := o.clientRoots()
+	cfg := o.baseConfig(roots, x509.ExtKeyUsageClientAuth)
+	if (roots != nil && !o.skipVerify()) || o.VerifyPeerIA {
+		switch cfg.ClientAuth {
+		case tls.NoClientCert, tls.RequestClientCert:
+			cfg.ClientAuth = tls.RequireAnyClientCert
+		case tls.VerifyClientCertIfGiven:
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return cfg
+}
+
+// Config for dialing QUIC conns
+func (o *TLSOptions) clientConfig() *tls.Config {
+	return o.baseConfig(o.serverRoots(), x509.ExtKeyUsageServerAuth)
+}
+
+// Verifies the chain presented by a peer against roots and returns the
+// verified chains. Without roots, any chain is accepted
+func verifyChain(roots *x509.CertPool, usage x509.ExtKeyUsage, rawCerts [][]byte) ([][]*x509.Certificate, error) {
+	if roots == nil {
+		return nil, nil
+	}
+	if len(rawCerts) == 0 {
+		return nil, errors.New("peer did not present a certificate")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, err
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	return certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	})
+}
+
+// Checks that the peer of session presented a certificate for its IA.
+// This runs after the handshake, since the TLS callbacks do not know
+// the SCION address of the peer
+func (o *TLSOptions) verifySession(session quic.Session) error {
+	if !o.VerifyPeerIA {
+		return nil
+	}
+	remote, ok := session.RemoteAddr().(pan.UDPAddr)
+	if !ok {
+		return fmt.Errorf("unexpected remote address %s", session.RemoteAddr())
+	}
+
+	certs := session.ConnectionState().TLS.PeerCertificates
+	if len(certs) == 0 || !CertificateHasIA(certs[0], addr.IA(remote.IA)) {
+		session.CloseWithError(quic.ApplicationErrorCode(1), "peer not authenticated")
+		return ErrPeerNotAuthenticated
+	}
+	return nil
+}
+
+// URI under which the IA is stored in the subject alternative names
+func iaURI(ia addr.IA) *url.URL {
+	return &url.URL{Scheme: "scion", Opaque: ia.String()}
+}
+
+// Returns true if cert is tied to ia
+func CertificateHasIA(cert *x509.Certificate, ia addr.IA) bool {
+	expected := iaURI(ia).String()
+	for _, uri := range cert.URIs {
+		if uri.String() == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// Creates a certificate for key that is tied to ia, signed by parent.
+// The IA is stored as URI "scion:<IA>" in the subject alternative names
+func NewIACertificate(ia addr.IA, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer, validity time.Duration) (tls.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: ia.String()},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		URIs:         []*url.URL{iaURI(ia)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der, parent.Raw},
+		PrivateKey:  key,
+	}, nil
+}
@@ -0,0 +1,239 @@
+package socket
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/netsys-lab/scion-path-discovery/pathselection"
+	"github.com/netsys-lab/scion-path-discovery/scionhost"
+	"github.com/scionproto/scion/go/lib/addr"
+)
+
+// Creates a self-signed certificate for key. A CA may sign other
+// certificates, otherwise the certificate claims to belong to ia
+func selfSignedCertificate(t *testing.T, key *ecdsa.PrivateKey, ca bool, ia addr.IA) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: ia.String()},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+	}
+	if !ca {
+		template.URIs = append(template.URIs, iaURI(ia))
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func Test_TLSOptions(t *testing.T) {
+	server, client := testutil.MustIA("1-ff00:0:113"), testutil.MustIA("1-ff00:0:110")
+	caKey := newKey(t)
+	ca := selfSignedCertificate(t, caKey, true, addr.IA{})
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	issue := func(ia addr.IA) tls.Certificate {
+		cert, err := NewIACertificate(ia, newKey(t), ca, caKey, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	forgedKey := newKey(t)
+	forged := tls.Certificate{
+		Certificate: [][]byte{selfSignedCertificate(t, forgedKey, false, server).Raw},
+		PrivateKey:  forgedKey,
+	}
+
+	t.Run("VerifyPeerIA Requires Trust Roots", func(t *testing.T) {
+		sock := NewQUICSocket("1-ff00:0:113,[127.0.0.2]:21200")
+		err := sock.SetTLSOptions(&TLSOptions{VerifyPeerIA: true})
+		if !errors.Is(err, ErrNoTrustRoots) {
+			t.Errorf("Expected ErrNoTrustRoots, got %v", err)
+		}
+		err = sock.Listen()
+		if !errors.Is(err, ErrNoTrustRoots) {
+			sock.CloseAll()
+			t.Errorf("Expected Listen to fail with ErrNoTrustRoots, got %v", err)
+		}
+
+		err = sock.SetTLSOptions(&TLSOptions{VerifyPeerIA: true, Config: &tls.Config{RootCAs: roots}})
+		if err != nil {
+			t.Errorf("Expected the RootCAs of the Config to be used, got %v", err)
+		}
+	})
+
+	t.Run("Config Trust Roots Are Used", func(t *testing.T) {
+		opts := &TLSOptions{Config: &tls.Config{RootCAs: roots}}
+		err := opts.clientConfig().VerifyPeerCertificate(forged.Certificate, nil)
+		if err == nil {
+			t.Errorf("Expected the forged certificate to be rejected by the client")
+		}
+		err = opts.clientConfig().VerifyPeerCertificate(issue(server).Certificate, nil)
+		if err != nil {
+			t.Errorf("Expected the issued certificate to be accepted, got %v", err)
+		}
+
+		opts = &TLSOptions{Config: &tls.Config{ClientCAs: roots}}
+		cfg := opts.serverConfig()
+		if cfg.ClientAuth != tls.RequireAnyClientCert {
+			t.Errorf("Expected the server to request client certificates, got %v", cfg.ClientAuth)
+		}
+		if err := cfg.VerifyPeerCertificate(forged.Certificate, nil); err == nil {
+			t.Errorf("Expected the forged certificate to be rejected by the server")
+		}
+	})
+
+	t.Run("Config Settings Are Kept", func(t *testing.T) {
+		var chains [][]*x509.Certificate
+		calls := 0
+		opts := &TLSOptions{Config: &tls.Config{
+			RootCAs: roots,
+			VerifyPeerCertificate: func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+				calls++
+				chains = verifiedChains
+				return nil
+			},
+		}}
+		if err := opts.clientConfig().VerifyPeerCertificate(forged.Certificate, nil); err == nil || calls != 0 {
+			t.Errorf("Expected the chain to be verified before the callback of the Config")
+		}
+		if err := opts.clientConfig().VerifyPeerCertificate(issue(server).Certificate, nil); err != nil || calls != 1 {
+			t.Errorf("Expected the callback of the Config to run for the issued certificate, got %v", err)
+		}
+		if len(chains) == 0 || !chains[0][len(chains[0])-1].Equal(ca) {
+			t.Errorf("Expected the callback to get the chains verified against the trust roots")
+		}
+
+		for authType, expected := range map[tls.ClientAuthType]tls.ClientAuthType{
+			tls.NoClientCert:               tls.RequireAnyClientCert,
+			tls.RequestClientCert:          tls.RequireAnyClientCert,
+			tls.RequireAnyClientCert:       tls.RequireAnyClientCert,
+			tls.VerifyClientCertIfGiven:    tls.RequireAndVerifyClientCert,
+			tls.RequireAndVerifyClientCert: tls.RequireAndVerifyClientCert,
+		} {
+			opts := &TLSOptions{Config: &tls.Config{ClientCAs: roots, ClientAuth: authType}}
+			if cfg := opts.serverConfig(); cfg.ClientAuth != expected {
+				t.Errorf("Expected ClientAuth %v to be raised to %v, got %v", authType, expected, cfg.ClientAuth)
+			}
+		}
+
+		opts = &TLSOptions{Config: &tls.Config{RootCAs: roots, InsecureSkipVerify: true}}
+		if err := opts.clientConfig().VerifyPeerCertificate(forged.Certificate, nil); err != nil {
+			t.Errorf("Expected InsecureSkipVerify to accept any certificate, got %v", err)
+		}
+		opts.VerifyPeerIA = true
+		if err := opts.validate(); !errors.Is(err, ErrNoTrustRoots) {
+			t.Errorf("Expected VerifyPeerIA to be rejected with InsecureSkipVerify, got %v", err)
+		}
+	})
+
+	network := newEmulatedNetwork(t)
+	scionhost.SetNetwork(network)
+	defer scionhost.SetNetwork(nil)
+	defer network.Close()
+
+	dial := func(serverOpts, clientOpts *TLSOptions, port int) (*QUICSocket, *QUICSocket, error) {
+		sock := NewQUICSocket(fmt.Sprintf("1-ff00:0:113,[127.0.0.2]:%d", port))
+		sock.SetTLSOptions(serverOpts)
+		err := sock.Listen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sock2 := NewQUICSocket(fmt.Sprintf("1-ff00:0:110,[127.0.0.1]:%d", port-10000))
+		sock2.SetTLSOptions(clientOpts)
+		err = sock2.Listen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths, err := lookup.PathLookup(sock.localAddr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = sock2.DialAll(*sock.localAddr, []pathselection.PathQuality{{SnetPath: paths[0]}}, DialOptions{SendAddrPacket: true})
+		return sock, sock2, err
+	}
+
+	t.Run("Forged IA Certificate Is Rejected", func(t *testing.T) {
+		sock, sock2, err := dial(
+			&TLSOptions{Certificates: []tls.Certificate{forged}},
+			&TLSOptions{Certificates: []tls.Certificate{issue(client)}, RootCAs: roots, VerifyPeerIA: true},
+			21210,
+		)
+		defer sock.CloseAll()
+		defer sock2.CloseAll()
+		if err == nil {
+			t.Errorf("Expected the self-signed certificate claiming %s to be rejected", server)
+		}
+	})
+
+	t.Run("Mutual IA Authentication", func(t *testing.T) {
+		accepted := make(chan error, 1)
+		// Trust roots of the Config have to request client certificates as well
+		serverOpts := &TLSOptions{Certificates: []tls.Certificate{issue(server)}, Config: &tls.Config{ClientCAs: roots}, VerifyPeerIA: true}
+		clientOpts := &TLSOptions{Certificates: []tls.Certificate{issue(client)}, RootCAs: roots, VerifyPeerIA: true}
+		sock := NewQUICSocket("1-ff00:0:113,[127.0.0.2]:21220")
+		sock.SetTLSOptions(serverOpts)
+		if err := sock.Listen(); err != nil {
+			t.Fatal(err)
+		}
+		defer sock.CloseAll()
+		go func() {
+			_, err := sock.WaitForDialIn()
+			accepted <- err
+		}()
+
+		sock2 := NewQUICSocket("1-ff00:0:110,[127.0.0.1]:11220")
+		sock2.SetTLSOptions(clientOpts)
+		if err := sock2.Listen(); err != nil {
+			t.Fatal(err)
+		}
+		defer sock2.CloseAll()
+		paths, err := lookup.PathLookup(sock.localAddr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = sock2.DialAll(*sock.localAddr, []pathselection.PathQuality{{SnetPath: paths[0]}}, DialOptions{SendAddrPacket: true})
+		if err != nil {
+			t.Fatalf("Expected the dial with issued certificates to succeed, got %v", err)
+		}
+		select {
+		case err := <-accepted:
+			if err != nil {
+				t.Errorf("Expected the server to authenticate the client, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Server did not accept the client")
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/sirupsen/logrus"
+)
+
+// Recorder writes events to a trace, it may be shared by several sockets
+// and selections. Failing writes are logged, but do not affect the caller
+type Recorder struct {
+	mutex  sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer
+	events []Event
+	ticks  int
+}
+
+// NewRecorder writes the trace to w. If w is nil, the events
+// are only kept in memory and returned by Trace
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{}
+	if w != nil {
+		r.enc = json.NewEncoder(w)
+	} else {
+		r.events = make([]Event, 0)
+	}
+	return r
+}
+
+// CreateRecorder writes the trace to a new file, which is closed by Close
+func CreateRecorder(file string) (*Recorder, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(f)
+	r.closer = f
+	return r, nil
+}
+
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closer == nil {
+		return nil
+	}
+	err := r.closer.Close()
+	r.closer = nil
+	r.enc = nil
+	return err
+}
+
+// Trace returns the events recorded so far by a recorder without writer
+func (r *Recorder) Trace() *Trace {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return &Trace{Events: append([]Event(nil), r.events...)}
+}
+
+func (r *Recorder) record(e Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if e.Type == EventMetrics {
+		r.ticks++
+	}
+	e.Tick = r.ticks
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if r.events != nil {
+		r.events = append(r.events, e)
+		return
+	}
+	if r.enc == nil {
+		return
+	}
+	err := r.enc.Encode(e)
+	if err != nil {
+		logrus.Warn("[Recorder] Failed to write ", e.Type, " event: ", err)
+	}
+}
+
+// RecordLookup records the paths to dst, or the error of the lookup
+func (r *Recorder) RecordLookup(dst string, paths []snet.Path, err error) {
+	e := Event{Type: EventLookup, Remote: dst, Paths: NewPaths(paths)}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.record(e)
+}
+
+// RecordMetrics records the latest interval of the metrics of
+// the conns to remote, it has to be called after each tick
+func (r *Recorder) RecordMetrics(remote *snet.UDPAddr, metrics []*packets.PathMetrics) {
+	e := Event{Type: EventMetrics, Conns: make([]ConnMetrics, len(metrics))}
+	if remote != nil {
+		e.Remote = remote.String()
+	}
+	for i, m := range metrics {
+		e.Conns[i] = NewConnMetrics(m)
+	}
+	r.record(e)
+}
+
+// RecordDecision records the pathset a selection chose for the conns to remote
+func (r *Recorder) RecordDecision(selection string, remote *snet.UDPAddr, paths []snet.Path) {
+	e := Event{Type: EventDecision, Selection: selection, Paths: NewPaths(paths)}
+	if remote != nil {
+		e.Remote = remote.String()
+	}
+	r.record(e)
+}
@@ -0,0 +1,65 @@
+package trace
+
+import (
+	"errors"
+
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// Returned by Replay.Lookup if the trace has no lookup up to the current tick
+var ErrNoLookup = errors.New("no path lookup recorded")
+
+// Replay steps through the metrics ticks of a trace. Path lookups are served
+// in the order they were recorded between two ticks, so that a selection
+// sees the same paths as during the recording, as long as it looks up paths
+// as often as before. Further lookups return the latest recorded result
+type Replay struct {
+	trace *Trace
+	// Index of the next event to consume
+	pos    int
+	lookup *Event
+}
+
+func NewReplay(t *Trace) *Replay {
+	return &Replay{trace: t}
+}
+
+// NextTick returns the next metrics tick, false at the end of the trace.
+// Lookups recorded before the tick, but not served, are skipped
+func (r *Replay) NextTick() (Event, bool) {
+	for r.pos < len(r.trace.Events) {
+		e := &r.trace.Events[r.pos]
+		r.pos++
+		switch e.Type {
+		case EventLookup:
+			r.lookup = e
+		case EventMetrics:
+			return *e, true
+		}
+	}
+	return Event{}, false
+}
+
+// Lookup returns the paths of the next lookup before the next tick,
+// or of the latest lookup if there is none
+func (r *Replay) Lookup() ([]snet.Path, error) {
+	for i := r.pos; i < len(r.trace.Events); i++ {
+		e := &r.trace.Events[i]
+		if e.Type == EventMetrics {
+			break
+		}
+		if e.Type == EventLookup {
+			r.lookup = e
+			r.pos = i + 1
+			break
+		}
+	}
+
+	if r.lookup == nil {
+		return nil, ErrNoLookup
+	}
+	if r.lookup.Error != "" {
+		return nil, errors.New(r.lookup.Error)
+	}
+	return SnetPaths(r.lookup.Paths), nil
+}
@@ -0,0 +1,187 @@
+// Package trace records the inputs and decisions of the path selection, i.e.
+// path lookups, metrics ticks and the pathsets chosen by the selections, and
+// replays them to reproduce the decisions without a SCION network
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+type EventType string
+
+const (
+	// Result of a path lookup
+	EventLookup EventType = "lookup"
+	// Metrics of all conns after one metrics interval
+	EventMetrics EventType = "metrics"
+	// Pathset chosen by a selection
+	EventDecision EventType = "decision"
+)
+
+// Event is one line of a trace file
+type Event struct {
+	Time time.Time `json:"time"`
+	Type EventType `json:"type"`
+	// Number of metrics ticks recorded up to this event, including it
+	Tick int `json:"tick"`
+	// Address of the remote the paths were looked up for or used to
+	Remote string `json:"remote,omitempty"`
+	// Result of lookups, chosen pathset of decisions
+	Paths []Path `json:"paths,omitempty"`
+	// Error of a failed lookup
+	Error string `json:"error,omitempty"`
+	// Metrics of each conn in the order of the conns
+	Conns []ConnMetrics `json:"conns,omitempty"`
+	// Selection that made the decision, e.g. DisjointPathselection
+	Selection string `json:"selection,omitempty"`
+}
+
+// Path is a recorded path of a lookup or decision
+type Path = lookup.PathRecord
+
+// ConnMetrics is the sample of one conn in a metrics tick
+type ConnMetrics struct {
+	Fingerprint lookup.PathFingerprint `json:"fingerprint"`
+	// Bandwidth of the last interval in bytes/s
+	ReadBandwidth    int64         `json:"readBandwidth"`
+	WrittenBandwidth int64         `json:"writtenBandwidth"`
+	ReadBytes        int64         `json:"readBytes"`
+	WrittenBytes     int64         `json:"writtenBytes"`
+	RTT              time.Duration `json:"rtt,omitempty"`
+	LostPackets      int64         `json:"lostPackets,omitempty"`
+	// Latest bandwidth reported by the peer, if it reports
+	PeerGoodput        *int64        `json:"peerGoodput,omitempty"`
+	PeerReportInterval time.Duration `json:"peerReportInterval,omitempty"`
+}
+
+func NewPath(p snet.Path) Path {
+	return lookup.NewPathRecord(p)
+}
+
+func NewPaths(paths []snet.Path) []Path {
+	ps := make([]Path, len(paths))
+	for i, p := range paths {
+		ps[i] = NewPath(p)
+	}
+	return ps
+}
+
+func SnetPaths(paths []Path) []snet.Path {
+	ps := make([]snet.Path, len(paths))
+	for i, p := range paths {
+		ps[i] = p.SnetPath()
+	}
+	return ps
+}
+
+// NewConnMetrics samples the latest interval of the metrics of a conn
+func NewConnMetrics(m *packets.PathMetrics) ConnMetrics {
+	cm := ConnMetrics{
+		ReadBytes:    m.ReadBytes,
+		WrittenBytes: m.WrittenBytes,
+		RTT:          m.RTT,
+		LostPackets:  m.LostPackets,
+	}
+	if m.Path != nil && *m.Path != nil && (*m.Path).Metadata() != nil {
+		cm.Fingerprint = lookup.Fingerprint(*m.Path)
+	}
+	if len(m.ReadBandwidth) > 0 {
+		cm.ReadBandwidth = m.ReadBandwidth[len(m.ReadBandwidth)-1]
+	}
+	if len(m.WrittenBandwidth) > 0 {
+		cm.WrittenBandwidth = m.WrittenBandwidth[len(m.WrittenBandwidth)-1]
+	}
+	if bw, ok := m.PeerGoodput(); ok {
+		cm.PeerGoodput = &bw
+		cm.PeerReportInterval = m.PeerReportInterval
+	}
+	return cm
+}
+
+// Apply adds the sample to m as if m was ticked with the recorded traffic
+func (cm ConnMetrics) Apply(m *packets.PathMetrics) {
+	m.ReadBandwidth = append(m.ReadBandwidth, cm.ReadBandwidth)
+	m.WrittenBandwidth = append(m.WrittenBandwidth, cm.WrittenBandwidth)
+	m.ReadBytes = cm.ReadBytes
+	m.LastReadBytes = cm.ReadBytes
+	m.WrittenBytes = cm.WrittenBytes
+	m.LastWrittenBytes = cm.WrittenBytes
+	m.RTT = cm.RTT
+	if cm.RTT > 0 && (m.MinRTT == 0 || cm.RTT < m.MinRTT) {
+		m.MinRTT = cm.RTT
+	}
+	m.LostPackets = cm.LostPackets
+	if cm.PeerGoodput != nil {
+		m.AddPeerReadBandwidth(*cm.PeerGoodput, cm.PeerReportInterval)
+	}
+}
+
+// Trace is a recorded sequence of events
+type Trace struct {
+	Events []Event
+}
+
+// LoadTrace reads a trace file written by a Recorder
+func LoadTrace(file string) (*Trace, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTrace(f)
+}
+
+// ReadTrace reads events until EOF, one JSON object per line
+func ReadTrace(r io.Reader) (*Trace, error) {
+	t := &Trace{Events: make([]Event, 0)}
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var e Event
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		t.Events = append(t.Events, e)
+	}
+}
+
+// Remote returns the remote address of the first event that has one
+func (t *Trace) Remote() string {
+	for _, e := range t.Events {
+		if e.Remote != "" {
+			return e.Remote
+		}
+	}
+	return ""
+}
+
+// Decisions returns the decisions of the trace in their order
+func (t *Trace) Decisions() []Event {
+	return t.filter(EventDecision)
+}
+
+// Ticks returns the metrics ticks of the trace in their order
+func (t *Trace) Ticks() []Event {
+	return t.filter(EventMetrics)
+}
+
+func (t *Trace) filter(eventType EventType) []Event {
+	events := make([]Event, 0)
+	for _, e := range t.Events {
+		if e.Type == eventType {
+			events = append(events, e)
+		}
+	}
+	return events
+}
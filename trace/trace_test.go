@@ -0,0 +1,136 @@
+package trace
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/scion-path-discovery/internal/testutil"
+	"github.com/netsys-lab/scion-path-discovery/packets"
+	lookup "github.com/netsys-lab/scion-path-discovery/pathlookup"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/spath"
+)
+
+// Path from 1-ff00:0:110 to 1-ff00:0:113 via the passed AS
+func testPath(via string, ifID int) snet.Path {
+	p := testutil.Path("1-ff00:0:110", ifID, via, 1, via, 2, "1-ff00:0:113", ifID)
+	p.SPath = spath.Path{Raw: []byte(via)}
+	p.Meta.MTU = 1280
+	p.Meta.Expiry = time.Unix(1700000000, 0).UTC()
+	p.Meta.Latency = []time.Duration{5 * time.Millisecond, 0, 10 * time.Millisecond}
+	p.Meta.Bandwidth = []uint64{1000, 2000, 3000}
+	return p
+}
+
+func Test_Trace(t *testing.T) {
+	remote, err := snet.ParseUDPAddr("1-ff00:0:113,[127.0.0.2]:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []snet.Path{testPath("1-ff00:0:111", 1), testPath("1-ff00:0:112", 2)}
+
+	t.Run("Trace Restores Paths", func(t *testing.T) {
+		var buf bytes.Buffer
+		rec := NewRecorder(&buf)
+		rec.RecordLookup(remote.String(), paths, nil)
+
+		trace, err := ReadTrace(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(trace.Events) != 1 || trace.Remote() != remote.String() {
+			t.Fatalf("Expected one lookup to %s, got %v", remote, trace.Events)
+		}
+		restored := SnetPaths(trace.Events[0].Paths)
+		for i, p := range restored {
+			expected := paths[i]
+			if lookup.Fingerprint(p) != lookup.Fingerprint(expected) {
+				t.Errorf("Expected path %s, got %s", expected, p)
+			}
+			if p.Destination() != expected.Destination() || !bytes.Equal(p.Path().Raw, expected.Path().Raw) {
+				t.Errorf("Expected destination and raw path of %s, got %s", expected, p)
+			}
+			meta, expectedMeta := p.Metadata(), expected.Metadata()
+			if meta.MTU != expectedMeta.MTU || !meta.Expiry.Equal(expectedMeta.Expiry) ||
+				meta.Latency[2] != expectedMeta.Latency[2] || meta.Bandwidth[1] != expectedMeta.Bandwidth[1] {
+				t.Errorf("Expected metadata %v, got %v", expectedMeta, meta)
+			}
+		}
+	})
+
+	t.Run("Trace Restores Metrics", func(t *testing.T) {
+		rec := NewRecorder(nil)
+		m := packets.NewPathMetrics(time.Second)
+		m.Path = &paths[0]
+		m.WrittenBytes = 3000
+		m.Tick()
+		m.RTT = 20 * time.Millisecond
+		m.AddPeerReadBandwidth(2500, time.Second)
+		rec.RecordMetrics(remote, []*packets.PathMetrics{m})
+		rec.RecordDecision("DisjointPathselection", remote, paths[:1])
+
+		trace := rec.Trace()
+		ticks, decisions := trace.Ticks(), trace.Decisions()
+		if len(ticks) != 1 || len(decisions) != 1 || decisions[0].Tick != 1 {
+			t.Fatalf("Expected a decision after one tick, got %v", trace.Events)
+		}
+		cm := ticks[0].Conns[0]
+		if cm.Fingerprint != lookup.Fingerprint(paths[0]) {
+			t.Errorf("Expected sample of %s, got %s", lookup.Fingerprint(paths[0]), cm.Fingerprint)
+		}
+
+		replayed := packets.NewPathMetrics(time.Second)
+		cm.Apply(replayed)
+		goodput, ok := replayed.PeerGoodput()
+		if replayed.WrittenBandwidth[0] != 3000 || replayed.RTT != m.RTT || !ok || goodput != 2500 {
+			t.Errorf("Expected the recorded metrics, got %+v", replayed)
+		}
+		// The next tick continues from the recorded counters
+		replayed.Tick()
+		if replayed.WrittenBandwidth[1] != 0 {
+			t.Errorf("Expected no traffic after the recorded tick, got %d", replayed.WrittenBandwidth[1])
+		}
+	})
+
+	t.Run("Trace Replays Lookups Between Ticks", func(t *testing.T) {
+		rec := NewRecorder(nil)
+		rec.RecordLookup(remote.String(), paths, nil)
+		rec.RecordMetrics(remote, nil)
+		rec.RecordMetrics(remote, nil)
+		rec.RecordLookup(remote.String(), paths[1:], nil)
+		rec.RecordLookup(remote.String(), nil, errors.New("no paths"))
+		rec.RecordMetrics(remote, nil)
+
+		replay := NewReplay(rec.Trace())
+		expected := []struct {
+			numPaths int
+			err      bool
+		}{{2, false}, {2, false}}
+		for _, e := range expected {
+			ps, err := replay.Lookup()
+			if len(ps) != e.numPaths || (err != nil) != e.err {
+				t.Errorf("Expected %d paths before the first tick, got %d, %v", e.numPaths, len(ps), err)
+			}
+		}
+
+		replay.NextTick()
+		replay.NextTick()
+		ps, _ := replay.Lookup()
+		if len(ps) != 1 {
+			t.Errorf("Expected the lookup after the second tick, got %d paths", len(ps))
+		}
+		_, err := replay.Lookup()
+		if err == nil || err.Error() != "no paths" {
+			t.Errorf("Expected the recorded error, got %v", err)
+		}
+
+		if _, ok := replay.NextTick(); !ok {
+			t.Error("Expected a third tick")
+		}
+		if _, ok := replay.NextTick(); ok {
+			t.Error("Expected the end of the trace")
+		}
+	})
+}